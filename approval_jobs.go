@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/doctype"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/google/uuid"
+)
+
+// approval job statuses
+const (
+	approvalJobPending   = "pending"
+	approvalJobRunning   = "running"
+	approvalJobCompleted = "completed"
+	approvalJobFailed    = "failed"
+)
+
+// approval steps, a job records the last one it finished
+const (
+	approvalStepCreated   = "created"
+	approvalStepFetched   = "fetched"
+	approvalStepArchived  = "archived"
+	approvalStepSubmitted = "submitted"
+	approvalStepCompleted = "completed"
+)
+
+const (
+	maxApprovalAttempts  = 8
+	approvalRetryBase    = 30 * time.Second
+	approvalRetryMax     = time.Hour
+	approvalPollInterval = 15 * time.Second
+	// how long one attempt may take before it counts as failed
+	approvalAttemptTimeout = 10 * time.Minute
+)
+
+var errApprovalInProgress = errors.New("approval is already in progress")
+
+// approvalRetryDelay doubles with every failed attempt up to an hour.
+func approvalRetryDelay(attempts int64) time.Duration {
+	delay := approvalRetryBase
+	for i := int64(1); i < attempts && delay < approvalRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, approvalRetryMax)
+}
+
+// approvalJobForInvoice returns the approval already in flight for the invoice, so
+// approving twice continues the first one instead of uploading everything again.
+func (cfg *apiConfig) approvalJobForInvoice(ctx context.Context, invoice database.StagedInvoice, attachmentIDs []string) (database.ApprovalJob, error) {
+	if invoice.DocumentType.String == doctype.Quote {
+		return database.ApprovalJob{}, errNotAnExpense
+	}
+
+	job, err := cfg.DB.GetActiveApprovalJobByInvoice(ctx, invoice.ID)
+	if err == nil {
+		return job, nil
+	}
+	if err != sql.ErrNoRows {
+		return database.ApprovalJob{}, err
+	}
+
+	selected, err := json.Marshal(append([]string{}, attachmentIDs...))
+	if err != nil {
+		return database.ApprovalJob{}, err
+	}
+	now := time.Now().Unix()
+	return cfg.DB.CreateApprovalJob(ctx, database.CreateApprovalJobParams{
+		ID:              uuid.New().String(),
+		UserID:          invoice.UserID,
+		StagedInvoiceID: invoice.ID,
+		AttachmentIds:   string(selected),
+		NextAttemptAt:   now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+}
+
+// startApproval marks the invoice approving, which takes it off the review list, and
+// runs its approval job in the background. Progress is polled with GetApprovalJob.
+// The job is only created once the invoice is approving, so a refused transition
+// leaves nothing behind for the approval worker to pick up.
+func (cfg *apiConfig) startApproval(ctx context.Context, actor invoiceActor, invoice database.StagedInvoice, attachmentIDs []string) (database.ApprovalJob, error) {
+	if invoice.DocumentType.String == doctype.Quote {
+		return database.ApprovalJob{}, errNotAnExpense
+	}
+
+	claimed := invoice.Status != mailsource.StatusApproving
+	if claimed {
+		if err := cfg.changeInvoiceStatus(ctx, invoice, mailsource.StatusApproving); err != nil {
+			return database.ApprovalJob{}, err
+		}
+	}
+
+	job, err := cfg.approvalJobForInvoice(ctx, invoice, attachmentIDs)
+	if err != nil {
+		if claimed {
+			// back to where it was, an invoice approving without a job would never finish
+			_, revertErr := cfg.DB.TransitionStagedInvoiceStatus(context.WithoutCancel(ctx), database.TransitionStagedInvoiceStatusParams{
+				Status:    invoice.Status,
+				UpdatedAt: time.Now().Unix(),
+				ID:        invoice.ID,
+				UserID:    invoice.UserID,
+				Status_2:  mailsource.StatusApproving,
+			})
+			if revertErr != nil {
+				log.Printf("Failed to return invoice %s to %s: %v", invoice.ID, invoice.Status, revertErr)
+			}
+		}
+		return database.ApprovalJob{}, err
+	}
+	if claimed {
+		cfg.recordStatusChange(ctx, invoice.ID, actor, invoice.Status, mailsource.StatusApproving, invoiceEvent{ApprovalJobID: job.ID})
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), approvalAttemptTimeout)
+		defer cancel()
+		files, err := cfg.runApprovalJob(ctx, job)
+		if err == nil {
+			log.Printf("Approval job %s approved invoice %s (%d files)", job.ID, invoice.ID, len(files))
+		}
+	}()
+	return job, nil
+}
+
+// runApprovalJob claims the job and carries it on from its last finished step. A
+// failed attempt is scheduled for a retry unless retrying can't help or the attempts
+// ran out, then the job fails and a queued invoice goes back to review.
+func (cfg *apiConfig) runApprovalJob(ctx context.Context, job database.ApprovalJob) ([]approvedFile, error) {
+	claimed, err := cfg.DB.ClaimApprovalJob(ctx, database.ClaimApprovalJobParams{
+		UpdatedAt: time.Now().Unix(),
+		ID:        job.ID,
+	})
+	if err != nil {
+		return nil, &approvalError{step: "Failed to start approval", err: err}
+	}
+	if claimed == 0 {
+		return nil, errApprovalInProgress
+	}
+
+	approved, runErr := cfg.runApprovalSteps(ctx, job)
+
+	// the job has to be released even when the request that ran it went away
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+	attempts := job.Attempts + 1
+	if runErr == nil {
+		cfg.setApprovalStep(ctx, job.ID, approvalStepCompleted)
+		err = cfg.DB.FinishApprovalJob(ctx, database.FinishApprovalJobParams{
+			Status:     approvalJobCompleted,
+			Attempts:   attempts,
+			FinishedAt: sql.NullInt64{Int64: now.Unix(), Valid: true},
+			UpdatedAt:  now.Unix(),
+			ID:         job.ID,
+		})
+		if err != nil {
+			log.Printf("Failed to mark approval job %s completed: %v", job.ID, err)
+		}
+		return approved, nil
+	}
+
+	lastError := sql.NullString{String: runErr.Error(), Valid: true}
+	if attempts < maxApprovalAttempts && retryableApprovalError(runErr) {
+		retryAt := now.Add(approvalRetryDelay(attempts))
+		err = cfg.DB.RetryApprovalJob(ctx, database.RetryApprovalJobParams{
+			Attempts:      attempts,
+			NextAttemptAt: retryAt.Unix(),
+			LastError:     lastError,
+			UpdatedAt:     now.Unix(),
+			ID:            job.ID,
+		})
+		if err != nil {
+			log.Printf("Failed to schedule retry of approval job %s: %v", job.ID, err)
+		}
+		cfg.recordInvoiceEvent(ctx, job.StagedInvoiceID, approvalJobActor, invoiceEvent{
+			Event:         eventApprovalRetry,
+			ApprovalJobID: job.ID,
+			Error:         runErr.Error(),
+		})
+		log.Printf("Approval job %s failed attempt %d, retrying at %s: %v", job.ID, attempts, retryAt.Format(time.RFC3339), runErr)
+
+		var stepErr *approvalError
+		if errors.As(runErr, &stepErr) {
+			stepErr.retryAt = retryAt
+		}
+		return nil, runErr
+	}
+
+	log.Printf("Approval job %s failed after %d attempts: %v", job.ID, attempts, runErr)
+	err = cfg.DB.FinishApprovalJob(ctx, database.FinishApprovalJobParams{
+		Status:     approvalJobFailed,
+		Attempts:   attempts,
+		LastError:  lastError,
+		FinishedAt: sql.NullInt64{Int64: now.Unix(), Valid: true},
+		UpdatedAt:  now.Unix(),
+		ID:         job.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to mark approval job %s failed: %v", job.ID, err)
+	}
+	returned, err := cfg.DB.TransitionStagedInvoiceStatus(ctx, database.TransitionStagedInvoiceStatusParams{
+		Status:    mailsource.StatusPendingReview,
+		UpdatedAt: now.Unix(),
+		ID:        job.StagedInvoiceID,
+		UserID:    job.UserID,
+		Status_2:  mailsource.StatusApproving,
+	})
+	if err != nil {
+		log.Printf("Failed to return invoice %s to review: %v", job.StagedInvoiceID, err)
+	}
+	if returned > 0 {
+		cfg.recordStatusChange(ctx, job.StagedInvoiceID, approvalJobActor, mailsource.StatusApproving, mailsource.StatusPendingReview, invoiceEvent{
+			ApprovalJobID: job.ID,
+			Error:         runErr.Error(),
+		})
+	}
+	return nil, runErr
+}
+
+// retryableApprovalError is false for mistakes in the request itself.
+func retryableApprovalError(err error) bool {
+	var transitionErr *statusTransitionError
+	return !errors.Is(err, errUnknownAttachment) && !errors.Is(err, errNotAnExpense) && !errors.Is(err, sql.ErrNoRows) && !errors.As(err, &transitionErr)
+}
+
+// runApprovalSteps fetches the attachments, archives them to S3, submits them to the
+// accounting service and approves the invoice. Every file records each step it got
+// through, so a rerun skips what's done: S3 keys are fixed when the files are first
+// fetched, and a file that was submitted is never uploaded to accounting again. Once
+// everything is archived the mailbox isn't needed anymore, the rest reads from S3.
+func (cfg *apiConfig) runApprovalSteps(ctx context.Context, job database.ApprovalJob) ([]approvedFile, error) {
+	invoice, err := cfg.DB.GetStagedInvoice(ctx, database.GetStagedInvoiceParams{
+		ID:     job.StagedInvoiceID,
+		UserID: job.UserID,
+	})
+	if err != nil {
+		return nil, &approvalError{step: "Failed to load invoice", err: err}
+	}
+	// a job for an invoice that isn't approving must not upload anything
+	if invoice.Status != mailsource.StatusApproving && invoice.Status != mailsource.StatusApproved {
+		return nil, &approvalError{step: "Failed to approve invoice", err: &statusTransitionError{from: invoice.Status, to: mailsource.StatusApproved}}
+	}
+
+	jobFiles, err := cfg.DB.ListApprovalJobFiles(ctx, job.ID)
+	if err != nil {
+		return nil, &approvalError{step: "Failed to load approval progress", err: err}
+	}
+
+	// data of the files fetched in this attempt, by position
+	fetched := make(map[int64][]byte)
+	if len(jobFiles) == 0 || !allArchived(jobFiles) {
+		files, err := cfg.fetchApprovalFiles(ctx, job, invoice)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobFiles) == 0 {
+			jobFiles, err = cfg.recordApprovalFiles(ctx, job, invoice, files)
+			if err != nil {
+				return nil, &approvalError{step: "Failed to record fetched files", err: err}
+			}
+		}
+		if len(files) != len(jobFiles) {
+			return nil, &approvalError{step: "Failed to get attachments", err: fmt.Errorf("message now has %d files, approval started with %d", len(files), len(jobFiles))}
+		}
+		for i, file := range files {
+			if file.AttachmentID != jobFiles[i].StagedAttachmentID.String {
+				return nil, &approvalError{step: "Failed to get attachments", err: fmt.Errorf("file %d of the message changed since approval started", i+1)}
+			}
+			fetched[jobFiles[i].Position] = file.Data
+		}
+	}
+
+	for _, file := range jobFiles {
+		if file.ArchivedAt.Valid {
+			continue
+		}
+		if err := cfg.S3.UploadFile(ctx, file.S3Key, fetched[file.Position]); err != nil {
+			return nil, &approvalError{step: "Failed to upload file to S3", err: err}
+		}
+		log.Printf("Successfully uploaded invoice to S3 at key: %s", file.S3Key)
+		err = cfg.DB.MarkApprovalJobFileArchived(ctx, database.MarkApprovalJobFileArchivedParams{
+			ArchivedAt:    sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+			ApprovalJobID: job.ID,
+			Position:      file.Position,
+		})
+		if err != nil {
+			return nil, &approvalError{step: "Failed to record archived file", err: err}
+		}
+		cfg.recordInvoiceEvent(ctx, invoice.ID, approvalJobActor, invoiceEvent{
+			Event:         eventFileArchived,
+			ApprovalJobID: job.ID,
+			S3Key:         file.S3Key,
+		})
+		if file.StagedAttachmentID.Valid {
+			err = cfg.DB.SetStagedAttachmentS3Key(ctx, database.SetStagedAttachmentS3KeyParams{
+				S3Key: sql.NullString{String: file.S3Key, Valid: true},
+				ID:    file.StagedAttachmentID.String,
+			})
+			if err != nil {
+				// previews fall back to the mailbox
+				log.Printf("Failed to record S3 key of attachment %s: %v", file.StagedAttachmentID.String, err)
+			}
+		}
+	}
+	cfg.setApprovalStep(ctx, job.ID, approvalStepArchived)
+
+	// fields only describe the attachment they were read from
+	var fields database.InvoiceField
+	hasFields := false
+	if row, err := cfg.DB.GetInvoiceFields(ctx, invoice.ID); err == nil {
+		fields, hasFields = row, row.StagedAttachmentID.Valid
+	} else if err != sql.ErrNoRows {
+		log.Printf("Failed to load fields of invoice %s, uploading without them: %v", invoice.ID, err)
+	}
+
+	for _, file := range jobFiles {
+		if file.SubmittedAt.Valid {
+			continue
+		}
+		data, ok := fetched[file.Position]
+		if !ok {
+			data, err = cfg.S3.DownloadFile(ctx, file.S3Key)
+			if err != nil {
+				return nil, &approvalError{step: "Failed to read archived file from S3", err: err}
+			}
+		}
+
+		log.Printf("Staging file %s with accounting services...", file.Filename)
+		details := documentDetails(invoice)
+		if hasFields && file.StagedAttachmentID.String == fields.StagedAttachmentID.String {
+			details = expenseDetails(details, fields)
+		}
+		result, err := cfg.Accounting.StagedInvoiceFile(ctx, file.Filename, data, details)
+		if err != nil {
+			return nil, &approvalError{step: "Failed to stage invoice with accounting service", err: err}
+		}
+		// a crash before this is recorded is the one way a file gets submitted twice
+		err = cfg.DB.MarkApprovalJobFileSubmitted(context.WithoutCancel(ctx), database.MarkApprovalJobFileSubmittedParams{
+			SubmittedAt:   sql.NullInt64{Int64: time.Now().Unix(), Valid: true},
+			ApprovalJobID: job.ID,
+			Position:      file.Position,
+		})
+		if err != nil {
+			return nil, &approvalError{step: "Failed to record submitted file", err: err}
+		}
+		response, _ := json.Marshal(result)
+		cfg.recordInvoiceEvent(ctx, invoice.ID, approvalJobActor, invoiceEvent{
+			Event:              eventFileSubmitted,
+			ApprovalJobID:      job.ID,
+			S3Key:              file.S3Key,
+			AccountingResponse: string(response),
+		})
+	}
+	cfg.setApprovalStep(ctx, job.ID, approvalStepSubmitted)
+
+	// a rerun after a crash may find the invoice approved already
+	if invoice.Status != mailsource.StatusApproved {
+		approvedRows, err := cfg.DB.TransitionStagedInvoiceStatus(ctx, database.TransitionStagedInvoiceStatusParams{
+			Status:    mailsource.StatusApproved,
+			UpdatedAt: time.Now().Unix(),
+			ID:        invoice.ID,
+			UserID:    invoice.UserID,
+			Status_2:  mailsource.StatusApproving,
+		})
+		if err != nil {
+			return nil, &approvalError{step: "Failed to approve invoice", err: err}
+		}
+		if approvedRows == 0 {
+			return nil, &approvalError{step: "Failed to approve invoice", err: &statusTransitionError{from: mailsource.StatusApproving, to: mailsource.StatusApproved, stale: true}}
+		}
+		cfg.recordStatusChange(ctx, invoice.ID, approvalJobActor, mailsource.StatusApproving, mailsource.StatusApproved, invoiceEvent{ApprovalJobID: job.ID})
+		// rules approving for the user say nothing about what they consider an invoice
+		if cfg.decidedByUser(ctx, invoice.ID, mailsource.StatusApproving) {
+			cfg.learnDecision(invoice, mailsource.StatusApproved)
+		}
+	}
+
+	approved := make([]approvedFile, 0, len(jobFiles))
+	for _, file := range jobFiles {
+		approved = append(approved, approvedFile{Filename: file.Filename, S3Key: file.S3Key})
+	}
+	return approved, nil
+}
+
+func (cfg *apiConfig) fetchApprovalFiles(ctx context.Context, job database.ApprovalJob, invoice database.StagedInvoice) ([]invoiceFile, error) {
+	var attachmentIDs []string
+	if err := json.Unmarshal([]byte(job.AttachmentIds), &attachmentIDs); err != nil {
+		return nil, &approvalError{step: "Failed to read approval job", err: err}
+	}
+
+	source, closeSource, err := cfg.mailSourceForInvoice(ctx, invoice)
+	if err != nil {
+		return nil, &approvalError{step: "Failed to connect to mailbox", err: err}
+	}
+	defer closeSource()
+
+	files, err := cfg.fetchInvoiceAttachments(ctx, source, invoice, attachmentIDs)
+	if err != nil {
+		return nil, &approvalError{step: "Failed to get attachments from " + source.Name(), err: err}
+	}
+	return files, nil
+}
+
+// recordApprovalFiles gives the files of a job their unique names and S3 keys. When
+// the last approval of the invoice failed for good, files it got through keep their
+// names, keys and progress, so approving again doesn't submit them a second time.
+func (cfg *apiConfig) recordApprovalFiles(ctx context.Context, job database.ApprovalJob, invoice database.StagedInvoice, files []invoiceFile) ([]database.ApprovalJobFile, error) {
+	previous, err := cfg.failedApprovalFiles(ctx, invoice.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	jobFiles := make([]database.ApprovalJobFile, 0, len(files))
+	usedNames := make(map[string]bool)
+	for _, earlier := range previous {
+		usedNames[earlier.Filename] = true
+	}
+	for i, file := range files {
+		jobFile := database.ApprovalJobFile{
+			ApprovalJobID:      job.ID,
+			Position:           int64(i),
+			StagedAttachmentID: sql.NullString{String: file.AttachmentID, Valid: file.AttachmentID != ""},
+		}
+		if earlier, ok := previous[file.AttachmentID]; ok && file.AttachmentID != "" {
+			jobFile.Filename = earlier.Filename
+			jobFile.S3Key = earlier.S3Key
+			jobFile.ArchivedAt = earlier.ArchivedAt
+			jobFile.SubmittedAt = earlier.SubmittedAt
+			delete(previous, file.AttachmentID)
+		} else {
+			filename := file.Filename
+			if usedNames[filename] {
+				filename = fmt.Sprintf("%d-%s", i+1, filename)
+			}
+			usedNames[filename] = true
+			jobFile.Filename = filename
+			jobFile.S3Key = fmt.Sprintf("invoices/%s/%s/%s", invoice.UserID, invoice.ID, filename)
+		}
+
+		err := cfg.DB.CreateApprovalJobFile(ctx, database.CreateApprovalJobFileParams{
+			ApprovalJobID:      jobFile.ApprovalJobID,
+			Position:           jobFile.Position,
+			StagedAttachmentID: jobFile.StagedAttachmentID,
+			Filename:           jobFile.Filename,
+			S3Key:              jobFile.S3Key,
+			ArchivedAt:         jobFile.ArchivedAt,
+			SubmittedAt:        jobFile.SubmittedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		jobFiles = append(jobFiles, jobFile)
+	}
+	cfg.setApprovalStep(ctx, job.ID, approvalStepFetched)
+	return jobFiles, nil
+}
+
+// failedApprovalFiles returns the files the last approval of the invoice archived or
+// submitted before it failed, by attachment. A completed approval counts as done with,
+// reopening or revoking it starts over.
+func (cfg *apiConfig) failedApprovalFiles(ctx context.Context, invoiceID string) (map[string]database.ApprovalJobFile, error) {
+	job, err := cfg.DB.GetLatestFinishedApprovalJobByInvoice(ctx, invoiceID)
+	if err == sql.ErrNoRows || err == nil && job.Status != approvalJobFailed {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := cfg.DB.ListApprovalJobFiles(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]database.ApprovalJobFile)
+	for _, file := range files {
+		if file.StagedAttachmentID.Valid && (file.ArchivedAt.Valid || file.SubmittedAt.Valid) {
+			previous[file.StagedAttachmentID.String] = file
+		}
+	}
+	return previous, nil
+}
+
+// setApprovalStep records progress for status reporting, the file rows are what
+// reruns go by, so a failure here is only logged.
+func (cfg *apiConfig) setApprovalStep(ctx context.Context, jobID, step string) {
+	err := cfg.DB.SetApprovalJobStep(ctx, database.SetApprovalJobStepParams{
+		Step:      step,
+		UpdatedAt: time.Now().Unix(),
+		ID:        jobID,
+	})
+	if err != nil {
+		log.Printf("Failed to record step %s of approval job %s: %v", step, jobID, err)
+	}
+}
+
+func allArchived(files []database.ApprovalJobFile) bool {
+	for _, file := range files {
+		if !file.ArchivedAt.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// runApprovalWorker retries approval jobs as they come due until ctx is cancelled.
+// Jobs that were running when the server last stopped are picked up again first.
+func (cfg *apiConfig) runApprovalWorker(ctx context.Context) {
+	now := time.Now().Unix()
+	err := cfg.DB.ResumeInterruptedApprovalJobs(ctx, database.ResumeInterruptedApprovalJobsParams{
+		NextAttemptAt: now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to resume interrupted approvals: %v", err)
+	}
+
+	log.Printf("Approval worker started: checking every %s", approvalPollInterval)
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.runDueApprovalJobs(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Approval worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) runDueApprovalJobs(ctx context.Context) {
+	jobs, err := cfg.DB.ListDueApprovalJobs(ctx, database.ListDueApprovalJobsParams{
+		NextAttemptAt: time.Now().Unix(),
+		Limit:         20,
+	})
+	if err != nil {
+		log.Printf("Approval worker failed to list due jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		// failures are logged and rescheduled by runApprovalJob
+		attemptCtx, cancel := context.WithTimeout(ctx, approvalAttemptTimeout)
+		files, err := cfg.runApprovalJob(attemptCtx, job)
+		cancel()
+		if err != nil {
+			continue
+		}
+		log.Printf("Approval job %s approved invoice %s (%d files)", job.ID, job.StagedInvoiceID, len(files))
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/accountingservice"
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+)
+
+var errBackendDown = errors.New("backend down")
+
+// fakeStore keeps objects in memory. Uploaded documents live in it too, so it's the
+// mailbox of invoices from the upload source. Reading or writing failKey fails.
+type fakeStore struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	uploads   map[string]int
+	downloads map[string]int
+	failKey   string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		objects:   make(map[string][]byte),
+		uploads:   make(map[string]int),
+		downloads: make(map[string]int),
+	}
+}
+
+func (s *fakeStore) UploadFile(ctx context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == s.failKey {
+		return errBackendDown
+	}
+	s.objects[key] = data
+	s.uploads[key]++
+	return nil
+}
+
+func (s *fakeStore) DownloadFile(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == s.failKey {
+		return nil, errBackendDown
+	}
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("no object at %s", key)
+	}
+	s.downloads[key]++
+	return data, nil
+}
+
+func (s *fakeStore) OpenFile(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	data, err := s.DownloadFile(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func (s *fakeStore) DeletePrefix(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.objects, key)
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
+
+// fakeAccounting records what was submitted to it. Submitting failFile fails.
+type fakeAccounting struct {
+	mu        sync.Mutex
+	submitted map[string]int
+	failFile  string
+}
+
+func (a *fakeAccounting) StagedInvoiceFile(ctx context.Context, filename string, fileData []byte, details accountingservice.ExpenseDetails) (accountingservice.UploadResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if filename == a.failFile {
+		return accountingservice.UploadResult{}, errBackendDown
+	}
+	a.submitted[filename]++
+	return accountingservice.UploadResult{FileKey: filename, Status: "ok"}, nil
+}
+
+func newTestConfig(t *testing.T) (*apiConfig, *fakeStore, *fakeAccounting) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	goose.SetBaseFS(migrationFiles)
+	goose.SetLogger(goose.NopLogger())
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		t.Fatalf("failed to set goose dialect: %v", err)
+	}
+	if err := goose.Up(db, "sql/schema"); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+
+	store := newFakeStore()
+	accounting := &fakeAccounting{submitted: make(map[string]int)}
+	return &apiConfig{DB: database.New(db), S3: store, Accounting: accounting}, store, accounting
+}
+
+// stageApproval uploads an invoice with the given files and starts approving it the
+// way the approve handler does, without running the job.
+func stageApproval(t *testing.T, cfg *apiConfig, store *fakeStore, filenames ...string) (database.StagedInvoice, database.ApprovalJob) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	userID := "user-1"
+	err := cfg.DB.CreateUser(ctx, database.CreateUserParams{ID: userID, Email: "user@example.com", CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	invoice, err := cfg.DB.CreateStagedInvoice(ctx, database.CreateStagedInvoiceParams{
+		ID:            "invoice-1",
+		UserID:        userID,
+		Source:        uploadSourceName,
+		Status:        mailsource.StatusApproving,
+		Tags:          "[]",
+		Sender:        "billing@example.com",
+		Subject:       "Invoice",
+		HasAttachment: true,
+		ReceivedAt:    now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		t.Fatalf("failed to create invoice: %v", err)
+	}
+
+	for i, filename := range filenames {
+		key := "uploads/" + filename
+		store.objects[key] = []byte("%PDF " + filename)
+		err := cfg.DB.CreateStagedAttachment(ctx, database.CreateStagedAttachmentParams{
+			ID:              fmt.Sprintf("attachment-%d", i+1),
+			StagedInvoiceID: invoice.ID,
+			Position:        int64(i),
+			GmailPartID:     key,
+			Filename:        filename,
+			MimeType:        "application/pdf",
+			CreatedAt:       now,
+		})
+		if err != nil {
+			t.Fatalf("failed to create attachment: %v", err)
+		}
+	}
+
+	job, err := cfg.approvalJobForInvoice(ctx, invoice, nil)
+	if err != nil {
+		t.Fatalf("failed to create approval job: %v", err)
+	}
+	return invoice, job
+}
+
+func getApprovalJob(t *testing.T, cfg *apiConfig, job database.ApprovalJob) database.ApprovalJob {
+	t.Helper()
+	job, err := cfg.DB.GetApprovalJob(context.Background(), database.GetApprovalJobParams{ID: job.ID, UserID: job.UserID})
+	if err != nil {
+		t.Fatalf("failed to load approval job: %v", err)
+	}
+	return job
+}
+
+func getInvoiceStatus(t *testing.T, cfg *apiConfig, invoice database.StagedInvoice) string {
+	t.Helper()
+	invoice, err := cfg.DB.GetStagedInvoice(context.Background(), database.GetStagedInvoiceParams{ID: invoice.ID, UserID: invoice.UserID})
+	if err != nil {
+		t.Fatalf("failed to load invoice: %v", err)
+	}
+	return invoice.Status
+}
+
+// checkDoneOnce expects every file archived and submitted exactly once.
+func checkDoneOnce(t *testing.T, store *fakeStore, accounting *fakeAccounting, filenames ...string) {
+	t.Helper()
+	for _, filename := range filenames {
+		key := "invoices/user-1/invoice-1/" + filename
+		if store.uploads[key] != 1 {
+			t.Errorf("expected %s archived once, but it was archived %d times", key, store.uploads[key])
+		}
+		if accounting.submitted[filename] != 1 {
+			t.Errorf("expected %s submitted once, but it was submitted %d times", filename, accounting.submitted[filename])
+		}
+	}
+}
+
+func TestApprovalJobResumesAfterCrash(t *testing.T) {
+	testCases := []struct {
+		name        string
+		failKey     string
+		failFile    string
+		wantStep    string
+		wantFetches int
+	}{
+		{
+			name:        "Crash While Fetching",
+			failKey:     "uploads/b.pdf",
+			wantStep:    approvalStepCreated,
+			wantFetches: 2,
+		},
+		{
+			name:        "Crash While Archiving",
+			failKey:     "invoices/user-1/invoice-1/b.pdf",
+			wantStep:    approvalStepFetched,
+			wantFetches: 2,
+		},
+		{
+			name:        "Crash While Submitting",
+			failFile:    "b.pdf",
+			wantStep:    approvalStepArchived,
+			wantFetches: 1,
+		},
+		{
+			name:        "Crash Before Finishing",
+			wantStep:    approvalStepSubmitted,
+			wantFetches: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg, store, accounting := newTestConfig(t)
+			invoice, job := stageApproval(t, cfg, store, "a.pdf", "b.pdf")
+
+			// the steps run without the job being released, as if the server died
+			store.failKey, accounting.failFile = tc.failKey, tc.failFile
+			claimed, err := cfg.DB.ClaimApprovalJob(ctx, database.ClaimApprovalJobParams{ID: job.ID, UpdatedAt: time.Now().Unix()})
+			if err != nil || claimed != 1 {
+				t.Fatalf("failed to claim approval job: %v", err)
+			}
+			_, err = cfg.runApprovalSteps(ctx, job)
+			if tc.failKey != "" || tc.failFile != "" {
+				if !errors.Is(err, errBackendDown) {
+					t.Fatalf("expected the attempt to fail, but got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected the attempt to succeed, but got %v", err)
+			}
+			if step := getApprovalJob(t, cfg, job).Step; step != tc.wantStep {
+				t.Errorf("expected step %s, but got %s", tc.wantStep, step)
+			}
+
+			store.failKey, accounting.failFile = "", ""
+			err = cfg.DB.ResumeInterruptedApprovalJobs(ctx, database.ResumeInterruptedApprovalJobsParams{
+				NextAttemptAt: time.Now().Unix(),
+				UpdatedAt:     time.Now().Unix(),
+			})
+			if err != nil {
+				t.Fatalf("failed to resume approval jobs: %v", err)
+			}
+			cfg.runDueApprovalJobs(ctx)
+
+			job = getApprovalJob(t, cfg, job)
+			if job.Status != approvalJobCompleted || job.Step != approvalStepCompleted {
+				t.Errorf("expected the job completed, but it is %s at step %s", job.Status, job.Step)
+			}
+			if status := getInvoiceStatus(t, cfg, invoice); status != mailsource.StatusApproved {
+				t.Errorf("expected the invoice approved, but it is %s", status)
+			}
+			checkDoneOnce(t, store, accounting, "a.pdf", "b.pdf")
+			// archived files are read back from S3, not from the mailbox
+			if fetches := store.downloads["uploads/a.pdf"]; fetches != tc.wantFetches {
+				t.Errorf("expected a.pdf fetched %d times, but it was fetched %d times", tc.wantFetches, fetches)
+			}
+		})
+	}
+}
+
+func TestApprovalJobRetriesUntilExhausted(t *testing.T) {
+	ctx := context.Background()
+	cfg, store, accounting := newTestConfig(t)
+	invoice, job := stageApproval(t, cfg, store, "a.pdf", "b.pdf")
+
+	accounting.failFile = "b.pdf"
+	for attempt := int64(1); attempt <= maxApprovalAttempts; attempt++ {
+		job = getApprovalJob(t, cfg, job)
+		if _, err := cfg.runApprovalJob(ctx, job); !errors.Is(err, errBackendDown) {
+			t.Fatalf("expected attempt %d to fail, but got %v", attempt, err)
+		}
+
+		job = getApprovalJob(t, cfg, job)
+		if job.Attempts != attempt {
+			t.Errorf("expected %d attempts, but got %d", attempt, job.Attempts)
+		}
+		if attempt == maxApprovalAttempts {
+			break
+		}
+		if job.Status != approvalJobPending {
+			t.Fatalf("expected the job pending after attempt %d, but it is %s", attempt, job.Status)
+		}
+		if delay := time.Duration(job.NextAttemptAt-job.UpdatedAt) * time.Second; delay != approvalRetryDelay(attempt) {
+			t.Errorf("expected a retry in %s after attempt %d, but got %s", approvalRetryDelay(attempt), attempt, delay)
+		}
+	}
+
+	if job.Status != approvalJobFailed {
+		t.Errorf("expected the job failed, but it is %s", job.Status)
+	}
+	if status := getInvoiceStatus(t, cfg, invoice); status != mailsource.StatusPendingReview {
+		t.Errorf("expected the invoice back in review, but it is %s", status)
+	}
+
+	// approving again carries over what the failed job got through
+	accounting.failFile = ""
+	invoice, err := cfg.DB.GetStagedInvoice(ctx, database.GetStagedInvoiceParams{ID: invoice.ID, UserID: invoice.UserID})
+	if err != nil {
+		t.Fatalf("failed to load invoice: %v", err)
+	}
+	if err := cfg.changeInvoiceStatus(ctx, invoice, mailsource.StatusApproving); err != nil {
+		t.Fatalf("failed to approve invoice again: %v", err)
+	}
+	retry, err := cfg.approvalJobForInvoice(ctx, invoice, nil)
+	if err != nil {
+		t.Fatalf("failed to create approval job: %v", err)
+	}
+	if retry.ID == job.ID {
+		t.Fatalf("expected a new approval job")
+	}
+	if _, err := cfg.runApprovalJob(ctx, retry); err != nil {
+		t.Fatalf("expected the new job to succeed, but got %v", err)
+	}
+	if status := getInvoiceStatus(t, cfg, invoice); status != mailsource.StatusApproved {
+		t.Errorf("expected the invoice approved, but it is %s", status)
+	}
+	checkDoneOnce(t, store, accounting, "a.pdf", "b.pdf")
+}
+
+func TestApprovalRetryDelay(t *testing.T) {
+	testCases := []struct {
+		name     string
+		attempts int64
+		expected time.Duration
+	}{
+		{name: "First Failure", attempts: 1, expected: 30 * time.Second},
+		{name: "Doubles", attempts: 3, expected: 2 * time.Minute},
+		{name: "Capped", attempts: 8, expected: time.Hour},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if delay := approvalRetryDelay(tc.attempts); delay != tc.expected {
+				t.Errorf("expected %s, but got %s", tc.expected, delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/googleauth"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// errNotAnExpense is returned for quotes and order confirmations, which aren't booked
+var errNotAnExpense = errors.New("document is not an expense")
+
+var errAlreadyApproved = errors.New("invoice is already approved")
+
+// approvalError says which step of an approval failed.
+type approvalError struct {
+	step string
+	err  error
+	// set when the approval worker will try again
+	retryAt time.Time
+}
+
+func (e *approvalError) Error() string {
+	return e.step + ": " + e.err.Error()
+}
+
+func (e *approvalError) Unwrap() error {
+	return e.err
+}
+
+// approveInvoice archives the selected attachments, or all of them, to S3, stages them
+// with the accounting service and marks the invoice approved, waiting for the first
+// attempt. Auto-approve rules go through here, manual approvals use startApproval.
+// Either way the work is an approval job, so when an attempt fails the approval worker
+// carries on where it stopped.
+func (cfg *apiConfig) approveInvoice(ctx context.Context, invoice database.StagedInvoice, attachmentIDs []string) ([]approvedFile, error) {
+	job, err := cfg.approvalJobForInvoice(ctx, invoice, attachmentIDs)
+	if err != nil {
+		return nil, &approvalError{step: "Failed to start approval", err: err}
+	}
+	return cfg.runApprovalJob(ctx, job)
+}
+
+func respondWithApprovalError(w http.ResponseWriter, err error) {
+	var issuesErr *approvalIssuesError
+	if errors.As(err, &issuesErr) {
+		respondWithJSON(w, http.StatusConflict, approvalIssuesResponse{
+			Error:  approvalIssuesMessage,
+			Issues: issuesErr.issues,
+		})
+		return
+	}
+	code, msg := invoiceActionError(err, "Failed to approve invoice")
+	respondWithError(w, code, msg, err)
+}
+
+// invoiceActionError picks the status code and message an approve or reject request
+// answers a failure with.
+func invoiceActionError(err error, fallback string) (int, string) {
+	var stepErr *approvalError
+	var transitionErr *statusTransitionError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, "Staged invoice not found"
+	case errors.Is(err, errUnknownAttachment):
+		return http.StatusBadRequest, "Unknown attachment selected"
+	case errors.Is(err, errNotAnExpense):
+		return http.StatusConflict, "Quotes and order confirmations can't be approved as expenses, reject them instead"
+	case errors.Is(err, errApprovalInProgress):
+		return http.StatusConflict, "Invoice is already being approved"
+	case errors.Is(err, errAlreadyApproved):
+		return http.StatusConflict, "Invoice is already approved"
+	case errors.As(err, &transitionErr):
+		if transitionErr.stale {
+			return http.StatusConflict, "Invoice was changed in the meantime, reload and try again"
+		}
+		return http.StatusConflict, fmt.Sprintf("A %s invoice can't become %s", strings.ReplaceAll(transitionErr.from, "_", " "), strings.ReplaceAll(transitionErr.to, "_", " "))
+	case errors.As(err, &stepErr):
+		msg := stepErr.step
+		if !stepErr.retryAt.IsZero() {
+			msg += ", retrying at " + stepErr.retryAt.Format(time.RFC3339)
+		}
+		fallback = msg
+	}
+	if errors.Is(err, googleauth.ErrReauthRequired) {
+		return http.StatusUnauthorized, "Google authorization expired, please log in again"
+	}
+	return http.StatusInternalServerError, fallback
+}
+
+// processQueuedApprovals carries out the auto-approve rules that matched the user's
+// newly staged invoices. Each invoice is claimed first so overlapping runs don't
+// approve it twice, and one that fails goes back to review, where its rule hit still
+// shows why it was queued.
+func (cfg *apiConfig) processQueuedApprovals(ctx context.Context, userID string) {
+	invoices, err := cfg.DB.ListStagedInvoicesByStatus(ctx, database.ListStagedInvoicesByStatusParams{
+		UserID: userID,
+		Status: mailsource.StatusApprovalQueued,
+	})
+	if err != nil {
+		log.Printf("Failed to list queued approvals for user ID %s: %v", userID, err)
+		return
+	}
+
+	for _, invoice := range invoices {
+		// extraction reads a batch per run, the rest stay queued until theirs comes
+		if _, err := cfg.DB.GetInvoiceFields(ctx, invoice.ID); err == sql.ErrNoRows {
+			log.Printf("Holding queued approval of invoice %s until its fields are read", invoice.ID)
+			continue
+		} else if err != nil {
+			log.Printf("Failed to load fields of queued invoice %s: %v", invoice.ID, err)
+			continue
+		}
+
+		claimed, err := cfg.DB.TransitionStagedInvoiceStatus(ctx, database.TransitionStagedInvoiceStatusParams{
+			Status:    mailsource.StatusApproving,
+			UpdatedAt: time.Now().Unix(),
+			ID:        invoice.ID,
+			UserID:    userID,
+			Status_2:  mailsource.StatusApprovalQueued,
+		})
+		if err != nil {
+			log.Printf("Failed to claim queued approval of invoice %s: %v", invoice.ID, err)
+			continue
+		}
+		if claimed == 0 {
+			continue
+		}
+		cfg.recordStatusChange(ctx, invoice.ID, automationActor, mailsource.StatusApprovalQueued, mailsource.StatusApproving, invoiceEvent{})
+
+		// rules can't accept issues on the user's behalf
+		issues, err := cfg.approvalIssues(ctx, invoice)
+		if err == nil && len(issues) > 0 {
+			err = &approvalIssuesError{issues: issues}
+		}
+		var files []approvedFile
+		if err == nil {
+			files, err = cfg.approveInvoice(ctx, invoice, nil)
+		}
+		if err == nil {
+			log.Printf("Auto-approved invoice %s from %s (%d files)", invoice.ID, invoice.Sender, len(files))
+			continue
+		}
+		var stepErr *approvalError
+		if errors.Is(err, errApprovalInProgress) || errors.As(err, &stepErr) && !stepErr.retryAt.IsZero() {
+			// stays approving until the worker's retries succeed or give up
+			continue
+		}
+
+		log.Printf("Failed to auto-approve invoice %s, returning it to review: %v", invoice.ID, err)
+		approveErr := err
+		returned, err := cfg.DB.TransitionStagedInvoiceStatus(ctx, database.TransitionStagedInvoiceStatusParams{
+			Status:    mailsource.StatusPendingReview,
+			UpdatedAt: time.Now().Unix(),
+			ID:        invoice.ID,
+			UserID:    userID,
+			Status_2:  mailsource.StatusApproving,
+		})
+		if err != nil {
+			log.Printf("Failed to return invoice %s to review: %v", invoice.ID, err)
+		}
+		if returned > 0 {
+			cfg.recordStatusChange(ctx, invoice.ID, automationActor, mailsource.StatusApproving, mailsource.StatusPendingReview, invoiceEvent{Error: approveErr.Error()})
+		}
+	}
+}
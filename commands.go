@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/classifier"
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/googleauth"
+	"github.com/felixsolom/fetch-duck/internal/tokencrypt"
+)
+
+func runCommand(ctx context.Context, args []string, cfg *apiConfig) error {
+	switch args[0] {
+	case "reencrypt-tokens":
+		return commandReencryptTokens(ctx, cfg.DB, cfg.Keyring)
+	case "import":
+		return cfg.commandImport(ctx, args[1:])
+	case "train-classifier":
+		return commandTrainClassifier(ctx, cfg.DB, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, available commands: reencrypt-tokens, import, train-classifier", args[0])
+	}
+}
+
+// commandTrainClassifier rebuilds a user's classifier from all of their decisions,
+// which the incremental updates after every decision otherwise never do:
+//
+//	fetch-duck train-classifier --user someone@example.com
+func commandTrainClassifier(ctx context.Context, db *database.Queries, args []string) error {
+	flags := flag.NewFlagSet("train-classifier", flag.ContinueOnError)
+	email := flags.String("user", "", "email of the user whose classifier to train")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return fmt.Errorf("usage: train-classifier --user <email>")
+	}
+
+	userID, err := userIDByEmail(ctx, db, *email)
+	if err != nil {
+		return err
+	}
+
+	model, err := classifier.Train(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Trained classifier for %s on %d approved and %d rejected invoices (%d features)",
+		*email, model.Approved, model.Rejected, len(model.Features))
+	return nil
+}
+
+// commandImport stages the invoices in an mbox archive or .eml file for a user:
+//
+//	fetch-duck import --user someone@example.com --mbox takeout.mbox
+func (cfg *apiConfig) commandImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	email := flags.String("user", "", "email of the user to stage the invoices for")
+	path := flags.String("mbox", "", "mbox archive or .eml file to import")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *path == "" {
+		return fmt.Errorf("usage: import --user <email> --mbox <file>")
+	}
+
+	userID, err := userIDByEmail(ctx, cfg.DB, *email)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stats, err := cfg.importMbox(ctx, userID, f)
+	if err != nil {
+		return err
+	}
+	if stats.LastError != "" {
+		log.Printf("Last import error: %s", stats.LastError)
+	}
+	// commands run without the accounting service
+	log.Printf("Invoices queued by auto-approve rules are approved after the user's next scan")
+	return nil
+}
+
+// commandReencryptTokens moves every stored Google token and IMAP password onto the
+// newest encryption key. Run it after adding a key to TOKEN_ENCRYPTION_KEYS and before
+// removing the old one.
+func commandReencryptTokens(ctx context.Context, db *database.Queries, keyring *tokencrypt.Keyring) error {
+	updated, err := googleauth.ReencryptTokens(ctx, db, keyring)
+	if err != nil {
+		return err
+	}
+	log.Printf("Re-encrypted tokens for %d users", updated)
+
+	rows, err := db.ListImapAccountPasswords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list IMAP accounts: %w", err)
+	}
+	updated = 0
+	for _, row := range rows {
+		if !keyring.NeedsRotation(row.Password) {
+			continue
+		}
+		password, err := keyring.Decrypt(row.Password, imapPasswordAAD(row.UserID))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt IMAP password for user ID %s: %w", row.UserID, err)
+		}
+		encrypted, err := keyring.Encrypt(password, imapPasswordAAD(row.UserID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt IMAP password for user ID %s: %w", row.UserID, err)
+		}
+		err = db.UpdateImapAccountPassword(ctx, database.UpdateImapAccountPasswordParams{
+			Password:  encrypted,
+			UpdatedAt: time.Now().Unix(),
+			UserID:    row.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update IMAP password for user ID %s: %w", row.UserID, err)
+		}
+		updated++
+	}
+	log.Printf("Re-encrypted IMAP passwords for %d users", updated)
+	return nil
+}
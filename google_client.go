@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/felixsolom/fetch-duck/internal/gmailservice"
+	"github.com/felixsolom/fetch-duck/internal/googleauth"
+	"golang.org/x/oauth2"
+)
+
+// gmailServiceForUser builds a Gmail client from the tokens stored in google_auths.
+// Refreshed tokens are written back as the client rotates them.
+func (cfg *apiConfig) gmailServiceForUser(ctx context.Context, userID string) (*gmailservice.Service, error) {
+	tokenSource, err := googleauth.NewDBTokenSource(ctx, cfg.GoogleConfig, cfg.DB, cfg.Keyring, userID)
+	if err != nil {
+		return nil, err
+	}
+	return gmailservice.New(oauth2.NewClient(context.Background(), tokenSource))
+}
+
+// respondWithGmailError tells the client to log in again when the stored Google
+// authorization is no longer accepted, and reports a server error otherwise.
+func respondWithGmailError(w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, googleauth.ErrReauthRequired) {
+		respondWithError(w, http.StatusUnauthorized, "Google authorization expired, please log in again", err)
+		return
+	}
+	respondWithError(w, http.StatusInternalServerError, msg, err)
+}
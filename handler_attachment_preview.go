@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/felixsolom/fetch-duck/internal/s3service"
+	"github.com/felixsolom/fetch-duck/internal/thumbnail"
+	"github.com/go-chi/chi/v5"
+)
+
+// longest side of a thumbnail in pixels
+const thumbnailSize = 320
+
+func (cfg *apiConfig) handlerGetInvoiceAttachment(w http.ResponseWriter, r *http.Request) {
+	invoice, attachment, ok := cfg.attachmentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// files we keep ourselves are passed through as they arrive
+	if key, ok := attachmentKey(invoice, attachment); ok {
+		body, size, err := cfg.S3.OpenFile(r.Context(), key)
+		if err != nil {
+			respondWithAttachmentError(w, err)
+			return
+		}
+		defer body.Close()
+
+		attachmentHeaders(w, attachment)
+		previewHeaders(w, size)
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("Failed to write attachment: %v", err)
+		}
+		return
+	}
+
+	// mailboxes hand attachments over whole, so these are held in memory for the
+	// request, bounded by the size of the message they came in
+	data, err := cfg.attachmentData(r.Context(), invoice, attachment)
+	if err != nil {
+		respondWithAttachmentError(w, err)
+		return
+	}
+	attachmentHeaders(w, attachment)
+	writePreview(w, data)
+}
+
+func attachmentHeaders(w http.ResponseWriter, attachment database.StagedAttachment) {
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+}
+
+// handlerGetAttachmentThumbnail serves a scaled down copy of an image attachment. The
+// first one made is kept in S3 so later requests don't download the original again.
+func (cfg *apiConfig) handlerGetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	invoice, attachment, ok := cfg.attachmentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !thumbnail.Supported(attachment.MimeType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Thumbnails are only available for JPEG, PNG and GIF images", nil)
+		return
+	}
+
+	key := fmt.Sprintf("thumbnails/%s/%s/%s.jpg", invoice.UserID, invoice.ID, attachment.ID)
+	thumb, err := cfg.S3.DownloadFile(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, s3service.ErrNotFound) {
+			log.Printf("Failed to read cached thumbnail %s, making a new one: %v", key, err)
+		}
+
+		data, err := cfg.attachmentData(r.Context(), invoice, attachment)
+		if err != nil {
+			respondWithAttachmentError(w, err)
+			return
+		}
+		thumb, err = thumbnail.Make(data, thumbnailSize)
+		if errors.Is(err, thumbnail.ErrUnsupported) {
+			respondWithError(w, http.StatusUnsupportedMediaType, "Attachment is not a readable image", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to make thumbnail", err)
+			return
+		}
+		if err := cfg.S3.UploadFile(r.Context(), key, thumb); err != nil {
+			log.Printf("Failed to cache thumbnail %s: %v", key, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	writePreview(w, thumb)
+}
+
+// attachmentFromRequest loads the attachment at position {n} of an invoice the user
+// owns, and responds itself when there isn't one.
+func (cfg *apiConfig) attachmentFromRequest(w http.ResponseWriter, r *http.Request) (database.StagedInvoice, database.StagedAttachment, bool) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return database.StagedInvoice{}, database.StagedAttachment{}, false
+	}
+
+	position, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || position < 0 {
+		respondWithError(w, http.StatusBadRequest, "Attachment number must be a non-negative integer", nil)
+		return database.StagedInvoice{}, database.StagedAttachment{}, false
+	}
+
+	invoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
+		ID:     chi.URLParam(r, "invoiceID"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Staged invoice not found", err)
+		return database.StagedInvoice{}, database.StagedAttachment{}, false
+	}
+
+	attachment, err := cfg.DB.GetStagedAttachmentByPosition(r.Context(), database.GetStagedAttachmentByPositionParams{
+		StagedInvoiceID: invoice.ID,
+		Position:        int64(position),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Attachment not found", err)
+		return database.StagedInvoice{}, database.StagedAttachment{}, false
+	}
+	return invoice, attachment, true
+}
+
+// attachmentKey returns the S3 key of an attachment we keep ourselves: an approved
+// one is read from its archive, the mailbox may have deleted it by now, and uploads
+// never were anywhere else.
+func attachmentKey(invoice database.StagedInvoice, attachment database.StagedAttachment) (string, bool) {
+	if invoice.Status == mailsource.StatusApproved && attachment.S3Key.Valid {
+		return attachment.S3Key.String, true
+	}
+	if invoice.Source == uploadSourceName {
+		return attachment.GmailPartID, true
+	}
+	return "", false
+}
+
+// attachmentData reads an attachment from S3 when we keep it, otherwise from the
+// mailbox it was staged from.
+func (cfg *apiConfig) attachmentData(ctx context.Context, invoice database.StagedInvoice, attachment database.StagedAttachment) ([]byte, error) {
+	if key, ok := attachmentKey(invoice, attachment); ok {
+		return cfg.S3.DownloadFile(ctx, key)
+	}
+
+	source, closeSource, err := cfg.mailSourceForInvoice(ctx, invoice)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSource()
+	return source.GetAttachment(ctx, invoice.GmailMessageID.String, attachment.GmailPartID)
+}
+
+func respondWithAttachmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, s3service.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Archived attachment is missing", err)
+		return
+	}
+	respondWithGmailError(w, "Failed to get attachment", err)
+}
+
+// writePreview sends a document for display in the browser. The sandbox keeps an XML
+// or HTML look-alike from running script on our origin.
+func writePreview(w http.ResponseWriter, data []byte) {
+	previewHeaders(w, int64(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Failed to write attachment: %v", err)
+	}
+}
+
+// previewHeaders are the headers of every preview, size is left out when it's unknown.
+func previewHeaders(w http.ResponseWriter, size int64) {
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+}
@@ -5,15 +5,34 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
 )
 
+type authStatusResponse struct {
+	database.User
+	NeedsReauth bool
+}
+
 func (cfg *apiConfig) handlerAuthStatus(w http.ResponseWriter, r *http.Request) {
 	user, ok := getUserFromContext(r)
 	if !ok {
 		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, user)
+
+	needsReauth := false
+	dbAuth, err := cfg.DB.GetGoogleAuthByUserID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to get google auth for user %s: %v", user.Email, err)
+	} else {
+		needsReauth = dbAuth.NeedsReauth
+	}
+
+	respondWithJSON(w, http.StatusOK, authStatusResponse{
+		User:        user,
+		NeedsReauth: needsReauth,
+	})
 }
 
 func (cfg *apiConfig) handlerLogout(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/felixsolom/fetch-duck/internal/invoicefields"
+)
+
+const (
+	// invoices handled at the same time by one bulk request
+	bulkConcurrency = 4
+	maxBulkInvoices = 200
+)
+
+type bulkPayload struct {
+	InvoiceIDs []string `json:"invoice_ids"`
+	// approve or reject
+	Action string `json:"action"`
+	// approve even though approvalIssues found something wrong
+	AcceptIssues bool `json:"accept_issues"`
+}
+
+// bulkResult is what the single approve or reject request would have answered for
+// the invoice, with its status code.
+type bulkResult struct {
+	InvoiceID string                `json:"invoice_id"`
+	Status    int                   `json:"status"`
+	JobID     string                `json:"job_id,omitempty"`
+	Error     string                `json:"error,omitempty"`
+	Issues    []invoicefields.Issue `json:"issues,omitempty"`
+}
+
+type bulkResponse struct {
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []bulkResult `json:"results"`
+}
+
+func (cfg *apiConfig) handlerBulkInvoiceAction(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	var payload bulkPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	if payload.Action != "approve" && payload.Action != "reject" {
+		respondWithError(w, http.StatusBadRequest, "action must be approve or reject", nil)
+		return
+	}
+	if len(payload.InvoiceIDs) == 0 || len(payload.InvoiceIDs) > maxBulkInvoices {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("invoice_ids must list between 1 and %d invoices", maxBulkInvoices), nil)
+		return
+	}
+
+	actor := requestActor(r, user)
+	invoiceIDs := uniqueIDs(payload.InvoiceIDs)
+
+	// results keep the order of the request
+	results := make([]bulkResult, len(invoiceIDs))
+	sem := make(chan struct{}, bulkConcurrency)
+	var wg sync.WaitGroup
+	for i, invoiceID := range invoiceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, invoiceID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := bulkResult{InvoiceID: invoiceID, Status: http.StatusOK}
+			var err error
+			if payload.Action == "approve" {
+				approval := approvePayload{AcceptIssues: payload.AcceptIssues}
+				job, approveErr := cfg.requestApproval(r.Context(), actor, invoiceID, approval)
+				result.Status, result.JobID, err = http.StatusAccepted, job.ID, approveErr
+			} else {
+				err = cfg.rejectInvoice(r.Context(), actor, invoiceID)
+			}
+			if err != nil {
+				result = bulkFailure(invoiceID, payload.Action, err)
+			}
+			results[i] = result
+		}(i, invoiceID)
+	}
+	wg.Wait()
+
+	response := bulkResponse{Results: results}
+	for _, result := range results {
+		if result.Status < 300 {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func bulkFailure(invoiceID, action string, err error) bulkResult {
+	result := bulkResult{InvoiceID: invoiceID}
+	var issuesErr *approvalIssuesError
+	if errors.As(err, &issuesErr) {
+		result.Status = http.StatusConflict
+		result.Error = approvalIssuesMessage
+		result.Issues = issuesErr.issues
+		return result
+	}
+	log.Printf("Bulk %s of invoice %s failed: %v", action, invoiceID, err)
+	result.Status, result.Error = invoiceActionError(err, "Failed to "+action+" invoice")
+	return result
+}
+
+// uniqueIDs drops repeated IDs, keeping the first of each, so an invoice listed twice
+// is acted on and reported once.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
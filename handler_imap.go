@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/imapservice"
+)
+
+// how long saving an account may spend checking the credentials
+const imapLoginTimeout = 15 * time.Second
+
+type imapAccountPayload struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Mailbox  string `json:"mailbox"`
+}
+
+// imapAccountResponse never includes the password.
+type imapAccountResponse struct {
+	Host      string `json:"host"`
+	Port      int64  `json:"port"`
+	Username  string `json:"username"`
+	Mailbox   string `json:"mailbox"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (cfg *apiConfig) handlerGetImapAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	account, err := cfg.DB.GetImapAccount(r.Context(), user.ID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "No IMAP account connected", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get IMAP account", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, imapAccountResponse{
+		Host:      account.Host,
+		Port:      account.Port,
+		Username:  account.Username,
+		Mailbox:   account.Mailbox,
+		UpdatedAt: account.UpdatedAt,
+	})
+}
+
+// handlerPutImapAccount checks the credentials by logging in before storing them.
+func (cfg *apiConfig) handlerPutImapAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	var payload imapAccountPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	payload.Host = strings.TrimSpace(payload.Host)
+	if payload.Port == 0 {
+		payload.Port = 993
+	}
+	if payload.Mailbox == "" {
+		payload.Mailbox = "INBOX"
+	}
+	if payload.Host == "" || payload.Username == "" || payload.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "host, username and password are required", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), imapLoginTimeout)
+	defer cancel()
+	client, err := imapservice.Dial(ctx, imapservice.Config{
+		Host:     payload.Host,
+		Port:     payload.Port,
+		Username: payload.Username,
+		Password: payload.Password,
+		Mailbox:  payload.Mailbox,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Could not log in to the IMAP server", err)
+		return
+	}
+	client.Close()
+
+	encrypted, err := cfg.Keyring.Encrypt(payload.Password, imapPasswordAAD(user.ID))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to encrypt IMAP password", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	err = cfg.DB.UpsertImapAccount(r.Context(), database.UpsertImapAccountParams{
+		UserID:    user.ID,
+		Host:      payload.Host,
+		Port:      int64(payload.Port),
+		Username:  payload.Username,
+		Password:  encrypted,
+		Mailbox:   payload.Mailbox,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save IMAP account", err)
+		return
+	}
+	log.Printf("User %s connected IMAP account %s on %s", user.Email, payload.Username, payload.Host)
+
+	respondWithJSON(w, http.StatusOK, imapAccountResponse{
+		Host:      payload.Host,
+		Port:      int64(payload.Port),
+		Username:  payload.Username,
+		Mailbox:   payload.Mailbox,
+		UpdatedAt: now,
+	})
+}
+
+func (cfg *apiConfig) handlerDeleteImapAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	if err := cfg.DB.DeleteImapAccount(r.Context(), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete IMAP account", err)
+		return
+	}
+	log.Printf("User %s disconnected their IMAP account", user.Email)
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "disconnected"})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/automation"
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// most rules a user may have, every staged message is checked against all of them
+const maxInvoiceRules = 100
+
+type invoiceRulePayload struct {
+	Name            string `json:"name"`
+	SenderDomain    string `json:"sender_domain"`
+	SubjectContains string `json:"subject_contains"`
+	Action          string `json:"action"`
+	Value           string `json:"value"`
+	// Position orders evaluation, new rules go last when it's omitted
+	Position *int64 `json:"position"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// rule validates the payload as an automation rule.
+func (p invoiceRulePayload) rule() (automation.Rule, error) {
+	rule := automation.Rule{
+		Name:            p.Name,
+		SenderDomain:    p.SenderDomain,
+		SubjectContains: p.SubjectContains,
+		Action:          p.Action,
+		Value:           p.Value,
+	}
+	err := rule.Validate()
+	return rule, err
+}
+
+func (cfg *apiConfig) handlerListInvoiceRules(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	rules, err := cfg.DB.ListInvoiceRulesByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list rules", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+func (cfg *apiConfig) handlerCreateInvoiceRule(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	var payload invoiceRulePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	rule, err := payload.rule()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	existing, err := cfg.DB.ListInvoiceRulesByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list rules", err)
+		return
+	}
+	if len(existing) >= maxInvoiceRules {
+		respondWithError(w, http.StatusBadRequest, "Too many rules", nil)
+		return
+	}
+
+	position := int64(0)
+	for _, e := range existing {
+		position = max(position, e.Position+1)
+	}
+	if payload.Position != nil {
+		position = *payload.Position
+	}
+	enabled := payload.Enabled == nil || *payload.Enabled
+
+	now := time.Now().Unix()
+	created, err := cfg.DB.CreateInvoiceRule(r.Context(), database.CreateInvoiceRuleParams{
+		ID:              uuid.New().String(),
+		UserID:          user.ID,
+		Name:            rule.Name,
+		Position:        position,
+		SenderDomain:    rule.SenderDomain,
+		SubjectContains: rule.SubjectContains,
+		Action:          rule.Action,
+		Value:           rule.Value,
+		Enabled:         enabled,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create rule", err)
+		return
+	}
+	log.Printf("User %s created rule %q (%s)", user.Email, created.Name, created.Action)
+	respondWithJSON(w, http.StatusCreated, created)
+}
+
+func (cfg *apiConfig) handlerUpdateInvoiceRule(w http.ResponseWriter, r *http.Request) {
+	ruleID := chi.URLParam(r, "ruleID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	var payload invoiceRulePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload", err)
+		return
+	}
+	if payload.Position == nil {
+		respondWithError(w, http.StatusBadRequest, "position is required", nil)
+		return
+	}
+	rule, err := payload.rule()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	updated, err := cfg.DB.UpdateInvoiceRule(r.Context(), database.UpdateInvoiceRuleParams{
+		Name:            rule.Name,
+		Position:        *payload.Position,
+		SenderDomain:    rule.SenderDomain,
+		SubjectContains: rule.SubjectContains,
+		Action:          rule.Action,
+		Value:           rule.Value,
+		Enabled:         payload.Enabled == nil || *payload.Enabled,
+		UpdatedAt:       time.Now().Unix(),
+		ID:              ruleID,
+		UserID:          user.ID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Rule not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update rule", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (cfg *apiConfig) handlerDeleteInvoiceRule(w http.ResponseWriter, r *http.Request) {
+	ruleID := chi.URLParam(r, "ruleID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteInvoiceRule(r.Context(), database.DeleteInvoiceRuleParams{
+		ID:     ruleID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete rule", err)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Rule not found", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// handlerListInvoiceRuleHits shows which rules acted on an invoice when it was staged.
+func (cfg *apiConfig) handlerListInvoiceRuleHits(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "invoiceID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Staged invoice not found", err)
+		return
+	}
+
+	hits, err := cfg.DB.ListInvoiceRuleHitsByInvoice(r.Context(), stagedInvoice.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list rule hits", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, hits)
+}
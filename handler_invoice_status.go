@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/go-chi/chi/v5"
+)
+
+// statusTransitionError is a status change the rules in mailsource.CanTransition don't
+// allow, or one that lost a race with another change to the same invoice.
+type statusTransitionError struct {
+	from  string
+	to    string
+	stale bool
+}
+
+func (e *statusTransitionError) Error() string {
+	if e.stale {
+		return fmt.Sprintf("invoice is no longer %s", e.from)
+	}
+	return fmt.Sprintf("invoice can't go from %s to %s", e.from, e.to)
+}
+
+// transitionInvoice moves the invoice on from the status it was loaded with and
+// records the change in its history.
+func (cfg *apiConfig) transitionInvoice(ctx context.Context, actor invoiceActor, invoice database.StagedInvoice, to string, event invoiceEvent) error {
+	if err := cfg.changeInvoiceStatus(ctx, invoice, to); err != nil {
+		return err
+	}
+	cfg.recordStatusChange(ctx, invoice.ID, actor, invoice.Status, to, event)
+	return nil
+}
+
+// changeInvoiceStatus is transitionInvoice without the history, for callers that
+// record the change themselves.
+func (cfg *apiConfig) changeInvoiceStatus(ctx context.Context, invoice database.StagedInvoice, to string) error {
+	if !mailsource.CanTransition(invoice.Status, to) {
+		return &statusTransitionError{from: invoice.Status, to: to}
+	}
+	changed, err := cfg.DB.TransitionStagedInvoiceStatus(ctx, database.TransitionStagedInvoiceStatusParams{
+		Status:    to,
+		UpdatedAt: time.Now().Unix(),
+		ID:        invoice.ID,
+		UserID:    invoice.UserID,
+		Status_2:  invoice.Status,
+	})
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return &statusTransitionError{from: invoice.Status, to: to, stale: true}
+	}
+	return nil
+}
+
+// handlerReopenInvoice puts a rejected invoice back up for review.
+func (cfg *apiConfig) handlerReopenInvoice(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "invoiceID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+	log.Printf("User %s is reopening invoice %s", user.Email, invoiceID)
+
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Staged invoice not found", err)
+		return
+	}
+	if stagedInvoice.Status != mailsource.StatusRejected {
+		respondWithError(w, http.StatusConflict, "Only rejected invoices can be reopened", nil)
+		return
+	}
+
+	err = cfg.transitionInvoice(r.Context(), requestActor(r, user), stagedInvoice, mailsource.StatusPendingReview, invoiceEvent{})
+	if err != nil {
+		code, msg := invoiceActionError(err, "Failed to reopen invoice")
+		respondWithError(w, code, msg, err)
+		return
+	}
+	cfg.forgetDecision(stagedInvoice)
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": mailsource.StatusPendingReview})
+}
+
+type revokeResponse struct {
+	Status        string   `json:"status"`
+	DeletedS3Keys []string `json:"deleted_s3_keys"`
+	// uploads can't be taken back through the accounting API, so this is false
+	// whenever something was uploaded and the files have to be removed there by hand
+	AccountingRolledBack bool     `json:"accounting_rolled_back"`
+	AccountingFiles      []string `json:"accounting_files"`
+	AccountingNote       string   `json:"accounting_note"`
+}
+
+// handlerRevokeApproval returns an approved invoice to review and deletes its S3
+// archive. The expenses staged with the accounting service stay behind, the response
+// lists them for the user to delete there.
+func (cfg *apiConfig) handlerRevokeApproval(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "invoiceID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+	log.Printf("User %s is revoking the approval of invoice %s", user.Email, invoiceID)
+
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Staged invoice not found", err)
+		return
+	}
+	if stagedInvoice.Status != mailsource.StatusApproved {
+		respondWithError(w, http.StatusConflict, "Only approved invoices can have their approval revoked", nil)
+		return
+	}
+
+	response := revokeResponse{
+		Status:          mailsource.StatusPendingReview,
+		DeletedS3Keys:   []string{},
+		AccountingFiles: []string{},
+	}
+	job, err := cfg.DB.GetLatestCompletedApprovalJobByInvoice(r.Context(), stagedInvoice.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		response.AccountingNote = "This invoice was approved before approvals were tracked, check the accounting service for its documents and delete them there"
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Failed to load approval", err)
+		return
+	default:
+		files, err := cfg.DB.ListApprovalJobFiles(r.Context(), job.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to load approval", err)
+			return
+		}
+		for _, file := range files {
+			if file.SubmittedAt.Valid {
+				response.AccountingFiles = append(response.AccountingFiles, file.Filename)
+			}
+		}
+		response.AccountingRolledBack = len(response.AccountingFiles) == 0
+		response.AccountingNote = "Nothing was uploaded to the accounting service"
+		if !response.AccountingRolledBack {
+			response.AccountingNote = "The accounting service can't remove uploaded documents through its API, delete the listed files there by hand"
+		}
+	}
+
+	// the status goes first, so an invoice whose archive is gone is never left approved
+	actor := requestActor(r, user)
+	err = cfg.transitionInvoice(r.Context(), actor, stagedInvoice, mailsource.StatusPendingReview, invoiceEvent{})
+	if err != nil {
+		code, msg := invoiceActionError(err, "Failed to revoke approval")
+		respondWithError(w, code, msg, err)
+		return
+	}
+	cfg.forgetDecision(stagedInvoice)
+
+	deleted, err := cfg.S3.DeletePrefix(r.Context(), fmt.Sprintf("invoices/%s/%s/", stagedInvoice.UserID, stagedInvoice.ID))
+	for _, key := range deleted {
+		cfg.recordInvoiceEvent(r.Context(), stagedInvoice.ID, actor, invoiceEvent{
+			Event: eventFileDeleted,
+			S3Key: key,
+		})
+	}
+	if err != nil {
+		// approving again uploads to the same keys, so what's left is overwritten then
+		respondWithError(w, http.StatusInternalServerError, "Approval was revoked, but deleting the archived files failed", err)
+		return
+	}
+	if err := cfg.DB.ClearStagedAttachmentS3Keys(r.Context(), stagedInvoice.ID); err != nil {
+		log.Printf("Failed to clear S3 keys of invoice %s attachments: %v", stagedInvoice.ID, err)
+	}
+	response.DeletedS3Keys = append(response.DeletedS3Keys, deleted...)
+	respondWithJSON(w, http.StatusOK, response)
+}
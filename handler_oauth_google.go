@@ -9,19 +9,21 @@ import (
 	"time"
 
 	"github.com/felixsolom/fetch-duck/internal/database"
-	"github.com/felixsolom/fetch-duck/internal/gmailservice"
 	"github.com/felixsolom/fetch-duck/internal/googleauth"
+	"golang.org/x/oauth2"
 )
 
 func (cfg *apiConfig) handlerOAuthGoogleLogin(w http.ResponseWriter, r *http.Request) {
+	// logged in users may come back here to re-authorize Gmail access
 	_, err := r.Cookie("pre_auth_token")
-	if err != nil {
+	if err != nil && !cfg.hasValidSession(r) {
 		respondWithError(w, http.StatusUnauthorized, "Access denied", err)
 		return
 	}
 
 	state := googleauth.GenerateOauthStateString(w, r)
-	url := cfg.GoogleConfig.AuthCodeURL(state)
+	// offline access with forced consent makes Google hand out a refresh token on every login
+	url := cfg.GoogleConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
@@ -50,7 +52,7 @@ func (cfg *apiConfig) handlerOAuthGoogleCallback(w http.ResponseWriter, r *http.
 		return
 	}
 
-	userID, err := googleauth.StoreTokenInDB(context.Background(), cfg.DB, userInfo, token)
+	userID, err := googleauth.StoreTokenInDB(context.Background(), cfg.DB, cfg.Keyring, userInfo, token)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to store token", err)
 		return
@@ -89,19 +91,13 @@ func (cfg *apiConfig) handlerOAuthGoogleCallback(w http.ResponseWriter, r *http.
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	go func() {
-		log.Println("Authentication successfull. Starting background scan and stage process...")
-		gmailService, err := gmailservice.New(client)
-		if err != nil {
-			log.Printf("Error creating gmail service: %v", err)
-			return
-		}
-		err = gmailService.ScanAndStageInvoices(context.Background(), cfg.DB, userID)
-		if err != nil {
-			log.Printf("Error scanning and staging invoices: %v", err)
-			return
-		}
-	}()
+	log.Println("Authentication successfull. Starting background scan and stage process...")
+	scanners, err := cfg.scannersForUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error connecting to mailboxes: %v", err)
+	} else if _, err := cfg.startScanJob(r.Context(), userID, scanners); err != nil {
+		log.Printf("Error starting scan: %v", err)
+	}
 
 	http.Redirect(w, r, "/api/v1/auth/success", http.StatusSeeOther)
 }
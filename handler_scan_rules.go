@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/imapservice"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// how many messages a dry run looks at per mailbox unless asked otherwise
+const (
+	defaultDryRunLimit = 25
+	maxDryRunLimit     = 100
+)
+
+type scanRulesResponse struct {
+	mailsource.Rules
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+type dryRunMessage struct {
+	Source        string `json:"source"`
+	MessageID     string `json:"message_id"`
+	Sender        string `json:"sender"`
+	Subject       string `json:"subject"`
+	Snippet       string `json:"snippet"`
+	HasAttachment bool   `json:"has_attachment"`
+	ReceivedAt    int64  `json:"received_at"`
+	Score         int    `json:"score"`
+	Status        string `json:"status"`
+	Suggestion    string `json:"suggestion,omitempty"`
+	AlreadyStaged bool   `json:"already_staged"`
+}
+
+type dryRunResponse struct {
+	Messages []dryRunMessage `json:"messages"`
+	// Errors holds the mailboxes that couldn't be searched, keyed by source
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// scanRulesForUser returns the user's rules, or the defaults when they never saved any.
+func (cfg *apiConfig) scanRulesForUser(ctx context.Context, userID string) (scanRulesResponse, error) {
+	row, err := cfg.DB.GetScanRules(ctx, userID)
+	if err == sql.ErrNoRows {
+		return scanRulesResponse{Rules: mailsource.DefaultRules()}, nil
+	}
+	if err != nil {
+		return scanRulesResponse{}, err
+	}
+
+	rules := mailsource.Rules{
+		UseDefaultKeywords: row.UseDefaultKeywords,
+		DateFloor:          row.DateFloor.String,
+		MinScore:           int(row.MinScore),
+	}
+	lists := []struct {
+		raw    string
+		values *[]string
+	}{
+		{row.IncludeKeywords, &rules.IncludeKeywords},
+		{row.AllowedSenders, &rules.AllowedSenders},
+		{row.BlockedSenders, &rules.BlockedSenders},
+		{row.IncludeLabels, &rules.IncludeLabels},
+		{row.ExcludeLabels, &rules.ExcludeLabels},
+	}
+	for _, list := range lists {
+		if err := json.Unmarshal([]byte(list.raw), list.values); err != nil {
+			return scanRulesResponse{}, fmt.Errorf("failed to decode scan rules: %w", err)
+		}
+	}
+	return scanRulesResponse{Rules: rules, UpdatedAt: row.UpdatedAt}, nil
+}
+
+// scanCriteriaForUser is what every scan of the user's mailboxes searches for.
+func (cfg *apiConfig) scanCriteriaForUser(ctx context.Context, userID string) (mailsource.SearchCriteria, error) {
+	rules, err := cfg.scanRulesForUser(ctx, userID)
+	if err != nil {
+		return mailsource.SearchCriteria{}, err
+	}
+	return rules.Criteria(), nil
+}
+
+func (cfg *apiConfig) handlerGetScanRules(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	rules, err := cfg.scanRulesForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get scan rules", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+// handlerPutScanRules replaces the user's rules. The Gmail history cursor is dropped so
+// the next scan searches the whole mailbox with the new rules instead of only new mail.
+func (cfg *apiConfig) handlerPutScanRules(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	rules, err := decodeScanRules(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	encoded := make([]string, 5)
+	for i, values := range [][]string{
+		rules.IncludeKeywords,
+		rules.AllowedSenders,
+		rules.BlockedSenders,
+		rules.IncludeLabels,
+		rules.ExcludeLabels,
+	} {
+		data, err := json.Marshal(values)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to encode scan rules", err)
+			return
+		}
+		encoded[i] = string(data)
+	}
+
+	now := time.Now().Unix()
+	err = cfg.DB.UpsertScanRules(r.Context(), database.UpsertScanRulesParams{
+		UserID:             user.ID,
+		UseDefaultKeywords: rules.UseDefaultKeywords,
+		IncludeKeywords:    encoded[0],
+		AllowedSenders:     encoded[1],
+		BlockedSenders:     encoded[2],
+		IncludeLabels:      encoded[3],
+		ExcludeLabels:      encoded[4],
+		DateFloor:          toNullString(rules.DateFloor),
+		MinScore:           int64(rules.MinScore),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to save scan rules", err)
+		return
+	}
+
+	if err := cfg.DB.DeleteGmailSyncState(r.Context(), user.ID); err != nil {
+		log.Printf("Failed to reset Gmail sync state for user ID %s: %v", user.ID, err)
+	}
+	log.Printf("User %s updated their scan rules", user.Email)
+
+	respondWithJSON(w, http.StatusOK, scanRulesResponse{Rules: rules, UpdatedAt: now})
+}
+
+// handlerDryRunScanRules searches every connected mailbox with the rules in the body, or
+// the saved rules when the body is empty, and lists what a scan would stage. Nothing
+// is written.
+func (cfg *apiConfig) handlerDryRunScanRules(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	limit := defaultDryRunLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDryRunLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxDryRunLimit), err)
+			return
+		}
+		limit = n
+	}
+
+	var rules mailsource.Rules
+	if r.ContentLength == 0 {
+		saved, err := cfg.scanRulesForUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to get scan rules", err)
+			return
+		}
+		rules = saved.Rules
+	} else {
+		decoded, err := decodeScanRules(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		rules = decoded
+	}
+	criteria := rules.Criteria()
+
+	sources, closeSources, err := cfg.mailSourcesForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithGmailError(w, "Failed to connect to mailboxes", err)
+		return
+	}
+	defer closeSources()
+
+	assessor, err := mailsource.NewAssessor(r.Context(), cfg.DB, user.ID, criteria.MinScore)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to load sender history", err)
+		return
+	}
+
+	response := dryRunResponse{Messages: []dryRunMessage{}}
+	for _, source := range sources {
+		messages, err := cfg.dryRunSource(r.Context(), user.ID, source, criteria, assessor, limit)
+		if err != nil {
+			log.Printf("Dry run of %s for user %s failed: %v", source.Name(), user.Email, err)
+			if response.Errors == nil {
+				response.Errors = make(map[string]string)
+			}
+			response.Errors[source.Name()] = err.Error()
+		}
+		response.Messages = append(response.Messages, messages...)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) dryRunSource(ctx context.Context, userID string, source mailsource.MailSource, criteria mailsource.SearchCriteria, assessor *mailsource.Assessor, limit int) ([]dryRunMessage, error) {
+	stagedIDs, err := cfg.DB.ListStagedMessageIDsByUser(ctx, database.ListStagedMessageIDsByUserParams{
+		UserID: userID,
+		Source: source.Name(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged messages: %w", err)
+	}
+	staged := make(map[string]bool, len(stagedIDs))
+	for _, id := range stagedIDs {
+		staged[id.String] = true
+	}
+
+	messageIDs, err := source.Search(ctx, criteria, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []dryRunMessage
+	for _, messageID := range messageIDs {
+		msg, err := source.GetMetadata(ctx, messageID)
+		if err != nil {
+			return messages, fmt.Errorf("failed to get message %s: %w", messageID, err)
+		}
+		assessment := assessor.Assess(msg)
+		messages = append(messages, dryRunMessage{
+			Source:        source.Name(),
+			MessageID:     msg.ID,
+			Sender:        msg.From,
+			Subject:       msg.Subject,
+			Snippet:       msg.Snippet,
+			HasAttachment: len(msg.Attachments) > 0,
+			ReceivedAt:    msg.ReceivedAt.Unix(),
+			Score:         assessment.Score,
+			Status:        assessment.Status,
+			Suggestion:    assessment.Suggestion,
+			AlreadyStaged: staged[msg.ID],
+		})
+	}
+	return messages, nil
+}
+
+func decodeScanRules(r *http.Request) (mailsource.Rules, error) {
+	rules := mailsource.DefaultRules()
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		return mailsource.Rules{}, fmt.Errorf("Invalid request payload")
+	}
+	if err := rules.Normalize(); err != nil {
+		return mailsource.Rules{}, err
+	}
+	return rules, nil
+}
+
+// mailSourcesForUser connects to every mailbox the user can scan, like scannersForUser.
+func (cfg *apiConfig) mailSourcesForUser(ctx context.Context, userID string) ([]mailsource.MailSource, func(), error) {
+	var sources []mailsource.MailSource
+	closeFunc := func() {}
+
+	gmailService, gmailErr := cfg.gmailServiceForUser(ctx, userID)
+	if gmailErr == nil {
+		sources = append(sources, gmailService)
+	}
+
+	imapConfig, err := cfg.imapConfigForUser(ctx, userID)
+	if err == nil {
+		client, err := imapservice.Dial(ctx, imapConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, client)
+		closeFunc = func() { client.Close() }
+	} else if err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	if len(sources) == 0 {
+		return nil, nil, gmailErr
+	}
+	return sources, closeFunc, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var errScanInProgress = errors.New("a scan is already running")
+
+func (cfg *apiConfig) handlerStartScan(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	runningJob, err := cfg.DB.GetRunningScanJobByUser(r.Context(), user.ID)
+	if err == nil {
+		respondWithJSON(w, http.StatusConflict, runningJob)
+		return
+	}
+	if err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Failed to check for running scans", err)
+		return
+	}
+
+	scanners, err := cfg.scannersForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithGmailError(w, "Failed to connect to mailboxes", err)
+		return
+	}
+
+	job, err := cfg.startScanJob(r.Context(), user.ID, scanners)
+	if errors.Is(err, errScanInProgress) {
+		// another request started its scan in between
+		runningJob, err = cfg.DB.GetRunningScanJobByUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusConflict, "A scan is already running", err)
+			return
+		}
+		respondWithJSON(w, http.StatusConflict, runningJob)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start scan", err)
+		return
+	}
+	log.Printf("User %s started scan %s", user.Email, job.ID)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+func (cfg *apiConfig) handlerGetScan(w http.ResponseWriter, r *http.Request) {
+	scanID := chi.URLParam(r, "scanID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	job, err := cfg.DB.GetScanJob(r.Context(), database.GetScanJobParams{
+		ID:     scanID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Scan not found", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// startScanJob records a new scan job and runs it in the background.
+func (cfg *apiConfig) startScanJob(ctx context.Context, userID string, scanners []mailsource.Scanner) (database.ScanJob, error) {
+	job, err := cfg.createScanJob(ctx, userID)
+	if err != nil {
+		return database.ScanJob{}, err
+	}
+
+	go cfg.runScanJob(job.ID, userID, scanners)
+	return job, nil
+}
+
+// createScanJob returns errScanInProgress when the user already has a scan running,
+// the database allows only one.
+func (cfg *apiConfig) createScanJob(ctx context.Context, userID string) (database.ScanJob, error) {
+	now := time.Now().Unix()
+	job, err := cfg.DB.CreateScanJob(ctx, database.CreateScanJobParams{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		StartedAt: now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if isUniqueViolation(err) {
+		return database.ScanJob{}, errScanInProgress
+	}
+	return job, err
+}
+
+// isUniqueViolation is true when err is a write refused by a unique index. Neither
+// driver exports a typed error for it.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// runScanJob scans the mailboxes one after another. A failing mailbox fails the job
+// but doesn't stop the others from being scanned.
+func (cfg *apiConfig) runScanJob(jobID, userID string, scanners []mailsource.Scanner) {
+	ctx := context.Background()
+	log.Printf("Starting scan %s for user ID %s", jobID, userID)
+
+	criteria, rulesErr := cfg.scanCriteriaForUser(ctx, userID)
+	if rulesErr != nil {
+		log.Printf("Failed to load scan rules for user ID %s, using defaults: %v", userID, rulesErr)
+		criteria = mailsource.InvoiceCriteria
+	}
+
+	var stats mailsource.ScanStats
+	var err error
+	for _, scanner := range scanners {
+		done := stats
+		scannerStats, scanErr := scanner.ScanAndStageInvoices(ctx, cfg.DB, userID, criteria, func(progress mailsource.ScanStats) {
+			total := done.Add(progress)
+			err := cfg.DB.UpdateScanJobProgress(ctx, database.UpdateScanJobProgressParams{
+				MessagesSeen:    total.Seen,
+				MessagesStaged:  total.Staged,
+				MessagesSkipped: total.Skipped,
+				MessagesFailed:  total.Failed,
+				LastError:       toNullString(total.LastError),
+				UpdatedAt:       time.Now().Unix(),
+				ID:              jobID,
+			})
+			if err != nil {
+				log.Printf("Failed to update progress of scan %s: %v", jobID, err)
+			}
+		})
+		stats = stats.Add(scannerStats)
+		if scanErr != nil {
+			err = scanErr
+		}
+	}
+
+	status := "completed"
+	lastError := stats.LastError
+	if err != nil {
+		log.Printf("Error scanning and staging invoices: %v", err)
+		status = "failed"
+		lastError = err.Error()
+	}
+
+	now := time.Now().Unix()
+	err = cfg.DB.FinishScanJob(ctx, database.FinishScanJobParams{
+		Status:          status,
+		MessagesSeen:    stats.Seen,
+		MessagesStaged:  stats.Staged,
+		MessagesSkipped: stats.Skipped,
+		MessagesFailed:  stats.Failed,
+		LastError:       toNullString(lastError),
+		FinishedAt:      sql.NullInt64{Int64: now, Valid: true},
+		UpdatedAt:       now,
+		ID:              jobID,
+	})
+	if err != nil {
+		log.Printf("Failed to finish scan %s: %v", jobID, err)
+		return
+	}
+	log.Printf("Scan %s %s: %d seen, %d staged, %d skipped, %d failed",
+		jobID, status, stats.Seen, stats.Staged, stats.Skipped, stats.Failed)
+
+	cfg.processNewInvoices(ctx, userID)
+}
+
+func toNullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
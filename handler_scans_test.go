@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+)
+
+func TestCreateScanJobOneRunning(t *testing.T) {
+	ctx := context.Background()
+	cfg, _, _ := newTestConfig(t)
+	now := time.Now().Unix()
+	if err := cfg.DB.CreateUser(ctx, database.CreateUserParams{ID: "user-1", Email: "user@example.com", CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	job, err := cfg.createScanJob(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("failed to create scan job: %v", err)
+	}
+	if _, err := cfg.createScanJob(ctx, "user-1"); !errors.Is(err, errScanInProgress) {
+		t.Errorf("expected errScanInProgress, but got %v", err)
+	}
+
+	err = cfg.DB.FinishScanJob(ctx, database.FinishScanJobParams{Status: "completed", UpdatedAt: now, ID: job.ID})
+	if err != nil {
+		t.Fatalf("failed to finish scan job: %v", err)
+	}
+	if _, err := cfg.createScanJob(ctx, "user-1"); err != nil {
+		t.Errorf("expected a new scan once the last one finished, but got %v", err)
+	}
+}
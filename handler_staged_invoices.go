@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
+	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/felixsolom/fetch-duck/internal/classifier"
 	"github.com/felixsolom/fetch-duck/internal/database"
-	"github.com/felixsolom/fetch-duck/internal/gmailservice"
+	"github.com/felixsolom/fetch-duck/internal/doctype"
+	"github.com/felixsolom/fetch-duck/internal/invoicefields"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
 	"github.com/go-chi/chi/v5"
-	"golang.org/x/oauth2"
 )
 
 func (cfg *apiConfig) handlerListStagedInvoices(w http.ResponseWriter, r *http.Request) {
@@ -34,35 +38,84 @@ func (cfg *apiConfig) handlerListStagedInvoices(w http.ResponseWriter, r *http.R
 		offset = 0
 	}
 
+	//pending_review by default, low_confidence lists what scored below the threshold,
+	//rejected and approved what can be reopened or revoked
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = mailsource.StatusPendingReview
+	}
+	switch status {
+	case mailsource.StatusPendingReview, mailsource.StatusLowConfidence, mailsource.StatusRejected, mailsource.StatusApproved:
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be pending_review, low_confidence, rejected or approved", nil)
+		return
+	}
+
 	now := time.Now()
 	oneYearAgo := now.AddDate(-1, 0, 0)
 
 	params := database.ListStagedInvoicesByUserParams{
 		UserID:       user.ID,
+		Status:       status,
 		ReceivedAt:   oneYearAgo.Unix(),
 		ReceivedAt_2: now.Unix(),
 		Limit:        int64(limit),
 		Offset:       int64(offset),
 	}
 
-	invoices, err := cfg.DB.ListStagedInvoicesByUser(context.Background(), params)
+	var invoices []database.StagedInvoice
+	switch r.URL.Query().Get("sort") {
+	case "", "received_at":
+		invoices, err = cfg.DB.ListStagedInvoicesByUser(context.Background(), params)
+	case "score":
+		invoices, err = cfg.DB.ListStagedInvoicesByUserByScore(context.Background(), database.ListStagedInvoicesByUserByScoreParams(params))
+	default:
+		respondWithError(w, http.StatusBadRequest, "sort must be received_at or score", nil)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to list staged invoices", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, invoices)
+
+	fieldRows, err := cfg.DB.ListInvoiceFieldsByUserStatus(r.Context(), database.ListInvoiceFieldsByUserStatusParams{
+		UserID: user.ID,
+		Status: status,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list invoice fields", err)
+		return
+	}
+	fields := make(map[string]database.InvoiceField, len(fieldRows))
+	for _, row := range fieldRows {
+		fields[row.StagedInvoiceID] = row
+	}
+
+	var response []stagedInvoiceResponse
+	for _, invoice := range invoices {
+		item := stagedInvoiceResponse{StagedInvoice: invoice}
+		if row, ok := fields[invoice.ID]; ok {
+			item.Fields = invoiceFieldsResponseFromRow(row, invoice)
+		}
+		response = append(response, item)
+	}
+	respondWithJSON(w, http.StatusOK, response)
 }
 
-func (cfg *apiConfig) handlerApproveInvoice(w http.ResponseWriter, r *http.Request) {
+// stagedInvoiceResponse is a list entry, fields stay null until the attachments were read
+type stagedInvoiceResponse struct {
+	database.StagedInvoice
+	Fields *invoiceFieldsResponse `json:"fields"`
+}
+
+func (cfg *apiConfig) handlerListInvoiceAttachments(w http.ResponseWriter, r *http.Request) {
 	invoiceID := chi.URLParam(r, "invoiceID")
 	user, ok := getUserFromContext(r)
 	if !ok {
 		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
 		return
 	}
-	log.Printf("User %s is approving invoice %s", user.Email, invoiceID)
 
-	//staged invoice details for db
 	stagedInvoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
 		ID:     invoiceID,
 		UserID: user.ID,
@@ -72,68 +125,155 @@ func (cfg *apiConfig) handlerApproveInvoice(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	//google auth token from google_auths table
-	dbAuth, err := cfg.DB.GetGoogleAuthByUserID(r.Context(), user.ID)
+	attachments, err := cfg.DB.ListStagedAttachmentsByInvoice(r.Context(), stagedInvoice.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't get auth token for user", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list attachments", err)
 		return
 	}
+	respondWithJSON(w, http.StatusOK, attachments)
+}
+
+type approvePayload struct {
+	// staged attachment IDs to archive and upload, empty means all of them
+	AttachmentIDs []string `json:"attachment_ids"`
+	// approve even though approvalIssues found something wrong
+	AcceptIssues bool `json:"accept_issues"`
+}
+
+type approvedFile struct {
+	Filename string `json:"filename"`
+	S3Key    string `json:"s3_key"`
+}
 
-	//auth client now
-	token := &oauth2.Token{
-		AccessToken:  dbAuth.AccessToken,
-		RefreshToken: dbAuth.RefreshToken,
-		Expiry:       time.Unix(dbAuth.TokenExpiry, 1000),
-		TokenType:    "Bearer",
+// approvalJobResponse is a job with its files, which are known once they were fetched
+type approvalJobResponse struct {
+	database.ApprovalJob
+	Files []database.ApprovalJobFile `json:"files"`
+}
+
+func (cfg *apiConfig) handlerApproveInvoice(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "invoiceID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
 	}
-	client := cfg.GoogleConfig.Client(context.Background(), token)
-	gmailService, err := gmailservice.New(client)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create gmail service", err)
+
+	var payload approvePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload", err)
 		return
 	}
 
-	//now the attachment
-	attachmentData, filename, err := gmailService.GetFirstAttachment(stagedInvoice.GmailMessageID)
+	job, err := cfg.requestApproval(r.Context(), requestActor(r, user), invoiceID, payload)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to get attachment from gmail", err)
+		respondWithApprovalError(w, err)
 		return
 	}
 
-	//S3 block bucket upload
-	s3key := fmt.Sprintf("invoices/%s/%s/%s", user.ID, stagedInvoice.ID, filename)
-	err = cfg.S3.UploadFile(r.Context(), s3key, attachmentData)
+	w.Header().Set("Location", "/api/v1/approvals/"+job.ID)
+	respondWithJSON(w, http.StatusAccepted, approvalJobResponse{
+		ApprovalJob: job,
+		Files:       []database.ApprovalJobFile{},
+	})
+}
+
+// requestApproval checks that the user's invoice can be approved and starts its
+// approval job.
+func (cfg *apiConfig) requestApproval(ctx context.Context, actor invoiceActor, invoiceID string, payload approvePayload) (database.ApprovalJob, error) {
+	user := actor.User
+	log.Printf("User %s is approving invoice %s", user.Email, invoiceID)
+
+	//staged invoice details for db
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(ctx, database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to upload file to S3", err)
+		return database.ApprovalJob{}, err
+	}
+
+	if stagedInvoice.Status == mailsource.StatusApproved {
+		return database.ApprovalJob{}, errAlreadyApproved
+	}
+
+	if !payload.AcceptIssues {
+		issues, err := cfg.approvalIssues(ctx, stagedInvoice)
+		if err != nil {
+			return database.ApprovalJob{}, &approvalError{step: "Failed to check invoice", err: err}
+		}
+		if len(issues) > 0 {
+			return database.ApprovalJob{}, &approvalIssuesError{issues: issues}
+		}
+	}
+
+	// the classifier learns the approval once its job succeeds
+	return cfg.startApproval(ctx, actor, stagedInvoice, payload.AttachmentIDs)
+}
+
+func (cfg *apiConfig) handlerGetApproval(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
 		return
 	}
-	log.Printf("Successfully uploaded invoice to S3 at key: %s", s3key)
 
-	//Green Invoice uplaod logic
-	log.Printf("Staging file %s with accountig services...", filename)
-	err = cfg.Accounting.StagedInvoiceFile(r.Context(), filename, attachmentData)
+	job, err := cfg.DB.GetApprovalJob(r.Context(), database.GetApprovalJobParams{
+		ID:     jobID,
+		UserID: user.ID,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to stage invoice with accounting service", err)
+		respondWithError(w, http.StatusNotFound, "Approval not found", err)
 		return
 	}
 
-	err = cfg.DB.UpdateStagedInvoiceStatus(r.Context(), database.UpdateStagedInvoiceStatusParams{
-		ID:        invoiceID,
-		UserID:    user.ID,
-		Status:    "approved",
-		UpdatedAt: time.Now().Unix(),
-	})
+	files, err := cfg.DB.ListApprovalJobFiles(r.Context(), job.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to approve invoice", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list approval files", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"status":   "approved",
-		"filename": filename,
-		"s3_key":   s3key,
+	if files == nil {
+		files = []database.ApprovalJobFile{}
+	}
+	respondWithJSON(w, http.StatusOK, approvalJobResponse{
+		ApprovalJob: job,
+		Files:       files,
 	})
 }
 
+const approvalIssuesMessage = "Invoice needs review before approval, resend with accept_issues to approve anyway"
+
+type approvalIssuesResponse struct {
+	Error  string                `json:"error"`
+	Issues []invoicefields.Issue `json:"issues"`
+}
+
+// approvalIssuesError holds an approval back until the user accepts the issues.
+type approvalIssuesError struct {
+	issues []invoicefields.Issue
+}
+
+func (e *approvalIssuesError) Error() string {
+	return "invoice needs review: " + e.issues[0].Message
+}
+
+// approvalIssues checks the fields read from the invoice for what would get its VAT
+// deduction rejected, most importantly a missing allocation number on an invoice
+// above the threshold. An invoice whose fields haven't been read yet can't be checked,
+// which is an issue of its own.
+func (cfg *apiConfig) approvalIssues(ctx context.Context, invoice database.StagedInvoice) ([]invoicefields.Issue, error) {
+	row, err := cfg.DB.GetInvoiceFields(ctx, invoice.ID)
+	if err == sql.ErrNoRows {
+		return []invoicefields.Issue{invoicefields.NotExtracted}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := fieldsFromRow(row)
+	return invoicefields.Check(fields, issueDate(fields, invoice), doctype.NeedsAllocationNumber(invoice.DocumentType.String)), nil
+}
+
 func (cfg *apiConfig) handlerRejectInvoice(w http.ResponseWriter, r *http.Request) {
 	invoiceID := chi.URLParam(r, "invoiceID")
 	user, ok := getUserFromContext(r)
@@ -141,17 +281,61 @@ func (cfg *apiConfig) handlerRejectInvoice(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
 		return
 	}
+
+	if err := cfg.rejectInvoice(r.Context(), requestActor(r, user), invoiceID); err != nil {
+		code, msg := invoiceActionError(err, "Failed to reject invoice")
+		respondWithError(w, code, msg, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": mailsource.StatusRejected})
+}
+
+func (cfg *apiConfig) rejectInvoice(ctx context.Context, actor invoiceActor, invoiceID string) error {
+	user := actor.User
 	log.Printf("User %s is rejecting invoice %s", user.Email, invoiceID)
 
-	err := cfg.DB.UpdateStagedInvoiceStatus(r.Context(), database.UpdateStagedInvoiceStatusParams{
-		ID:        invoiceID,
-		UserID:    user.ID,
-		Status:    "rejected",
-		UpdatedAt: time.Now().Unix(),
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(ctx, database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to reject invoice", err)
+		return err
+	}
+
+	err = cfg.transitionInvoice(ctx, actor, stagedInvoice, mailsource.StatusRejected, invoiceEvent{})
+	if err != nil {
+		return err
+	}
+	cfg.learnDecision(stagedInvoice, mailsource.StatusRejected)
+	return nil
+}
+
+// learnDecision teaches the user's classifier about a decision in the background, a
+// failure only costs the model one example. invoice is the row from before the
+// decision, deciding the same way twice is learned once.
+func (cfg *apiConfig) learnDecision(invoice database.StagedInvoice, status string) {
+	if invoice.Status == status {
 		return
 	}
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "rejected"})
+	invoice.Status = status
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := classifier.Learn(ctx, cfg.DB, invoice, status == mailsource.StatusApproved); err != nil {
+			log.Printf("Failed to learn %s decision on invoice %s: %v", status, invoice.ID, err)
+		}
+	}()
+}
+
+// forgetDecision takes back a decision that was reopened or revoked by retraining the
+// model from the decisions that still stand.
+func (cfg *apiConfig) forgetDecision(invoice database.StagedInvoice) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, err := classifier.Train(ctx, cfg.DB, invoice.UserID); err != nil {
+			log.Printf("Failed to forget %s decision on invoice %s: %v", invoice.Status, invoice.ID, err)
+		}
+	}()
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailparse"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/google/uuid"
+)
+
+// largest request accepted for document uploads, all files together
+const maxUploadSize = 25 << 20
+
+type uploadedFile struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+// handlerUploadInvoice stages documents that never arrived by email. Every "file" part
+// of the multipart form becomes an attachment of one staged invoice, an optional
+// "subject" field names it.
+func (cfg *apiConfig) handlerUploadInvoice(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload, expected multipart form data up to 25 MB", err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	fileHeaders := r.MultipartForm.File["file"]
+	if len(fileHeaders) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No file uploaded", nil)
+		return
+	}
+
+	files := make([]uploadedFile, 0, len(fileHeaders))
+	for _, fileHeader := range fileHeaders {
+		file, err := readUploadedFile(fileHeader)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		files = append(files, file)
+	}
+
+	subject := strings.TrimSpace(r.FormValue("subject"))
+	if subject == "" {
+		subject = files[0].Filename
+	}
+
+	// files are stored before the invoice is staged so it never points at missing
+	// objects, a failure on the way takes back what was done so far
+	invoiceID := uuid.New().String()
+	prefix := fmt.Sprintf("uploads/%s/%s/", user.ID, invoiceID)
+	staged := false
+	discard := func() {
+		ctx := context.WithoutCancel(r.Context())
+		if staged {
+			err := cfg.DB.DeleteStagedInvoice(ctx, database.DeleteStagedInvoiceParams{ID: invoiceID, UserID: user.ID})
+			if err != nil {
+				log.Printf("Failed to remove partly staged upload %s: %v", invoiceID, err)
+			}
+		}
+		if _, err := cfg.S3.DeletePrefix(ctx, prefix); err != nil {
+			log.Printf("Failed to remove uploaded files under %s: %v", prefix, err)
+		}
+	}
+
+	s3Keys := make([]string, len(files))
+	for i, file := range files {
+		s3Keys[i] = fmt.Sprintf("%s%d-%s", prefix, i+1, file.Filename)
+		if err := cfg.S3.UploadFile(r.Context(), s3Keys[i], file.Data); err != nil {
+			discard()
+			respondWithError(w, http.StatusInternalServerError, "Failed to store uploaded file", err)
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+	invoice, err := cfg.DB.CreateStagedInvoice(r.Context(), database.CreateStagedInvoiceParams{
+		ID:             invoiceID,
+		UserID:         user.ID,
+		Source:         uploadSourceName,
+		GmailMessageID: sql.NullString{},
+		GmailThreadID:  "",
+		// uploads aren't scored, the user already decided it's an invoice
+		Status:        mailsource.StatusPendingReview,
+		Score:         sql.NullInt64{},
+		Tags:          "[]",
+		Sender:        user.Email,
+		Subject:       subject,
+		HasAttachment: true,
+		ReceivedAt:    now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		discard()
+		respondWithError(w, http.StatusInternalServerError, "Failed to stage uploaded invoice", err)
+		return
+	}
+	staged = true
+
+	for i, file := range files {
+		err = cfg.DB.CreateStagedAttachment(r.Context(), database.CreateStagedAttachmentParams{
+			ID:              uuid.New().String(),
+			StagedInvoiceID: invoice.ID,
+			Position:        int64(i),
+			GmailPartID:     s3Keys[i],
+			Filename:        file.Filename,
+			MimeType:        file.MimeType,
+			Size:            int64(len(file.Data)),
+			CreatedAt:       now,
+		})
+		if err != nil {
+			discard()
+			respondWithError(w, http.StatusInternalServerError, "Failed to stage uploaded file", err)
+			return
+		}
+	}
+
+	log.Printf("User %s uploaded invoice %s with %d files", user.Email, invoice.ID, len(files))
+
+	go cfg.processNewInvoices(context.Background(), user.ID)
+	respondWithJSON(w, http.StatusCreated, invoice)
+}
+
+// readUploadedFile reads one part of the form and checks that it's a document type we
+// also accept as an email attachment.
+func readUploadedFile(fileHeader *multipart.FileHeader) (uploadedFile, error) {
+	f, err := fileHeader.Open()
+	if err != nil {
+		return uploadedFile{}, fmt.Errorf("failed to read uploaded file %s", fileHeader.Filename)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return uploadedFile{}, fmt.Errorf("failed to read uploaded file %s", fileHeader.Filename)
+	}
+
+	filename := uploadFilename(fileHeader.Filename)
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, ok := mailparse.AttachmentType(mimeType, filename)
+	if !ok {
+		return uploadedFile{}, fmt.Errorf("unsupported file type for %s", filename)
+	}
+
+	return uploadedFile{
+		Filename: filename,
+		MimeType: mimeType,
+		Data:     data,
+	}, nil
+}
+
+// uploadFilename drops any directories the browser sent along with the name.
+func uploadFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return "upload"
+	}
+	return name
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/felixsolom/fetch-duck/internal/smtpservice"
+	"github.com/google/uuid"
+)
+
+// smtpSourceName is recorded on invoices received by the SMTP listener.
+const smtpSourceName = "smtp"
+
+// local part of inbound addresses, the user's token follows the plus
+const inboundAddressPrefix = "invoices+"
+
+type inboundAddressResponse struct {
+	Address   string `json:"address"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (cfg *apiConfig) newSMTPServer() *smtpservice.Server {
+	return &smtpservice.Server{
+		Hostname:        cfg.Inbound.Domain,
+		MaxMessageBytes: cfg.Inbound.MaxMessageBytes,
+		LookupRecipient: cfg.lookupInboundRecipient,
+		Deliver:         cfg.deliverInboundMessage,
+	}
+}
+
+// lookupInboundRecipient resolves invoices+<token>@<domain> to the token's owner.
+func (cfg *apiConfig) lookupInboundRecipient(ctx context.Context, address string) (string, error) {
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 || !strings.EqualFold(address[at+1:], cfg.Inbound.Domain) {
+		return "", smtpservice.ErrUnknownRecipient
+	}
+	local := strings.ToLower(address[:at])
+	if !strings.HasPrefix(local, inboundAddressPrefix) {
+		return "", smtpservice.ErrUnknownRecipient
+	}
+
+	inbound, err := cfg.DB.GetInboundAddressByToken(ctx, strings.TrimPrefix(local, inboundAddressPrefix))
+	if err == sql.ErrNoRows {
+		return "", smtpservice.ErrUnknownRecipient
+	}
+	if err != nil {
+		return "", err
+	}
+	return inbound.UserID, nil
+}
+
+// deliverInboundMessage stages everything that arrives, the sender chose to forward it.
+// It's still scored, so forwarded newsletters end up as low confidence. A message that
+// failed for another recipient is sent again to all of them, so one already staged for
+// this user counts as delivered.
+func (cfg *apiConfig) deliverInboundMessage(ctx context.Context, userID, from string, raw []byte) error {
+	msg, err := mailsource.ParseRaw(uuid.New().String(), raw, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %v", smtpservice.ErrMessageRejected, err)
+	}
+	criteria, err := cfg.scanCriteriaForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	assessor, err := mailsource.NewAssessor(ctx, cfg.DB, userID, criteria.MinScore)
+	if err != nil {
+		return err
+	}
+	staged, err := cfg.stageStoredMessage(ctx, userID, smtpSourceName, msg, raw, assessor)
+	if errors.Is(err, mailsource.ErrAlreadyStaged) {
+		log.Printf("Inbound message %s from %s is already staged for user ID %s", msg.InternetMessageID, from, userID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !staged {
+		log.Printf("A rule skipped inbound message from %s for user ID %s", from, userID)
+		return nil
+	}
+	log.Printf("Staged inbound message from %s for user ID %s", from, userID)
+
+	go cfg.processNewInvoices(context.Background(), userID)
+	return nil
+}
+
+func (cfg *apiConfig) handlerGetInboundAddress(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+	if cfg.Inbound.Domain == "" {
+		respondWithError(w, http.StatusNotFound, "Inbound email is not enabled", nil)
+		return
+	}
+
+	inbound, err := cfg.DB.GetInboundAddressByUser(r.Context(), user.ID)
+	if err == sql.ErrNoRows {
+		inbound, err = cfg.createInboundAddress(r.Context(), user.ID)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to get inbound address", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.inboundAddressResponse(inbound))
+}
+
+// handlerRotateInboundAddress replaces the address, mail to the old one bounces from now on.
+func (cfg *apiConfig) handlerRotateInboundAddress(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+	if cfg.Inbound.Domain == "" {
+		respondWithError(w, http.StatusNotFound, "Inbound email is not enabled", nil)
+		return
+	}
+
+	inbound, err := cfg.createInboundAddress(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to rotate inbound address", err)
+		return
+	}
+	log.Printf("User %s rotated their inbound address", user.Email)
+	respondWithJSON(w, http.StatusOK, cfg.inboundAddressResponse(inbound))
+}
+
+func (cfg *apiConfig) createInboundAddress(ctx context.Context, userID string) (database.InboundAddress, error) {
+	tokenBytes := make([]byte, 10)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return database.InboundAddress{}, err
+	}
+
+	now := time.Now().Unix()
+	return cfg.DB.UpsertInboundAddress(ctx, database.UpsertInboundAddressParams{
+		UserID:    userID,
+		Token:     hex.EncodeToString(tokenBytes),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+func (cfg *apiConfig) inboundAddressResponse(inbound database.InboundAddress) inboundAddressResponse {
+	return inboundAddressResponse{
+		Address:   inboundAddressPrefix + inbound.Token + "@" + cfg.Inbound.Domain,
+		UpdatedAt: inbound.UpdatedAt,
+	}
+}
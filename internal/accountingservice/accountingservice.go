@@ -47,6 +47,36 @@ type UploadURLResponse struct {
 	Fields UploadURLFields `json:"fields"`
 }
 
+// ExpenseDetails are values read from the document, sent along with the upload so the
+// draft expense starts out filled in. Empty values are left out.
+type ExpenseDetails struct {
+	Amount        float64 `json:"amount,omitempty"`
+	VAT           float64 `json:"vat,omitempty"`
+	Currency      string  `json:"currency,omitempty"`
+	Number        string  `json:"number,omitempty"`
+	Date          string  `json:"date,omitempty"`
+	DueDate       string  `json:"dueDate,omitempty"`
+	SupplierTaxID string  `json:"-"`
+	// Green Invoice document type, e.g. 305 for a tax invoice
+	DocumentType int `json:"documentType,omitempty"`
+}
+
+// UploadResult is what the accounting service answered an upload with, kept for audits.
+type UploadResult struct {
+	FileKey string `json:"fileKey"`
+	Status  string `json:"status"`
+}
+
+type uploadData struct {
+	Source int `json:"source"`
+	ExpenseDetails
+	Supplier *uploadSupplier `json:"supplier,omitempty"`
+}
+
+type uploadSupplier struct {
+	TaxID string `json:"taxId"`
+}
+
 func New(cfg config.AccountingConfig) (*Service, error) {
 	service := &Service{
 		cfg: cfg,
@@ -131,7 +161,7 @@ func (s *Service) getToken(ctx context.Context) (string, error) {
 	return s.token, nil
 }
 
-func (s *Service) getUploadURL(ctx context.Context) (*UploadURLResponse, error) {
+func (s *Service) getUploadURL(ctx context.Context, details ExpenseDetails) (*UploadURLResponse, error) {
 	token, err := s.getToken(ctx)
 	if err != nil {
 		return nil, err
@@ -147,9 +177,18 @@ func (s *Service) getUploadURL(ctx context.Context) (*UploadURLResponse, error)
 		return nil, fmt.Errorf("failed to parse upload endpoint URL: %w", err)
 	}
 
+	data := uploadData{Source: 5, ExpenseDetails: details}
+	if details.SupplierTaxID != "" {
+		data.Supplier = &uploadSupplier{TaxID: details.SupplierTaxID}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal upload data: %w", err)
+	}
+
 	q := u.Query()
 	q.Set("context", "expense")
-	q.Set("data", `{"source": 5}`)
+	q.Set("data", string(dataJSON))
 	u.RawQuery = q.Encode()
 
 	finalURL := u.String()
@@ -182,11 +221,11 @@ func (s *Service) getUploadURL(ctx context.Context) (*UploadURLResponse, error)
 	return &uploadURLresp, nil
 }
 
-func (s *Service) StagedInvoiceFile(ctx context.Context, filename string, fileData []byte) error {
+func (s *Service) StagedInvoiceFile(ctx context.Context, filename string, fileData []byte, details ExpenseDetails) (UploadResult, error) {
 	log.Println("getting pre-signed URL for invoice upload...")
-	uploadConfig, err := s.getUploadURL(ctx)
+	uploadConfig, err := s.getUploadURL(ctx, details)
 	if err != nil {
-		return fmt.Errorf("failed to get upload config: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to get upload config: %w", err)
 	}
 	log.Printf("Uploading file %s to %s", filename, uploadConfig.URL)
 
@@ -211,33 +250,33 @@ func (s *Service) StagedInvoiceFile(ctx context.Context, filename string, fileDa
 
 	for key, val := range fields {
 		if err = w.WriteField(key, val); err != nil {
-			return fmt.Errorf("failed to write field %s, %w", key, err)
+			return UploadResult{}, fmt.Errorf("failed to write field %s, %w", key, err)
 		}
 	}
 
 	fw, err := w.CreateFormFile("file", filename)
 	if err != nil {
-		return fmt.Errorf("failed to create form file: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to create form file: %w", err)
 	}
 
 	if _, err := fw.Write(fileData); err != nil {
-		return fmt.Errorf("failed to write file data to form: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to write file data to form: %w", err)
 	}
 
 	err = w.Close()
 	if err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", uploadConfig.URL, &b)
 	if err != nil {
-		return fmt.Errorf("failed to create final upload request: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to create final upload request: %w", err)
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute final upload request: %w", err)
+		return UploadResult{}, fmt.Errorf("failed to execute final upload request: %w", err)
 	}
 
 	defer func() {
@@ -248,8 +287,8 @@ func (s *Service) StagedInvoiceFile(ctx context.Context, filename string, fileDa
 
 	if resp.StatusCode > 299 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("final upload request failed with status: %s: %s", resp.Status, string(body))
+		return UploadResult{}, fmt.Errorf("final upload request failed with status: %s: %s", resp.Status, string(body))
 	}
 	log.Printf("Successfully staged invoice file: %s", filename)
-	return nil
+	return UploadResult{FileKey: uploadConfig.Fields.Key, Status: resp.Status}, nil
 }
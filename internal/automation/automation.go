@@ -0,0 +1,171 @@
+// Package automation evaluates the rules users set up to handle staged invoices
+// without reviewing them, such as "when the sender domain is acme.com and the subject
+// contains invoice, approve it".
+package automation
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// the things a rule can do to a matching message
+const (
+	ActionTag         = "tag"
+	ActionSetCategory = "set_category"
+	ActionAutoApprove = "auto_approve"
+	ActionAutoReject  = "auto_reject"
+	ActionSkip        = "skip"
+)
+
+// limits on what a rule may contain
+const (
+	maxNameLength  = 100
+	maxFieldLength = 200
+)
+
+// Rule matches when every condition that is set matches. A rule without conditions
+// matches everything, which Validate only allows for tags and categories.
+type Rule struct {
+	ID   string
+	Name string
+	// SenderDomain matches the domain of the sender address and its subdomains
+	SenderDomain string
+	// SubjectContains is matched case insensitively
+	SubjectContains string
+	Action          string
+	// Value is the tag or category, unused by the other actions
+	Value string
+}
+
+// Hit records a rule that took effect on a message.
+type Hit struct {
+	RuleID   string
+	RuleName string
+	Action   string
+	Value    string
+}
+
+// Outcome is what all the rules together decided about a message.
+type Outcome struct {
+	Tags     []string
+	Category string
+	// Decision is ActionAutoApprove, ActionAutoReject or ActionSkip, or "" when the
+	// message is left for review
+	Decision string
+	Hits     []Hit
+}
+
+// Validate normalizes the rule and checks it can be evaluated.
+func (r *Rule) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.SenderDomain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.SenderDomain), "@"))
+	r.SubjectContains = strings.TrimSpace(r.SubjectContains)
+	r.Value = strings.TrimSpace(r.Value)
+
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len([]rune(r.Name)) > maxNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+	for _, field := range []string{r.SenderDomain, r.SubjectContains, r.Value} {
+		if len([]rune(field)) > maxFieldLength {
+			return fmt.Errorf("%q is longer than %d characters", field, maxFieldLength)
+		}
+	}
+	if strings.Contains(r.SenderDomain, "@") {
+		return fmt.Errorf("sender_domain must be a domain, not an address")
+	}
+
+	switch r.Action {
+	case ActionTag, ActionSetCategory:
+		if r.Value == "" {
+			return fmt.Errorf("%s needs a value", r.Action)
+		}
+	case ActionAutoApprove, ActionAutoReject, ActionSkip:
+		// one such rule would decide every message the scan finds
+		if r.SenderDomain == "" && r.SubjectContains == "" {
+			return fmt.Errorf("%s needs a sender_domain or subject_contains", r.Action)
+		}
+		r.Value = ""
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	return nil
+}
+
+func (r Rule) Matches(sender, subject string) bool {
+	if r.SenderDomain != "" && !domainMatches(sender, r.SenderDomain) {
+		return false
+	}
+	if r.SubjectContains != "" && !strings.Contains(strings.ToLower(subject), strings.ToLower(r.SubjectContains)) {
+		return false
+	}
+	return true
+}
+
+// Evaluate applies the rules in order. Every matching tag rule adds its tag, the first
+// matching category and decision win, and a skip ends the evaluation since nothing
+// else will happen to the message.
+func Evaluate(rules []Rule, sender, subject string) Outcome {
+	var outcome Outcome
+	for _, rule := range rules {
+		if !rule.Matches(sender, subject) {
+			continue
+		}
+
+		switch rule.Action {
+		case ActionTag:
+			if containsFold(outcome.Tags, rule.Value) {
+				continue
+			}
+			outcome.Tags = append(outcome.Tags, rule.Value)
+		case ActionSetCategory:
+			if outcome.Category != "" {
+				continue
+			}
+			outcome.Category = rule.Value
+		case ActionAutoApprove, ActionAutoReject, ActionSkip:
+			if outcome.Decision != "" {
+				continue
+			}
+			outcome.Decision = rule.Action
+		default:
+			continue
+		}
+
+		outcome.Hits = append(outcome.Hits, Hit{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Action:   rule.Action,
+			Value:    rule.Value,
+		})
+		if rule.Action == ActionSkip {
+			break
+		}
+	}
+	return outcome
+}
+
+func domainMatches(sender, domain string) bool {
+	address := strings.ToLower(strings.TrimSpace(sender))
+	if parsed, err := mail.ParseAddress(sender); err == nil {
+		address = strings.ToLower(parsed.Address)
+	}
+	at := strings.LastIndexByte(address, '@')
+	if at < 0 {
+		return false
+	}
+	senderDomain := address[at+1:]
+	return senderDomain == domain || strings.HasSuffix(senderDomain, "."+domain)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
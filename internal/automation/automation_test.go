@@ -0,0 +1,105 @@
+package automation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	rules := []Rule{
+		{ID: "1", Name: "Newsletters", SenderDomain: "news.example.com", Action: ActionSkip},
+		{ID: "2", Name: "Acme tag", SenderDomain: "acme.com", Action: ActionTag, Value: "acme"},
+		{ID: "3", Name: "Acme invoices", SenderDomain: "acme.com", SubjectContains: "Invoice", Action: ActionAutoApprove},
+		{ID: "4", Name: "Hosting", SubjectContains: "hosting", Action: ActionSetCategory, Value: "infrastructure"},
+		{ID: "5", Name: "Other category", SubjectContains: "hosting", Action: ActionSetCategory, Value: "other"},
+		{ID: "6", Name: "Quotes", SubjectContains: "quote", Action: ActionAutoReject},
+		{ID: "7", Name: "Everything tagged", Action: ActionTag, Value: "inbox"},
+	}
+
+	testCases := []struct {
+		name     string
+		sender   string
+		subject  string
+		tags     []string
+		category string
+		decision string
+		hits     []string
+	}{
+		{
+			name:     "Skip Stops Evaluation",
+			sender:   "Weekly <weekly@news.example.com>",
+			subject:  "Hosting invoice tips",
+			decision: ActionSkip,
+			hits:     []string{"1"},
+		},
+		{
+			name:     "Subdomain Tag And Approve",
+			sender:   "billing@eu.acme.com",
+			subject:  "Your INVOICE for hosting",
+			tags:     []string{"acme", "inbox"},
+			category: "infrastructure",
+			decision: ActionAutoApprove,
+			hits:     []string{"2", "3", "4", "7"},
+		},
+		{
+			name:     "Lookalike Domain",
+			sender:   "billing@notacme.com",
+			subject:  "Quote 12",
+			tags:     []string{"inbox"},
+			decision: ActionAutoReject,
+			hits:     []string{"6", "7"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outcome := Evaluate(rules, tc.sender, tc.subject)
+			if !slices.Equal(outcome.Tags, tc.tags) {
+				t.Errorf("expected tags %q, but got %q", tc.tags, outcome.Tags)
+			}
+			if outcome.Category != tc.category {
+				t.Errorf("expected category %q, but got %q", tc.category, outcome.Category)
+			}
+			if outcome.Decision != tc.decision {
+				t.Errorf("expected decision %q, but got %q", tc.decision, outcome.Decision)
+			}
+			var hits []string
+			for _, hit := range outcome.Hits {
+				hits = append(hits, hit.RuleID)
+			}
+			if !slices.Equal(hits, tc.hits) {
+				t.Errorf("expected hits %q, but got %q", tc.hits, hits)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rule := Rule{Name: " Acme ", SenderDomain: " @Acme.COM ", Action: ActionAutoApprove, Value: "ignored"}
+	if err := rule.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rule.Name != "Acme" || rule.SenderDomain != "acme.com" || rule.Value != "" {
+		t.Errorf("expected rule to be normalized, but got %+v", rule)
+	}
+
+	everything := Rule{Name: "Everything", Action: ActionTag, Value: "mail"}
+	if err := everything.Validate(); err != nil {
+		t.Errorf("expected a tag rule without conditions to be valid, but got %v", err)
+	}
+
+	invalid := []Rule{
+		{SenderDomain: "acme.com", Action: ActionSkip},
+		{Name: "No value", Action: ActionTag},
+		{Name: "Address", SenderDomain: "billing@acme.com", Action: ActionSkip},
+		{Name: "Unknown", Action: "delete"},
+		{Name: "Approve Everything", Action: ActionAutoApprove},
+		{Name: "Reject Everything", SubjectContains: "  ", Action: ActionAutoReject},
+		{Name: "Skip Everything", Action: ActionSkip},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected rule %+v to be rejected", r)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Package classifier learns from a user's approve and reject decisions which messages
+// they consider invoices. It's a naive Bayes model over the sender, the subject words
+// and the attachment types, kept as counts in the database so every decision updates
+// it without retraining from scratch.
+package classifier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/mail"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+)
+
+// suggestions stored on staged invoices
+const (
+	SuggestApprove = "approve"
+	SuggestReject  = "reject"
+)
+
+// decisions of each kind needed before the model suggests anything
+const minExamples = 3
+
+// how sure the model has to be before it suggests a decision
+const (
+	approveThreshold = 0.9
+	rejectThreshold  = 0.1
+)
+
+// Example is what the model knows about a message.
+type Example struct {
+	Sender  string
+	Subject string
+	// MimeTypes of the attachments, empty when there are none
+	MimeTypes     []string
+	HasAttachment bool
+}
+
+// Counts are how often a feature appeared in approved and rejected messages.
+type Counts struct {
+	Approved int64
+	Rejected int64
+}
+
+type Model struct {
+	Approved int64
+	Rejected int64
+	Features map[string]Counts
+}
+
+// Features turns an example into the set of features the model counts. Subject words
+// with digits are dropped, invoice numbers and dates never repeat.
+func Features(ex Example) []string {
+	seen := make(map[string]bool)
+	var features []string
+	add := func(feature string) {
+		if !seen[feature] {
+			seen[feature] = true
+			features = append(features, feature)
+		}
+	}
+
+	address := strings.ToLower(strings.TrimSpace(ex.Sender))
+	if parsed, err := mail.ParseAddress(ex.Sender); err == nil {
+		address = strings.ToLower(parsed.Address)
+	}
+	if address != "" {
+		add("sender:" + address)
+		if at := strings.LastIndexByte(address, '@'); at >= 0 {
+			add("domain:" + address[at+1:])
+		}
+	}
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(ex.Subject), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 2 || strings.ContainsFunc(word, unicode.IsDigit) {
+			continue
+		}
+		add("subject:" + word)
+	}
+
+	for _, mimeType := range ex.MimeTypes {
+		add("attachment:" + attachmentKind(mimeType))
+	}
+	if len(ex.MimeTypes) == 0 && !ex.HasAttachment {
+		add("attachment:none")
+	}
+	return features
+}
+
+func attachmentKind(mimeType string) string {
+	switch {
+	case mimeType == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	default:
+		return "other"
+	}
+}
+
+// Trained reports whether the model has seen enough decisions of both kinds to be used.
+func (m *Model) Trained() bool {
+	return m != nil && m.Approved >= minExamples && m.Rejected >= minExamples
+}
+
+// ApproveProbability is the chance the user approves the example. Unknown features are
+// ignored and known ones are Laplace smoothed.
+func (m *Model) ApproveProbability(ex Example) float64 {
+	total := float64(m.Approved + m.Rejected)
+	logApproved := math.Log(float64(m.Approved+1) / (total + 2))
+	logRejected := math.Log(float64(m.Rejected+1) / (total + 2))
+
+	for _, feature := range Features(ex) {
+		counts, ok := m.Features[feature]
+		if !ok {
+			continue
+		}
+		logApproved += math.Log(float64(counts.Approved+1) / float64(m.Approved+2))
+		logRejected += math.Log(float64(counts.Rejected+1) / float64(m.Rejected+2))
+	}
+
+	// P(approved) = 1 / (1 + e^(logRejected - logApproved)) without overflowing
+	return 1 / (1 + math.Exp(logRejected-logApproved))
+}
+
+// Suggest returns the decision the model is confident about, or "" when it isn't.
+func (m *Model) Suggest(ex Example) (float64, string) {
+	if !m.Trained() {
+		return 0, ""
+	}
+	p := m.ApproveProbability(ex)
+	switch {
+	case p >= approveThreshold:
+		return p, SuggestApprove
+	case p <= rejectThreshold:
+		return p, SuggestReject
+	default:
+		return p, ""
+	}
+}
+
+// Load reads the user's model. Until one is stored it's built from their past
+// decisions in memory, Load never writes, the first decision learned saves it.
+func Load(ctx context.Context, db *database.Queries, userID string) (*Model, error) {
+	row, err := db.GetClassifierModel(ctx, userID)
+	if err == sql.ErrNoRows {
+		return build(ctx, db, userID, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get classifier model: %w", err)
+	}
+
+	features, err := db.ListClassifierFeatures(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list classifier features: %w", err)
+	}
+
+	model := &Model{
+		Approved: row.ApprovedCount,
+		Rejected: row.RejectedCount,
+		Features: make(map[string]Counts, len(features)),
+	}
+	for _, f := range features {
+		model.Features[f.Feature] = Counts{Approved: f.ApprovedCount, Rejected: f.RejectedCount}
+	}
+	return model, nil
+}
+
+// userLocks serializes the model updates of each user, a Learn that overlaps a Train
+// would otherwise be counted twice or wiped.
+var userLocks sync.Map
+
+func lockUser(userID string) func() {
+	mu, _ := userLocks.LoadOrStore(userID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// Train rebuilds the user's model from every invoice they approved or rejected.
+func Train(ctx context.Context, db *database.Queries, userID string) (*Model, error) {
+	defer lockUser(userID)()
+	return train(ctx, db, userID, nil)
+}
+
+// train rebuilds and stores the model, counting decided as well when it's given.
+func train(ctx context.Context, db *database.Queries, userID string, decided *database.StagedInvoice) (*Model, error) {
+	model, err := build(ctx, db, userID, decided)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.DeleteClassifierFeatures(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to clear classifier features: %w", err)
+	}
+	if err := db.DeleteClassifierModel(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to clear classifier model: %w", err)
+	}
+	for feature, counts := range model.Features {
+		err := db.IncrementClassifierFeature(ctx, database.IncrementClassifierFeatureParams{
+			UserID:        userID,
+			Feature:       feature,
+			ApprovedCount: counts.Approved,
+			RejectedCount: counts.Rejected,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save classifier feature: %w", err)
+		}
+	}
+	// the model row goes last, a training run that died halfway is redone by the next Learn
+	if err := saveModel(ctx, db, userID, model.Approved, model.Rejected); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// build counts the decisions the user made themselves, and decided when it's given.
+// Its decision may not be saved yet, an approval only ends approved once its job
+// finishes. What rules decided is left out, Learn never sees it either. Invoices
+// decided before their history was recorded count as the user's.
+func build(ctx context.Context, db *database.Queries, userID string, decided *database.StagedInvoice) (*Model, error) {
+	invoices, err := db.ListDecidedInvoicesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list decided invoices: %w", err)
+	}
+	if decided != nil {
+		invoices = slices.DeleteFunc(invoices, func(invoice database.StagedInvoice) bool {
+			return invoice.ID == decided.ID
+		})
+		invoices = append(invoices, *decided)
+	}
+
+	model := &Model{Features: make(map[string]Counts)}
+	for _, invoice := range invoices {
+		ex, err := ExampleFromInvoice(ctx, db, invoice)
+		if err != nil {
+			return nil, err
+		}
+		approved := invoice.Status == "approved"
+		if approved {
+			model.Approved++
+		} else {
+			model.Rejected++
+		}
+		for _, feature := range Features(ex) {
+			counts := model.Features[feature]
+			if approved {
+				counts.Approved++
+			} else {
+				counts.Rejected++
+			}
+			model.Features[feature] = counts
+		}
+	}
+	return model, nil
+}
+
+// Learn adds one decision to the user's model. The invoice must carry its new status,
+// a first call trains the model from scratch and counts it there.
+func Learn(ctx context.Context, db *database.Queries, invoice database.StagedInvoice, approved bool) error {
+	defer lockUser(invoice.UserID)()
+
+	_, err := db.GetClassifierModel(ctx, invoice.UserID)
+	if err == sql.ErrNoRows {
+		_, err = train(ctx, db, invoice.UserID, &invoice)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get classifier model: %w", err)
+	}
+
+	ex, err := ExampleFromInvoice(ctx, db, invoice)
+	if err != nil {
+		return err
+	}
+	var approvedCount, rejectedCount int64
+	if approved {
+		approvedCount = 1
+	} else {
+		rejectedCount = 1
+	}
+
+	for _, feature := range Features(ex) {
+		err := db.IncrementClassifierFeature(ctx, database.IncrementClassifierFeatureParams{
+			UserID:        invoice.UserID,
+			Feature:       feature,
+			ApprovedCount: approvedCount,
+			RejectedCount: rejectedCount,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update classifier feature: %w", err)
+		}
+	}
+	return saveModel(ctx, db, invoice.UserID, approvedCount, rejectedCount)
+}
+
+// ExampleFromInvoice describes a staged invoice the way the scan saw the message.
+func ExampleFromInvoice(ctx context.Context, db *database.Queries, invoice database.StagedInvoice) (Example, error) {
+	attachments, err := db.ListStagedAttachmentsByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return Example{}, fmt.Errorf("failed to list attachments of invoice %s: %w", invoice.ID, err)
+	}
+
+	ex := Example{
+		Sender:        invoice.Sender,
+		Subject:       invoice.Subject,
+		HasAttachment: invoice.HasAttachment,
+	}
+	for _, attachment := range attachments {
+		ex.MimeTypes = append(ex.MimeTypes, attachment.MimeType)
+	}
+	return ex, nil
+}
+
+func saveModel(ctx context.Context, db *database.Queries, userID string, approved, rejected int64) error {
+	now := time.Now().Unix()
+	err := db.IncrementClassifierModel(ctx, database.IncrementClassifierModelParams{
+		UserID:        userID,
+		ApprovedCount: approved,
+		RejectedCount: rejected,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save classifier model: %w", err)
+	}
+	return nil
+}
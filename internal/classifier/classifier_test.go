@@ -0,0 +1,97 @@
+package classifier
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		example  Example
+		expected []string
+	}{
+		{
+			name: "Sender Subject And PDF",
+			example: Example{
+				Sender:    "Acme Billing <Billing@Acme.com>",
+				Subject:   "Invoice INV-1001 for March",
+				MimeTypes: []string{"application/pdf", "application/pdf"},
+			},
+			expected: []string{"sender:billing@acme.com", "domain:acme.com", "subject:invoice", "subject:inv", "subject:for", "subject:march", "attachment:pdf"},
+		},
+		{
+			name:     "Hebrew Without Attachment",
+			example:  Example{Sender: "news@shop.co.il", Subject: "מבצע: 50% הנחה"},
+			expected: []string{"sender:news@shop.co.il", "domain:shop.co.il", "subject:מבצע", "subject:הנחה", "attachment:none"},
+		},
+		{
+			name:     "Legacy Attachment",
+			example:  Example{Sender: "x@y.com", Subject: "a", HasAttachment: true},
+			expected: []string{"sender:x@y.com", "domain:y.com"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Features(tc.example)
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	model := &Model{Features: make(map[string]Counts)}
+	learn := func(ex Example, approved bool, times int) {
+		for range times {
+			if approved {
+				model.Approved++
+			} else {
+				model.Rejected++
+			}
+			for _, feature := range Features(ex) {
+				counts := model.Features[feature]
+				if approved {
+					counts.Approved++
+				} else {
+					counts.Rejected++
+				}
+				model.Features[feature] = counts
+			}
+		}
+	}
+
+	invoice := Example{Sender: "billing@acme.com", Subject: "Your invoice", MimeTypes: []string{"application/pdf"}}
+	newsletter := Example{Sender: "news@shop.example", Subject: "Weekly deals and receipts"}
+
+	learn(invoice, true, 2)
+	learn(newsletter, false, 2)
+	if _, suggestion := model.Suggest(invoice); suggestion != "" {
+		t.Errorf("expected no suggestion before enough decisions, but got %q", suggestion)
+	}
+
+	learn(invoice, true, 4)
+	learn(newsletter, false, 4)
+
+	testCases := []struct {
+		name     string
+		example  Example
+		expected string
+	}{
+		{name: "Known Invoice Sender", example: invoice, expected: SuggestApprove},
+		{name: "Known Newsletter", example: newsletter, expected: SuggestReject},
+		{name: "Newsletter New Subject", example: Example{Sender: "news@shop.example", Subject: "Spring collection"}, expected: SuggestReject},
+		{name: "Unknown Sender", example: Example{Sender: "someone@else.org", Subject: "Hello", MimeTypes: []string{"image/png"}}, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, suggestion := model.Suggest(tc.example)
+			if suggestion != tc.expected {
+				t.Errorf("expected suggestion %q, but got %q (p=%.3f)", tc.expected, suggestion, p)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
@@ -37,12 +39,33 @@ type AccountingConfig struct {
 	BaseURL   string
 }
 
+type EncryptionConfig struct {
+	// comma separated version:base64key pairs, the highest version encrypts
+	TokenKeys string
+}
+
+type SchedulerConfig struct {
+	ScanInterval    time.Duration
+	ScanConcurrency int
+}
+
+type InboundConfig struct {
+	// SMTPAddr is where the SMTP listener binds, empty disables it
+	SMTPAddr string
+	// Domain is the part after the @ in every user's inbound address
+	Domain          string
+	MaxMessageBytes int64
+}
+
 type Config struct {
 	Google     GoogleConfig
 	DB         DBConfig
 	App        AppConfig
 	AWS        AWSConfig
 	Accounting AccountingConfig
+	Scheduler  SchedulerConfig
+	Encryption EncryptionConfig
+	Inbound    InboundConfig
 }
 
 func Load() (*Config, error) {
@@ -53,6 +76,34 @@ func Load() (*Config, error) {
 		redirectURL = "http://localhost:8080/api/v1/oauth/google/callback"
 	}
 
+	// a scan interval of 0 disables the background scheduler
+	scanInterval := 6 * time.Hour
+	if v := os.Getenv("SCAN_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("CRITICAL: SCAN_INTERVAL must be a duration such as 6h, got %q", v)
+		}
+		scanInterval = d
+	}
+
+	scanConcurrency := 3
+	if v := os.Getenv("SCAN_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("CRITICAL: SCAN_CONCURRENCY must be a positive integer, got %q", v)
+		}
+		scanConcurrency = n
+	}
+
+	maxMessageBytes := int64(25 << 20)
+	if v := os.Getenv("SMTP_MAX_MESSAGE_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("CRITICAL: SMTP_MAX_MESSAGE_BYTES must be a positive integer, got %q", v)
+		}
+		maxMessageBytes = n
+	}
+
 	cfg := &Config{
 		Google: GoogleConfig{
 			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
@@ -80,6 +131,18 @@ func Load() (*Config, error) {
 			APISecret: os.Getenv("GREEN_INVOICE_API_SECRET"),
 			BaseURL:   os.Getenv("GREEN_INVOICE_BASE_URL"),
 		},
+		Scheduler: SchedulerConfig{
+			ScanInterval:    scanInterval,
+			ScanConcurrency: scanConcurrency,
+		},
+		Encryption: EncryptionConfig{
+			TokenKeys: os.Getenv("TOKEN_ENCRYPTION_KEYS"),
+		},
+		Inbound: InboundConfig{
+			SMTPAddr:        os.Getenv("SMTP_LISTEN_ADDR"),
+			Domain:          os.Getenv("INBOUND_EMAIL_DOMAIN"),
+			MaxMessageBytes: maxMessageBytes,
+		},
 	}
 
 	if cfg.App.InviteCode == "" {
@@ -94,6 +157,14 @@ func Load() (*Config, error) {
 		log.Fatal("CRITICAL: Accounting credentials (API key, secret, base url) are not fully set")
 	}
 
+	if cfg.Encryption.TokenKeys == "" {
+		log.Fatal("CRITICAL: TOKEN_ENCRYPTION_KEYS environment variable is not set")
+	}
+
+	if cfg.Inbound.SMTPAddr != "" && cfg.Inbound.Domain == "" {
+		log.Fatal("CRITICAL: INBOUND_EMAIL_DOMAIN must be set when SMTP_LISTEN_ADDR is")
+	}
+
 	return cfg, nil
 }
 
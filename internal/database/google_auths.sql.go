@@ -10,7 +10,7 @@ import (
 )
 
 const getGoogleAuthByUserID = `-- name: GetGoogleAuthByUserID :one
-SELECT user_id, access_token, refresh_token, token_expiry, created_at, updated_at 
+SELECT user_id, access_token, refresh_token, token_expiry, needs_reauth, created_at, updated_at 
 FROM google_auths
 WHERE user_id = ?
 `
@@ -20,6 +20,7 @@ type GetGoogleAuthByUserIDRow struct {
 	AccessToken  string
 	RefreshToken string
 	TokenExpiry  int64
+	NeedsReauth  bool
 	CreatedAt    int64
 	UpdatedAt    int64
 }
@@ -32,12 +33,120 @@ func (q *Queries) GetGoogleAuthByUserID(ctx context.Context, userID string) (Get
 		&i.AccessToken,
 		&i.RefreshToken,
 		&i.TokenExpiry,
+		&i.NeedsReauth,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return i, err
 }
 
+const listGoogleAuthTokens = `-- name: ListGoogleAuthTokens :many
+
+SELECT user_id, access_token, refresh_token
+FROM google_auths
+`
+
+type ListGoogleAuthTokensRow struct {
+	UserID       string
+	AccessToken  string
+	RefreshToken string
+}
+
+func (q *Queries) ListGoogleAuthTokens(ctx context.Context) ([]ListGoogleAuthTokensRow, error) {
+	rows, err := q.db.QueryContext(ctx, listGoogleAuthTokens)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListGoogleAuthTokensRow
+	for rows.Next() {
+		var i ListGoogleAuthTokensRow
+		if err := rows.Scan(&i.UserID, &i.AccessToken, &i.RefreshToken); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScannableUserIDs = `-- name: ListScannableUserIDs :many
+
+SELECT user_id FROM google_auths
+WHERE refresh_token != '' AND needs_reauth = FALSE
+UNION
+SELECT user_id FROM imap_accounts
+`
+
+func (q *Queries) ListScannableUserIDs(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listScannableUserIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var user_id string
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markGoogleAuthNeedsReauth = `-- name: MarkGoogleAuthNeedsReauth :exec
+
+UPDATE google_auths
+SET needs_reauth = TRUE, updated_at = ?
+WHERE user_id = ?
+`
+
+type MarkGoogleAuthNeedsReauthParams struct {
+	UpdatedAt int64
+	UserID    string
+}
+
+func (q *Queries) MarkGoogleAuthNeedsReauth(ctx context.Context, arg MarkGoogleAuthNeedsReauthParams) error {
+	_, err := q.db.ExecContext(ctx, markGoogleAuthNeedsReauth, arg.UpdatedAt, arg.UserID)
+	return err
+}
+
+const updateGoogleAuthTokens = `-- name: UpdateGoogleAuthTokens :exec
+
+UPDATE google_auths
+SET access_token = ?, refresh_token = ?, updated_at = ?
+WHERE user_id = ?
+`
+
+type UpdateGoogleAuthTokensParams struct {
+	AccessToken  string
+	RefreshToken string
+	UpdatedAt    int64
+	UserID       string
+}
+
+func (q *Queries) UpdateGoogleAuthTokens(ctx context.Context, arg UpdateGoogleAuthTokensParams) error {
+	_, err := q.db.ExecContext(ctx, updateGoogleAuthTokens,
+		arg.AccessToken,
+		arg.RefreshToken,
+		arg.UpdatedAt,
+		arg.UserID,
+	)
+	return err
+}
+
 const upsertGoogleAuth = `-- name: UpsertGoogleAuth :exec
 
 INSERT INTO google_auths(
@@ -54,6 +163,7 @@ ON CONFLICT(user_id) DO UPDATE SET
     access_token = excluded.access_token,
     refresh_token = excluded.refresh_token,
     token_expiry = excluded.token_expiry,
+    needs_reauth = FALSE,
     updated_at = excluded.updated_at
 `
 
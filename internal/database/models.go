@@ -8,6 +8,63 @@ import (
 	"database/sql"
 )
 
+type ApprovalJob struct {
+	ID              string
+	UserID          string
+	StagedInvoiceID string
+	Status          string
+	Step            string
+	AttachmentIds   string
+	Attempts        int64
+	NextAttemptAt   int64
+	LastError       sql.NullString
+	FinishedAt      sql.NullInt64
+	CreatedAt       int64
+	UpdatedAt       int64
+}
+
+type ApprovalJobFile struct {
+	ApprovalJobID      string
+	Position           int64
+	StagedAttachmentID sql.NullString
+	Filename           string
+	S3Key              string
+	ArchivedAt         sql.NullInt64
+	SubmittedAt        sql.NullInt64
+}
+
+type ClassifierFeature struct {
+	UserID        string
+	Feature       string
+	ApprovedCount int64
+	RejectedCount int64
+}
+
+type ClassifierModel struct {
+	UserID        string
+	ApprovedCount int64
+	RejectedCount int64
+	CreatedAt     int64
+	UpdatedAt     int64
+}
+
+type GmailFailedMessage struct {
+	UserID     string
+	MessageID  string
+	NeedsMatch bool
+	Attempts   int64
+	LastError  string
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+type GmailSyncState struct {
+	UserID    string
+	HistoryID int64
+	CreatedAt int64
+	UpdatedAt int64
+}
+
 type GoogleAuth struct {
 	UserID       string
 	CreatedAt    int64
@@ -15,6 +72,121 @@ type GoogleAuth struct {
 	TokenExpiry  int64
 	AccessToken  string
 	RefreshToken string
+	NeedsReauth  bool
+}
+
+type ImapAccount struct {
+	UserID    string
+	Host      string
+	Port      int64
+	Username  string
+	Password  string
+	Mailbox   string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type InboundAddress struct {
+	UserID    string
+	Token     string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type InvoiceEvent struct {
+	ID                 string
+	StagedInvoiceID    string
+	Event              string
+	FromStatus         sql.NullString
+	ToStatus           sql.NullString
+	Actor              string
+	ActorUserID        sql.NullString
+	ClientIp           sql.NullString
+	UserAgent          sql.NullString
+	ApprovalJobID      sql.NullString
+	S3Key              sql.NullString
+	AccountingResponse sql.NullString
+	Error              sql.NullString
+	CreatedAt          int64
+}
+
+type InvoiceField struct {
+	StagedInvoiceID            string
+	StagedAttachmentID         sql.NullString
+	Status                     string
+	TotalAmount                sql.NullFloat64
+	TotalAmountConfidence      float64
+	VatAmount                  sql.NullFloat64
+	VatAmountConfidence        float64
+	Currency                   sql.NullString
+	CurrencyConfidence         float64
+	InvoiceNumber              sql.NullString
+	InvoiceNumberConfidence    float64
+	IssueDate                  sql.NullString
+	IssueDateConfidence        float64
+	DueDate                    sql.NullString
+	DueDateConfidence          float64
+	SupplierTaxID              sql.NullString
+	SupplierTaxIDConfidence    float64
+	Text                       string
+	Error                      sql.NullString
+	CreatedAt                  int64
+	UpdatedAt                  int64
+	AllocationNumber           sql.NullString
+	AllocationNumberConfidence float64
+}
+
+type InvoiceRule struct {
+	ID              string
+	UserID          string
+	Name            string
+	Position        int64
+	SenderDomain    string
+	SubjectContains string
+	Action          string
+	Value           string
+	Enabled         bool
+	CreatedAt       int64
+	UpdatedAt       int64
+}
+
+type InvoiceRuleHit struct {
+	ID              string
+	StagedInvoiceID string
+	RuleID          string
+	RuleName        string
+	Action          string
+	Value           string
+	CreatedAt       int64
+}
+
+type ScanJob struct {
+	ID              string
+	UserID          string
+	Status          string
+	MessagesSeen    int64
+	MessagesStaged  int64
+	MessagesSkipped int64
+	MessagesFailed  int64
+	LastError       sql.NullString
+	StartedAt       int64
+	FinishedAt      sql.NullInt64
+	CreatedAt       int64
+	UpdatedAt       int64
+}
+
+type ScanRule struct {
+	UserID             string
+	UseDefaultKeywords bool
+	IncludeKeywords    string
+	AllowedSenders     string
+	BlockedSenders     string
+	IncludeLabels      string
+	ExcludeLabels      string
+	DateFloor          sql.NullString
+	CreatedAt          int64
+	UpdatedAt          int64
+	MinScore           int64
 }
 
 type Session struct {
@@ -24,19 +196,40 @@ type Session struct {
 	CreatedAt int64
 }
 
+type StagedAttachment struct {
+	ID              string
+	StagedInvoiceID string
+	Position        int64
+	GmailPartID     string
+	Filename        string
+	MimeType        string
+	Size            int64
+	CreatedAt       int64
+	S3Key           sql.NullString
+}
+
 type StagedInvoice struct {
-	ID             string
-	UserID         string
-	GmailMessageID string
-	GmailThreadID  string
-	Status         string
-	Sender         string
-	Subject        string
-	Snippet        sql.NullString
-	HasAttachment  bool
-	ReceivedAt     int64
-	CreatedAt      int64
-	UpdatedAt      int64
+	ID                     string
+	UserID                 string
+	GmailMessageID         sql.NullString
+	GmailThreadID          string
+	Status                 string
+	Sender                 string
+	Subject                string
+	Snippet                sql.NullString
+	HasAttachment          bool
+	ReceivedAt             int64
+	CreatedAt              int64
+	UpdatedAt              int64
+	Source                 string
+	InternetMessageID      sql.NullString
+	Score                  sql.NullInt64
+	ApproveProbability     sql.NullFloat64
+	Suggestion             sql.NullString
+	Tags                   string
+	Category               sql.NullString
+	DocumentType           sql.NullString
+	DocumentTypeConfidence sql.NullFloat64
 }
 
 type User struct {
@@ -14,8 +14,16 @@ const createStagedInvoice = `-- name: CreateStagedInvoice :one
 INSERT INTO staged_invoices (
     id,
     user_id,
+    source,
     gmail_message_id,
+    internet_message_id,
     gmail_thread_id,
+    status,
+    score,
+    approve_probability,
+    suggestion,
+    tags,
+    category,
     sender,
     subject,
     snippet,
@@ -24,31 +32,47 @@ INSERT INTO staged_invoices (
     created_at,
     updated_at
 ) VALUES (
-    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 )
-RETURNING id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at
+RETURNING id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence
 `
 
 type CreateStagedInvoiceParams struct {
-	ID             string
-	UserID         string
-	GmailMessageID string
-	GmailThreadID  string
-	Sender         string
-	Subject        string
-	Snippet        sql.NullString
-	HasAttachment  bool
-	ReceivedAt     int64
-	CreatedAt      int64
-	UpdatedAt      int64
+	ID                 string
+	UserID             string
+	Source             string
+	GmailMessageID     sql.NullString
+	InternetMessageID  sql.NullString
+	GmailThreadID      string
+	Status             string
+	Score              sql.NullInt64
+	ApproveProbability sql.NullFloat64
+	Suggestion         sql.NullString
+	Tags               string
+	Category           sql.NullString
+	Sender             string
+	Subject            string
+	Snippet            sql.NullString
+	HasAttachment      bool
+	ReceivedAt         int64
+	CreatedAt          int64
+	UpdatedAt          int64
 }
 
 func (q *Queries) CreateStagedInvoice(ctx context.Context, arg CreateStagedInvoiceParams) (StagedInvoice, error) {
 	row := q.db.QueryRowContext(ctx, createStagedInvoice,
 		arg.ID,
 		arg.UserID,
+		arg.Source,
 		arg.GmailMessageID,
+		arg.InternetMessageID,
 		arg.GmailThreadID,
+		arg.Status,
+		arg.Score,
+		arg.ApproveProbability,
+		arg.Suggestion,
+		arg.Tags,
+		arg.Category,
 		arg.Sender,
 		arg.Subject,
 		arg.Snippet,
@@ -71,13 +95,38 @@ func (q *Queries) CreateStagedInvoice(ctx context.Context, arg CreateStagedInvoi
 		&i.ReceivedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Source,
+		&i.InternetMessageID,
+		&i.Score,
+		&i.ApproveProbability,
+		&i.Suggestion,
+		&i.Tags,
+		&i.Category,
+		&i.DocumentType,
+		&i.DocumentTypeConfidence,
 	)
 	return i, err
 }
 
+const deleteStagedInvoice = `-- name: DeleteStagedInvoice :exec
+
+DELETE FROM staged_invoices
+WHERE id = ? AND user_id = ?
+`
+
+type DeleteStagedInvoiceParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) DeleteStagedInvoice(ctx context.Context, arg DeleteStagedInvoiceParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStagedInvoice, arg.ID, arg.UserID)
+	return err
+}
+
 const getStagedInvoice = `-- name: GetStagedInvoice :one
 
-SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at FROM staged_invoices
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
 WHERE id = ? AND user_id = ?
 `
 
@@ -102,19 +151,69 @@ func (q *Queries) GetStagedInvoice(ctx context.Context, arg GetStagedInvoicePara
 		&i.ReceivedAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Source,
+		&i.InternetMessageID,
+		&i.Score,
+		&i.ApproveProbability,
+		&i.Suggestion,
+		&i.Tags,
+		&i.Category,
+		&i.DocumentType,
+		&i.DocumentTypeConfidence,
+	)
+	return i, err
+}
+
+const getStagedInvoiceByInternetMessageID = `-- name: GetStagedInvoiceByInternetMessageID :one
+
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
+WHERE user_id = ? AND internet_message_id = ?
+LIMIT 1
+`
+
+type GetStagedInvoiceByInternetMessageIDParams struct {
+	UserID            string
+	InternetMessageID sql.NullString
+}
+
+func (q *Queries) GetStagedInvoiceByInternetMessageID(ctx context.Context, arg GetStagedInvoiceByInternetMessageIDParams) (StagedInvoice, error) {
+	row := q.db.QueryRowContext(ctx, getStagedInvoiceByInternetMessageID, arg.UserID, arg.InternetMessageID)
+	var i StagedInvoice
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.GmailMessageID,
+		&i.GmailThreadID,
+		&i.Status,
+		&i.Sender,
+		&i.Subject,
+		&i.Snippet,
+		&i.HasAttachment,
+		&i.ReceivedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Source,
+		&i.InternetMessageID,
+		&i.Score,
+		&i.ApproveProbability,
+		&i.Suggestion,
+		&i.Tags,
+		&i.Category,
+		&i.DocumentType,
+		&i.DocumentTypeConfidence,
 	)
 	return i, err
 }
 
 const getStagedInvoicesByMessageId = `-- name: GetStagedInvoicesByMessageId :many
 
-SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at FROM staged_invoices
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
 WHERE user_id = ? AND gmail_message_id = ?
 `
 
 type GetStagedInvoicesByMessageIdParams struct {
 	UserID         string
-	GmailMessageID string
+	GmailMessageID sql.NullString
 }
 
 func (q *Queries) GetStagedInvoicesByMessageId(ctx context.Context, arg GetStagedInvoicesByMessageIdParams) ([]StagedInvoice, error) {
@@ -139,6 +238,198 @@ func (q *Queries) GetStagedInvoicesByMessageId(ctx context.Context, arg GetStage
 			&i.ReceivedAt,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDecidedInvoicesByUser = `-- name: ListDecidedInvoicesByUser :many
+
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
+WHERE user_id = ? AND status IN ('approved', 'rejected') AND (
+    EXISTS (
+        SELECT 1 FROM invoice_events
+        WHERE invoice_events.staged_invoice_id = staged_invoices.id
+            AND invoice_events.event = 'status_changed'
+            AND invoice_events.actor = 'user'
+            AND invoice_events.to_status = CASE staged_invoices.status WHEN 'approved' THEN 'approving' ELSE 'rejected' END
+    )
+    OR NOT EXISTS (
+        SELECT 1 FROM invoice_events
+        WHERE invoice_events.staged_invoice_id = staged_invoices.id
+    )
+)
+`
+
+func (q *Queries) ListDecidedInvoicesByUser(ctx context.Context, userID string) ([]StagedInvoice, error) {
+	rows, err := q.db.QueryContext(ctx, listDecidedInvoicesByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StagedInvoice
+	for rows.Next() {
+		var i StagedInvoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.GmailMessageID,
+			&i.GmailThreadID,
+			&i.Status,
+			&i.Sender,
+			&i.Subject,
+			&i.Snippet,
+			&i.HasAttachment,
+			&i.ReceivedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInternetMessageIDsByUser = `-- name: ListInternetMessageIDsByUser :many
+
+SELECT internet_message_id FROM staged_invoices
+WHERE user_id = ? AND internet_message_id IS NOT NULL
+`
+
+func (q *Queries) ListInternetMessageIDsByUser(ctx context.Context, userID string) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, listInternetMessageIDsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullString
+	for rows.Next() {
+		var internet_message_id sql.NullString
+		if err := rows.Scan(&internet_message_id); err != nil {
+			return nil, err
+		}
+		items = append(items, internet_message_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSenderDecisionsByUser = `-- name: ListSenderDecisionsByUser :many
+
+SELECT sender, status FROM staged_invoices
+WHERE user_id = ? AND status IN ('approved', 'rejected')
+`
+
+type ListSenderDecisionsByUserRow struct {
+	Sender string
+	Status string
+}
+
+func (q *Queries) ListSenderDecisionsByUser(ctx context.Context, userID string) ([]ListSenderDecisionsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSenderDecisionsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSenderDecisionsByUserRow
+	for rows.Next() {
+		var i ListSenderDecisionsByUserRow
+		if err := rows.Scan(&i.Sender, &i.Status); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStagedInvoicesByStatus = `-- name: ListStagedInvoicesByStatus :many
+
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
+WHERE user_id = ? AND status = ?
+ORDER BY received_at
+`
+
+type ListStagedInvoicesByStatusParams struct {
+	UserID string
+	Status string
+}
+
+func (q *Queries) ListStagedInvoicesByStatus(ctx context.Context, arg ListStagedInvoicesByStatusParams) ([]StagedInvoice, error) {
+	rows, err := q.db.QueryContext(ctx, listStagedInvoicesByStatus, arg.UserID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StagedInvoice
+	for rows.Next() {
+		var i StagedInvoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.GmailMessageID,
+			&i.GmailThreadID,
+			&i.Status,
+			&i.Sender,
+			&i.Subject,
+			&i.Snippet,
+			&i.HasAttachment,
+			&i.ReceivedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
 		); err != nil {
 			return nil, err
 		}
@@ -155,10 +446,10 @@ func (q *Queries) GetStagedInvoicesByMessageId(ctx context.Context, arg GetStage
 
 const listStagedInvoicesByUser = `-- name: ListStagedInvoicesByUser :many
 
-SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at FROM staged_invoices
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
 WHERE 
     user_id = ? 
-    AND status = 'pending_review'
+    AND status = ?
     AND received_at >= ?
     AND received_at <= ?
     ORDER BY received_at DESC
@@ -168,6 +459,7 @@ OFFSET ?
 
 type ListStagedInvoicesByUserParams struct {
 	UserID       string
+	Status       string
 	ReceivedAt   int64
 	ReceivedAt_2 int64
 	Limit        int64
@@ -177,6 +469,81 @@ type ListStagedInvoicesByUserParams struct {
 func (q *Queries) ListStagedInvoicesByUser(ctx context.Context, arg ListStagedInvoicesByUserParams) ([]StagedInvoice, error) {
 	rows, err := q.db.QueryContext(ctx, listStagedInvoicesByUser,
 		arg.UserID,
+		arg.Status,
+		arg.ReceivedAt,
+		arg.ReceivedAt_2,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StagedInvoice
+	for rows.Next() {
+		var i StagedInvoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.GmailMessageID,
+			&i.GmailThreadID,
+			&i.Status,
+			&i.Sender,
+			&i.Subject,
+			&i.Snippet,
+			&i.HasAttachment,
+			&i.ReceivedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStagedInvoicesByUserByScore = `-- name: ListStagedInvoicesByUserByScore :many
+
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
+WHERE
+    user_id = ?
+    AND status = ?
+    AND received_at >= ?
+    AND received_at <= ?
+    ORDER BY score DESC, received_at DESC
+LIMIT ?
+OFFSET ?
+`
+
+type ListStagedInvoicesByUserByScoreParams struct {
+	UserID       string
+	Status       string
+	ReceivedAt   int64
+	ReceivedAt_2 int64
+	Limit        int64
+	Offset       int64
+}
+
+func (q *Queries) ListStagedInvoicesByUserByScore(ctx context.Context, arg ListStagedInvoicesByUserByScoreParams) ([]StagedInvoice, error) {
+	rows, err := q.db.QueryContext(ctx, listStagedInvoicesByUserByScore,
+		arg.UserID,
+		arg.Status,
 		arg.ReceivedAt,
 		arg.ReceivedAt_2,
 		arg.Limit,
@@ -202,6 +569,15 @@ func (q *Queries) ListStagedInvoicesByUser(ctx context.Context, arg ListStagedIn
 			&i.ReceivedAt,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
 		); err != nil {
 			return nil, err
 		}
@@ -216,6 +592,153 @@ func (q *Queries) ListStagedInvoicesByUser(ctx context.Context, arg ListStagedIn
 	return items, nil
 }
 
+const listStagedInvoicesWithoutFields = `-- name: ListStagedInvoicesWithoutFields :many
+
+SELECT id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet, has_attachment, received_at, created_at, updated_at, source, internet_message_id, score, approve_probability, suggestion, tags, category, document_type, document_type_confidence FROM staged_invoices
+WHERE user_id = ?
+    AND status IN ('pending_review', 'low_confidence', 'approval_queued')
+    AND id NOT IN (SELECT staged_invoice_id FROM invoice_fields)
+ORDER BY received_at
+LIMIT ?
+`
+
+type ListStagedInvoicesWithoutFieldsParams struct {
+	UserID string
+	Limit  int64
+}
+
+func (q *Queries) ListStagedInvoicesWithoutFields(ctx context.Context, arg ListStagedInvoicesWithoutFieldsParams) ([]StagedInvoice, error) {
+	rows, err := q.db.QueryContext(ctx, listStagedInvoicesWithoutFields, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StagedInvoice
+	for rows.Next() {
+		var i StagedInvoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.GmailMessageID,
+			&i.GmailThreadID,
+			&i.Status,
+			&i.Sender,
+			&i.Subject,
+			&i.Snippet,
+			&i.HasAttachment,
+			&i.ReceivedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Source,
+			&i.InternetMessageID,
+			&i.Score,
+			&i.ApproveProbability,
+			&i.Suggestion,
+			&i.Tags,
+			&i.Category,
+			&i.DocumentType,
+			&i.DocumentTypeConfidence,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStagedMessageIDsByUser = `-- name: ListStagedMessageIDsByUser :many
+
+SELECT gmail_message_id FROM staged_invoices
+WHERE user_id = ? AND source = ?
+`
+
+type ListStagedMessageIDsByUserParams struct {
+	UserID string
+	Source string
+}
+
+func (q *Queries) ListStagedMessageIDsByUser(ctx context.Context, arg ListStagedMessageIDsByUserParams) ([]sql.NullString, error) {
+	rows, err := q.db.QueryContext(ctx, listStagedMessageIDsByUser, arg.UserID, arg.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullString
+	for rows.Next() {
+		var gmail_message_id sql.NullString
+		if err := rows.Scan(&gmail_message_id); err != nil {
+			return nil, err
+		}
+		items = append(items, gmail_message_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const transitionStagedInvoiceStatus = `-- name: TransitionStagedInvoiceStatus :execrows
+
+UPDATE staged_invoices
+SET status = ?, updated_at = ?
+WHERE id = ? AND user_id = ? AND status = ?
+`
+
+type TransitionStagedInvoiceStatusParams struct {
+	Status    string
+	UpdatedAt int64
+	ID        string
+	UserID    string
+	Status_2  string
+}
+
+func (q *Queries) TransitionStagedInvoiceStatus(ctx context.Context, arg TransitionStagedInvoiceStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, transitionStagedInvoiceStatus,
+		arg.Status,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.UserID,
+		arg.Status_2,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateStagedInvoiceDocumentType = `-- name: UpdateStagedInvoiceDocumentType :exec
+
+UPDATE staged_invoices
+SET document_type = ?, document_type_confidence = ?
+WHERE id = ? AND user_id = ?
+`
+
+type UpdateStagedInvoiceDocumentTypeParams struct {
+	DocumentType           sql.NullString
+	DocumentTypeConfidence sql.NullFloat64
+	ID                     string
+	UserID                 string
+}
+
+func (q *Queries) UpdateStagedInvoiceDocumentType(ctx context.Context, arg UpdateStagedInvoiceDocumentTypeParams) error {
+	_, err := q.db.ExecContext(ctx, updateStagedInvoiceDocumentType,
+		arg.DocumentType,
+		arg.DocumentTypeConfidence,
+		arg.ID,
+		arg.UserID,
+	)
+	return err
+}
+
 const updateStagedInvoiceStatus = `-- name: UpdateStagedInvoiceStatus :exec
 
 UPDATE staged_invoices
@@ -0,0 +1,142 @@
+// Package doctype tells apart the kinds of document that get staged. Israeli
+// bookkeeping treats each differently: a tax invoice is what VAT is deducted from, a
+// receipt only proves payment, an invoice-receipt is both, a credit note reverses an
+// earlier invoice, and quotes and order confirmations aren't expenses at all.
+package doctype
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/felixsolom/fetch-duck/internal/invoicefields"
+)
+
+const (
+	TaxInvoice     = "tax_invoice"
+	Receipt        = "receipt"
+	InvoiceReceipt = "invoice_receipt"
+	CreditNote     = "credit_note"
+	// Quote also covers order confirmations, proformas and payment demands, none of
+	// which are tax documents
+	Quote   = "quote"
+	Unknown = "unknown"
+)
+
+// Result is the most likely type and the share of the evidence that points to it.
+type Result struct {
+	Type       string  `json:"type"`
+	Confidence float64 `json:"confidence"`
+}
+
+// NeedsAllocationNumber reports whether the allocation number rule applies to the
+// document. It only covers tax invoices, a document that couldn't be told apart may
+// be one.
+func NeedsAllocationNumber(docType string) bool {
+	switch docType {
+	case TaxInvoice, InvoiceReceipt, Unknown, "":
+		return true
+	default:
+		return false
+	}
+}
+
+// AccountingCode returns the Green Invoice document type of a classified document, 0
+// when there isn't one to send.
+func AccountingCode(docType string) int {
+	switch docType {
+	case TaxInvoice:
+		return 305
+	case InvoiceReceipt:
+		return 320
+	case CreditNote:
+		return 330
+	case Receipt:
+		return 400
+	}
+	return 0
+}
+
+type pattern struct {
+	docType string
+	re      *regexp.Regexp
+	weight  float64
+}
+
+// patterns are matched in order and each match is blanked out before the next pattern
+// runs, so "חשבונית מס/קבלה" counts as an invoice-receipt and not also as a tax invoice
+// and a receipt.
+var patterns = []pattern{
+	{InvoiceReceipt, regexp.MustCompile(`(?i)חשבונית(?: מס)?\s*[/\-,]?\s*קבלה|invoice\s*[/&\-]\s*receipt|tax invoice\s*[/&\-]?\s*receipt`), 1},
+	{CreditNote, regexp.MustCompile(`(?i)חשבונית(?: מס)? זיכוי|תעודת זיכוי|credit\s*(?:note|memo|invoice)|refund receipt`), 1},
+	{Quote, regexp.MustCompile(`(?i)הצעת מחיר|אישור הזמנה|הזמנת רכש|חשבון עסקה|דרישת תשלום|\bquot(?:e|ation)\b|\bestimate\b|order confirm(?:ation|ed)|\bpro\s*-?\s*forma\b|purchase order`), 1},
+	{TaxInvoice, regexp.MustCompile(`(?i)חשבונית מס|tax invoice|vat invoice`), 1},
+	{Receipt, regexp.MustCompile(`(?i)קבלה|\breceipt\b|payment (?:received|confirmation)|אישור תשלום`), 0.8},
+	{TaxInvoice, regexp.MustCompile(`(?i)חשבונית|\binvoice\b`), 0.6},
+	{CreditNote, regexp.MustCompile(`(?i)זיכוי|\brefund\b`), 0.5},
+}
+
+// how much a match counts depending on where it was found. The title of the PDF says
+// most, an email body mostly talks about the attachment rather than being it.
+const (
+	documentTitleWeight = 3
+	documentWeight      = 1
+	subjectWeight       = 2
+	bodyWeight          = 0.5
+	// lines at the top of a document that count as its title
+	titleLines = 6
+	// evidence below this total is a guess
+	minEvidence = 2
+)
+
+// Classify decides the type from the email subject and body and the text of the
+// document, any of which may be empty.
+func Classify(subject, body, documentText string) Result {
+	scores := map[string]float64{}
+	add := func(text string, weight float64) {
+		for docType, score := range match(text) {
+			scores[docType] += score * weight
+		}
+	}
+
+	lines := invoicefields.Lines(documentText)
+	split := min(titleLines, len(lines))
+	add(strings.Join(lines[:split], "\n"), documentTitleWeight)
+	add(strings.Join(lines[split:], "\n"), documentWeight)
+	add(subject, subjectWeight)
+	add(body, bodyWeight)
+
+	best, total := Result{Type: Unknown}, 0.0
+	for docType, score := range scores {
+		total += score
+		if score > best.Confidence || score == best.Confidence && docType < best.Type {
+			best = Result{Type: docType, Confidence: score}
+		}
+	}
+	if total == 0 {
+		return Result{Type: Unknown}
+	}
+	best.Confidence = best.Confidence / total
+	if total < minEvidence {
+		best.Confidence *= total / minEvidence
+	}
+	return best
+}
+
+// match counts the matches of every type in text, each worth its pattern's weight.
+// Repeats on the same page add up to at most twice a single mention, footers
+// shouldn't outvote the title.
+func match(text string) map[string]float64 {
+	scores := map[string]float64{}
+	for _, p := range patterns {
+		locs := p.re.FindAllStringIndex(text, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		scores[p.docType] += p.weight * min(2, 1+float64(len(locs)-1)*0.25)
+		for i := len(locs) - 1; i >= 0; i-- {
+			loc := locs[i]
+			text = text[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + text[loc[1]:]
+		}
+	}
+	return scores
+}
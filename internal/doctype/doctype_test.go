@@ -0,0 +1,81 @@
+package doctype
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		subject  string
+		body     string
+		document string
+		expected string
+	}{
+		{
+			name:     "Tax Invoice",
+			subject:  "חשבונית מס 10234 מחברת הדוגמה",
+			document: "חברת הדוגמה בע\"מ\nחשבונית מס מס' 10234\nסה\"כ לתשלום 1,170.00",
+			expected: TaxInvoice,
+		},
+		{
+			name:     "Invoice Receipt",
+			subject:  "מסמך חדש מחברת הדוגמה",
+			document: "חשבונית מס/קבלה 5521\nאמצעי תשלום: כרטיס אשראי",
+			expected: InvoiceReceipt,
+		},
+		{
+			name:     "Receipt Only",
+			subject:  "Your receipt from Acme #1234-5678",
+			body:     "Thanks for your payment. Your invoice is attached.",
+			document: "Receipt\nReceipt number 1234-5678\nAmount paid $20.00",
+			expected: Receipt,
+		},
+		{
+			name:     "Credit Note",
+			subject:  "Invoice update",
+			document: "CREDIT NOTE\nCredit note number CN-77\nRefers to invoice INV-2024-0042",
+			expected: CreditNote,
+		},
+		{
+			name:     "Hebrew Credit Note",
+			document: "חשבונית זיכוי 88\nזיכוי בגין חשבונית מס 10234",
+			expected: CreditNote,
+		},
+		{
+			name:     "Quote",
+			subject:  "הצעת מחיר לפרויקט",
+			document: "הצעת מחיר מס' 300\nההצעה בתוקף ל-30 יום",
+			expected: Quote,
+		},
+		{
+			name:     "Order Confirmation Without Document",
+			subject:  "Your Order Confirmation",
+			body:     "We'll send the invoice once your order ships.",
+			expected: Quote,
+		},
+		{
+			name:     "Nothing To Go On",
+			subject:  "Hello",
+			expected: Unknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Classify(tc.subject, tc.body, tc.document)
+			if got.Type != tc.expected {
+				t.Errorf("expected %s, but got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestClassifyConfidence(t *testing.T) {
+	strong := Classify("Tax invoice 42", "", "TAX INVOICE\nInvoice no 42")
+	weak := Classify("", "see the invoice", "")
+	if strong.Confidence < 0.8 {
+		t.Errorf("expected a confident tax invoice, but got %+v", strong)
+	}
+	if weak.Type != TaxInvoice || weak.Confidence >= 0.5 {
+		t.Errorf("expected a weak tax invoice guess, but got %+v", weak)
+	}
+}
@@ -0,0 +1,126 @@
+package gmailservice
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/felixsolom/fetch-duck/internal/mailparse"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Attachment describes one attachment part of a message. PartID is stable for the
+// lifetime of the message, AttachmentID is only a handle for downloading the body.
+type Attachment struct {
+	PartID       string
+	AttachmentID string
+	Filename     string
+	MimeType     string
+	Size         int64
+}
+
+// ListAttachments fetches the message and returns its attachments in MIME order.
+func (s *Service) ListAttachments(messageID string) ([]Attachment, error) {
+	fullMsg, err := s.GetFullMessage(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get full message: %w", err)
+	}
+	return findAttachmentParts(fullMsg.Payload), nil
+}
+
+// GetRawMessage returns the complete RFC 822 source of the message.
+func (s *Service) GetRawMessage(messageID string) ([]byte, error) {
+	msg, err := s.Users.Messages.Get("me", messageID).Format("raw").Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw message: %w", err)
+	}
+
+	raw, err := base64.URLEncoding.DecodeString(msg.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw message %w", err)
+	}
+	return raw, nil
+}
+
+func (s *Service) GetAttachmentData(messageID, attachmentID string) ([]byte, error) {
+	attachmentBody, err := s.Users.Messages.Attachments.Get("me", messageID, attachmentID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment data for ID %w", err)
+	}
+
+	decodedData, err := base64.URLEncoding.DecodeString(attachmentBody.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode attachment data %w", err)
+	}
+	return decodedData, nil
+}
+
+// findAttachmentParts walks the MIME tree depth first and collects every part that
+// carries an attachment body of an allowed type. Inline images such as logos and
+// signatures are left out.
+func findAttachmentParts(payload *gmail.MessagePart) []Attachment {
+	return collectAttachmentParts(payload, bodyData(payload, "text/html"))
+}
+
+func collectAttachmentParts(part *gmail.MessagePart, html []byte) []Attachment {
+	if part == nil {
+		return nil
+	}
+
+	var attachments []Attachment
+	if part.Filename != "" && part.Body != nil && part.Body.AttachmentId != "" {
+		mimeType, allowed := mailparse.AttachmentType(part.MimeType, part.Filename)
+		inline := mailparse.IsInlineImage(mimeType, partHeader(part, "Content-Disposition"), partHeader(part, "Content-ID"), html)
+		if allowed && !inline {
+			attachments = append(attachments, Attachment{
+				PartID:       part.PartId,
+				AttachmentID: part.Body.AttachmentId,
+				Filename:     part.Filename,
+				MimeType:     mimeType,
+				Size:         part.Body.Size,
+			})
+		}
+	}
+
+	for _, subPart := range part.Parts {
+		attachments = append(attachments, collectAttachmentParts(subPart, html)...)
+	}
+	return attachments
+}
+
+// bodyData joins the parts of mimeType in a message fetched in full format, where
+// Gmail includes body data that isn't an attachment.
+func bodyData(part *gmail.MessagePart, mimeType string) []byte {
+	if part == nil {
+		return nil
+	}
+	var body []byte
+	if part.MimeType == mimeType && part.Filename == "" && part.Body != nil && part.Body.Data != "" {
+		if data, err := base64.URLEncoding.DecodeString(part.Body.Data); err == nil {
+			body = append(body, data...)
+		}
+	}
+	for _, subPart := range part.Parts {
+		body = append(body, bodyData(subPart, mimeType)...)
+	}
+	return body
+}
+
+// bodyText is the text of a message fetched in full format, for matching body
+// keywords the way a Gmail search would.
+func bodyText(payload *gmail.MessagePart) string {
+	body := &mailparse.Message{
+		TextBody: string(bodyData(payload, "text/plain")),
+		HTMLBody: bodyData(payload, "text/html"),
+	}
+	return body.PlainText()
+}
+
+func partHeader(part *gmail.MessagePart, name string) string {
+	for _, h := range part.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
@@ -3,16 +3,17 @@ package gmailservice
 import (
 	"context"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/felixsolom/fetch-duck/internal/database"
-	"github.com/google/uuid"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -32,12 +33,77 @@ func (s *Service) GetMessage(messageID string) (*gmail.Message, error) {
 	return s.Users.Messages.Get("me", messageID).Format("metadata").Do()
 }
 
-func (s *Service) ScanAndStageInvoices(ctx context.Context, db *database.Queries, userID string) error {
+// GetFullMessage returns the message with its whole MIME part tree. Attachment bodies
+// are only referenced by ID and have to be fetched separately.
+func (s *Service) GetFullMessage(messageID string) (*gmail.Message, error) {
+	return s.Users.Messages.Get("me", messageID).Format("full").Do()
+}
+
+// SourceName is recorded on every invoice staged from Gmail.
+const SourceName = "gmail"
+
+// labels of messages that history.list reports but a messages.list search would never return
+var ignoredHistoryLabels = map[string]bool{
+	"DRAFT": true,
+	"SPAM":  true,
+	"TRASH": true,
+}
+
+// a message that failed to stage this often is given up on
+const maxMessageAttempts = 5
+
+// ScanAndStageInvoices stages new invoice messages for the user. progress may be nil.
+// Gmail is scanned incrementally through the History API once a full scan has
+// recorded where the mailbox was.
+func (s *Service) ScanAndStageInvoices(ctx context.Context, db *database.Queries, userID string, criteria mailsource.SearchCriteria, progress mailsource.ProgressFunc) (mailsource.ScanStats, error) {
+	if criteria.IsEmpty() {
+		return mailsource.ScanStats{}, nil
+	}
+
+	syncState, err := db.GetGmailSyncState(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return mailsource.ScanStats{}, fmt.Errorf("failed to get gmail sync state: %w", err)
+	}
+	hasSyncState := err == nil
+
+	sc, err := mailsource.NewScan(ctx, db, userID, SourceName, criteria, progress)
+	if err != nil {
+		return mailsource.ScanStats{}, err
+	}
+
+	if err := s.retryFailedMessages(ctx, sc, criteria); err != nil {
+		return sc.Stats, err
+	}
+
+	if hasSyncState {
+		err = s.scanHistory(ctx, sc, criteria, uint64(syncState.HistoryID))
+		if err == nil {
+			return sc.Stats, nil
+		}
+		if !isHistoryExpired(err) {
+			return sc.Stats, err
+		}
+		log.Printf("History ID %d for user ID %s has expired. Falling back to a full scan", syncState.HistoryID, userID)
+	}
+
+	err = s.scanFull(ctx, sc, criteria)
+	return sc.Stats, err
+}
+
+// scanFull lists every message matching the criteria and records the mailbox history
+// ID so the next scan can be incremental.
+func (s *Service) scanFull(ctx context.Context, sc *mailsource.Scan, criteria mailsource.SearchCriteria) error {
 	user := "me"
-	query := `subject:(invoice OR receipt OR "bill from") OR "invoice" OR "receipt"`
 	pageToken := ""
 
-	log.Printf("Performing Gmail scan for user ID %s with query: %s", userID, query)
+	// the history ID is taken before listing so nothing that arrives mid-scan is missed
+	profile, err := s.Users.GetProfile(user).Do()
+	if err != nil {
+		return fmt.Errorf("failed to get gmail profile: %w", err)
+	}
+
+	query := buildQuery(criteria)
+	log.Printf("Performing full Gmail scan for user ID %s with query: %s", sc.UserID, query)
 	for {
 		req := s.Users.Messages.List(user).Q(query)
 		if pageToken != "" {
@@ -54,63 +120,74 @@ func (s *Service) ScanAndStageInvoices(ctx context.Context, db *database.Queries
 		}
 
 		for _, msg := range resp.Messages {
-			// is the message already staged
-			stagedInvoices, err := db.GetStagedInvoicesByMessageId(ctx, database.GetStagedInvoicesByMessageIdParams{
-				UserID:         userID,
-				GmailMessageID: msg.Id,
-			})
-
-			if err != nil {
-				log.Printf("Error checking for existing staged invoices %s: %v", msg.Id, err)
+			sc.Stats.Seen++
+			if sc.IsStaged(msg.Id) {
+				sc.Stats.Skipped++
 				continue
 			}
 
-			if len(stagedInvoices) > 0 {
-				log.Printf("Message %s already staged. Skipping", msg.Id)
-				continue
+			if err := s.stageOrRecord(ctx, sc, criteria, nil, msg.Id, false); err != nil {
+				return err
 			}
+		}
+		sc.ReportProgress()
 
-			fullMsg, err := s.Users.Messages.Get("me", msg.Id).Format("metadata").Do()
-			if err != nil {
-				log.Printf("Failed to get message metadata for %s: %v", msg.Id, err)
-				continue
-			}
+		if resp.NextPageToken != "" {
+			pageToken = resp.NextPageToken
+		} else {
+			break
+		}
+	}
+	log.Println("Finished scanning all pages")
 
-			var sender, subject string
-			for _, h := range fullMsg.Payload.Headers {
-				if h.Name == "From" {
-					sender = h.Value
+	return saveHistoryID(ctx, sc.DB, sc.UserID, profile.HistoryId)
+}
+
+// scanHistory processes only the messages added to the mailbox since startHistoryID.
+func (s *Service) scanHistory(ctx context.Context, sc *mailsource.Scan, criteria mailsource.SearchCriteria, startHistoryID uint64) error {
+	user := "me"
+	pageToken := ""
+	latestHistoryID := startHistoryID
+
+	labelNames, err := s.labelNamesFor(criteria)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Performing incremental Gmail scan for user ID %s from history ID %d", sc.UserID, startHistoryID)
+	for {
+		req := s.Users.History.List(user).StartHistoryId(startHistoryID).HistoryTypes("messageAdded")
+		if pageToken != "" {
+			req.PageToken(pageToken)
+		}
+		resp, err := req.Do()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve a page of history: %w", err)
+		}
+
+		if resp.HistoryId > latestHistoryID {
+			latestHistoryID = resp.HistoryId
+		}
+
+		for _, h := range resp.History {
+			for _, added := range h.MessagesAdded {
+				msg := added.Message
+				if msg == nil {
+					continue
 				}
-				if h.Name == "Subject" {
-					subject = h.Value
+				sc.Stats.Seen++
+				if sc.IsStaged(msg.Id) || hasIgnoredLabel(msg.LabelIds) {
+					sc.Stats.Skipped++
+					continue
 				}
-			}
 
-			receivedAt := fullMsg.InternalDate / 1000
-			now := time.Now().Unix()
-
-			_, err = db.CreateStagedInvoice(ctx, database.CreateStagedInvoiceParams{
-				ID:             uuid.New().String(),
-				UserID:         userID,
-				GmailMessageID: fullMsg.Id,
-				GmailThreadID:  fullMsg.ThreadId,
-				Sender:         sender,
-				Subject:        subject,
-				Snippet: sql.NullString{
-					String: fullMsg.Snippet,
-					Valid:  true,
-				},
-				HasAttachment: len(fullMsg.Payload.Parts) > 1,
-				ReceivedAt:    receivedAt,
-				CreatedAt:     now,
-				UpdatedAt:     now,
-			})
-			if err != nil {
-				log.Printf("Failed to create staged invoice for message %s: %v", msg.Id, err)
-				continue
+				// history.list can't be filtered server side
+				if err := s.stageOrRecord(ctx, sc, criteria, labelNames, msg.Id, true); err != nil {
+					return err
+				}
 			}
-			log.Printf("Successfully staged message for %s with subject: %s", sender, subject)
 		}
+		sc.ReportProgress()
 
 		if resp.NextPageToken != "" {
 			pageToken = resp.NextPageToken
@@ -118,48 +195,204 @@ func (s *Service) ScanAndStageInvoices(ctx context.Context, db *database.Queries
 			break
 		}
 	}
-	log.Println("Finished scanning all pages")
-	return nil
+	log.Println("Finished scanning history")
+
+	return saveHistoryID(ctx, sc.DB, sc.UserID, latestHistoryID)
 }
 
-func (s *Service) GetFirstAttachment(messageID string) (data []byte, filenane string, err error) {
-	fullMsg, err := s.Users.Messages.Get("me", messageID).Format("full").Do()
+// stageMessage fetches and stages one message, matching it against the criteria first
+// when Gmail didn't.
+func (s *Service) stageMessage(ctx context.Context, sc *mailsource.Scan, criteria mailsource.SearchCriteria, labelNames map[string]string, messageID string, needsMatch bool) error {
+	fullMsg, err := s.GetFullMessage(messageID)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get full message")
+		return fmt.Errorf("failed to get message metadata: %w", err)
 	}
 
-	part, attachmentID := findAttachmemtPart(fullMsg.Payload)
-	if part == nil {
-		return nil, "", errors.New("no valid attachments found in message")
+	message := toMessage(fullMsg)
+	if needsMatch {
+		message.Labels = resolveLabels(message.Labels, labelNames)
+		if !criteria.Matches(message) {
+			sc.Stats.Skipped++
+			return nil
+		}
 	}
+	return sc.Stage(ctx, message)
+}
 
-	attachmentBody, err := s.Users.Messages.Attachments.Get("me", messageID, attachmentID).Do()
+// stageOrRecord stages the message or records it for the next scan to retry, so the
+// history cursor can move past it.
+func (s *Service) stageOrRecord(ctx context.Context, sc *mailsource.Scan, criteria mailsource.SearchCriteria, labelNames map[string]string, messageID string, needsMatch bool) error {
+	err := s.stageMessage(ctx, sc, criteria, labelNames, messageID, needsMatch)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get attachment data for ID %w", err)
+		return recordFailure(ctx, sc, messageID, needsMatch, err)
 	}
+	return nil
+}
+
+// recordFailure only returns an error when the failure couldn't be recorded, the scan
+// has to stop then before the cursor skips the message for good.
+func recordFailure(ctx context.Context, sc *mailsource.Scan, messageID string, needsMatch bool, stageErr error) error {
+	log.Printf("Failed to stage message %s, retrying on the next scan: %v", messageID, stageErr)
+	sc.Fail(messageID, stageErr)
 
-	decodedData, err := base64.URLEncoding.DecodeString(attachmentBody.Data)
+	now := time.Now().Unix()
+	err := sc.DB.RecordGmailFailedMessage(ctx, database.RecordGmailFailedMessageParams{
+		UserID:     sc.UserID,
+		MessageID:  messageID,
+		NeedsMatch: needsMatch,
+		LastError:  stageErr.Error(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to decode attachment data %w", err)
+		return fmt.Errorf("failed to record failed message %s: %w", messageID, err)
 	}
-
-	return decodedData, part.Filename, nil
+	return nil
 }
 
-func findAttachmemtPart(part *gmail.MessagePart) (*gmail.MessagePart, string) {
-	if part.Filename != "" && part.Body != nil && part.Body.AttachmentId != "" {
-		return part, part.Body.AttachmentId
+// retryFailedMessages gives the messages earlier scans couldn't stage another go,
+// up to maxMessageAttempts each.
+func (s *Service) retryFailedMessages(ctx context.Context, sc *mailsource.Scan, criteria mailsource.SearchCriteria) error {
+	failed, err := sc.DB.ListGmailFailedMessages(ctx, database.ListGmailFailedMessagesParams{
+		UserID:   sc.UserID,
+		Attempts: maxMessageAttempts,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list failed messages: %w", err)
+	}
+	if len(failed) == 0 {
+		return nil
 	}
 
-	if len(part.Parts) > 0 {
-		for _, subPart := range part.Parts {
-			foundPart, attachmentID := findAttachmemtPart(subPart)
-			if foundPart != nil {
-				log.Printf("Found valid Email attachment in parts: %s", attachmentID)
-				return foundPart, attachmentID
+	labelNames, err := s.labelNamesFor(criteria)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Retrying %d messages earlier scans failed to stage for user ID %s", len(failed), sc.UserID)
+	for _, msg := range failed {
+		sc.Stats.Seen++
+		if sc.IsStaged(msg.MessageID) {
+			sc.Stats.Skipped++
+		} else if stageErr := s.stageMessage(ctx, sc, criteria, labelNames, msg.MessageID, msg.NeedsMatch); stageErr != nil {
+			if err := recordFailure(ctx, sc, msg.MessageID, msg.NeedsMatch, stageErr); err != nil {
+				return err
 			}
+			continue
+		}
+
+		err := sc.DB.DeleteGmailFailedMessage(ctx, database.DeleteGmailFailedMessageParams{
+			UserID:    sc.UserID,
+			MessageID: msg.MessageID,
+		})
+		if err != nil {
+			log.Printf("Failed to clear retried message %s: %v", msg.MessageID, err)
+		}
+	}
+	sc.ReportProgress()
+	return nil
+}
+
+// labelNamesFor loads the label names when the criteria have label rules, messages
+// only carry label IDs but rules are written with names.
+func (s *Service) labelNamesFor(criteria mailsource.SearchCriteria) (map[string]string, error) {
+	if len(criteria.IncludeLabels) == 0 && len(criteria.ExcludeLabels) == 0 {
+		return nil, nil
+	}
+	return s.labelNames()
+}
+
+// toMessage converts a message fetched in full format.
+func toMessage(fullMsg *gmail.Message) *mailsource.Message {
+	var attachments []mailsource.Attachment
+	for _, attachment := range findAttachmentParts(fullMsg.Payload) {
+		attachments = append(attachments, mailsource.Attachment{
+			PartID:   attachment.PartID,
+			Filename: attachment.Filename,
+			MimeType: attachment.MimeType,
+			Size:     attachment.Size,
+		})
+	}
+
+	return &mailsource.Message{
+		ID:                fullMsg.Id,
+		ThreadID:          fullMsg.ThreadId,
+		InternetMessageID: strings.TrimSpace(getHeader(fullMsg, "Message-ID")),
+		From:              getHeader(fullMsg, "From"),
+		Subject:           getHeader(fullMsg, "Subject"),
+		Snippet:           fullMsg.Snippet,
+		Body:              bodyText(fullMsg.Payload),
+		Labels:            fullMsg.LabelIds,
+		ListUnsubscribe:   getHeader(fullMsg, "List-Unsubscribe") != "",
+		ReceivedAt:        time.UnixMilli(fullMsg.InternalDate),
+		Attachments:       attachments,
+	}
+}
+
+func getHeader(msg *gmail.Message, name string) string {
+	if msg.Payload == nil {
+		return ""
+	}
+	for _, h := range msg.Payload.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
 		}
 	}
-	log.Printf("No valid attachments were found in parts")
-	return nil, ""
+	return ""
+}
+
+func (s *Service) labelNames() (map[string]string, error) {
+	resp, err := s.Users.Labels.List("me").Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list gmail labels: %w", err)
+	}
+	names := make(map[string]string, len(resp.Labels))
+	for _, label := range resp.Labels {
+		names[label.Id] = label.Name
+	}
+	return names, nil
+}
+
+// resolveLabels swaps label IDs for names, unknown IDs are kept as they are.
+func resolveLabels(labelIDs []string, names map[string]string) []string {
+	if names == nil {
+		return labelIDs
+	}
+	resolved := make([]string, len(labelIDs))
+	for i, id := range labelIDs {
+		resolved[i] = id
+		if name, ok := names[id]; ok {
+			resolved[i] = name
+		}
+	}
+	return resolved
+}
+
+func hasIgnoredLabel(labelIDs []string) bool {
+	for _, label := range labelIDs {
+		if ignoredHistoryLabels[label] {
+			return true
+		}
+	}
+	return false
+}
+
+// Gmail answers history.list with 404 once the start history ID is too old to be served.
+func isHistoryExpired(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func saveHistoryID(ctx context.Context, db *database.Queries, userID string, historyID uint64) error {
+	now := time.Now().Unix()
+	err := db.UpsertGmailSyncState(ctx, database.UpsertGmailSyncStateParams{
+		UserID:    userID,
+		HistoryID: int64(historyID),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save gmail history ID: %w", err)
+	}
+	return nil
 }
@@ -1,18 +1,20 @@
 package gmailservice
 
 import (
+	"encoding/base64"
 	"testing"
+	"time"
 
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
 	"google.golang.org/api/gmail/v1"
 )
 
-func TestFindAttachmentPart(t *testing.T) {
+func TestFindAttachmentParts(t *testing.T) {
 	testCases := []struct {
-		name             string
-		payload          *gmail.MessagePart
-		expectedFound    bool
-		expectedID       string
-		expectedFilename string
+		name              string
+		payload           *gmail.MessagePart
+		expectedIDs       []string
+		expectedFilenames []string
 	}{
 		{
 			name: "Simple Case - Top Level Attachment",
@@ -22,9 +24,8 @@ func TestFindAttachmentPart(t *testing.T) {
 					{Filename: "", Body: &gmail.MessagePartBody{}},
 				},
 			},
-			expectedFound:    true,
-			expectedID:       "ATTACH_ID_1",
-			expectedFilename: "invoice.pdf",
+			expectedIDs:       []string{"ATTACH_ID_1"},
+			expectedFilenames: []string{"invoice.pdf"},
 		},
 		{
 			name: "Nested Case - Attachment inside multipart/mixed",
@@ -42,9 +43,8 @@ func TestFindAttachmentPart(t *testing.T) {
 					},
 				},
 			},
-			expectedFound:    true,
-			expectedID:       "ATTACH_ID_2",
-			expectedFilename: "receipt.pdf",
+			expectedIDs:       []string{"ATTACH_ID_2"},
+			expectedFilenames: []string{"receipt.pdf"},
 		},
 		{
 			name: "Deeply Nested Case",
@@ -61,9 +61,57 @@ func TestFindAttachmentPart(t *testing.T) {
 					},
 				},
 			},
-			expectedFound:    true,
-			expectedID:       "ATTACH_ID_3",
-			expectedFilename: "deep-invoice.pdf",
+			expectedIDs:       []string{"ATTACH_ID_3"},
+			expectedFilenames: []string{"deep-invoice.pdf"},
+		},
+		{
+			name: "Multiple Attachments",
+			payload: &gmail.MessagePart{
+				Parts: []*gmail.MessagePart{
+					{Filename: "", Body: &gmail.MessagePartBody{}},
+					{Filename: "invoice.pdf", Body: &gmail.MessagePartBody{AttachmentId: "ATTACH_ID_4"}},
+					{
+						Parts: []*gmail.MessagePart{
+							{Filename: "receipt.pdf", Body: &gmail.MessagePartBody{AttachmentId: "ATTACH_ID_5"}},
+						},
+					},
+				},
+			},
+			expectedIDs:       []string{"ATTACH_ID_4", "ATTACH_ID_5"},
+			expectedFilenames: []string{"invoice.pdf", "receipt.pdf"},
+		},
+		{
+			name: "Inline Logo and Unsupported Types Ignored",
+			payload: &gmail.MessagePart{
+				Parts: []*gmail.MessagePart{
+					{
+						MimeType: "multipart/related",
+						Parts: []*gmail.MessagePart{
+							{MimeType: "text/html", Body: &gmail.MessagePartBody{Data: base64.URLEncoding.EncodeToString([]byte(`<img src="cid:logo@acme">`))}},
+							{
+								Filename: "logo.png",
+								MimeType: "image/png",
+								Headers:  []*gmail.MessagePartHeader{{Name: "Content-ID", Value: "<logo@acme>"}},
+								Body:     &gmail.MessagePartBody{AttachmentId: "LOGO_ID"},
+							},
+						},
+					},
+					{Filename: "invite.ics", MimeType: "text/calendar", Body: &gmail.MessagePartBody{AttachmentId: "ICS_ID"}},
+					{Filename: "scan.jpg", MimeType: "image/jpeg", Body: &gmail.MessagePartBody{AttachmentId: "SCAN_ID"}},
+					{
+						Filename: "photo.jpg",
+						MimeType: "image/jpeg",
+						Headers: []*gmail.MessagePartHeader{
+							{Name: "Content-Disposition", Value: "attachment; filename=\"photo.jpg\""},
+							{Name: "Content-ID", Value: "<ii_m1>"},
+						},
+						Body: &gmail.MessagePartBody{AttachmentId: "PHOTO_ID"},
+					},
+					{Filename: "INVOICE.PDF", MimeType: "application/octet-stream", Body: &gmail.MessagePartBody{AttachmentId: "PDF_ID"}},
+				},
+			},
+			expectedIDs:       []string{"SCAN_ID", "PHOTO_ID", "PDF_ID"},
+			expectedFilenames: []string{"scan.jpg", "photo.jpg", "INVOICE.PDF"},
 		},
 		{
 			name: "No Attachment Case",
@@ -73,30 +121,127 @@ func TestFindAttachmentPart(t *testing.T) {
 					{Filename: "inline-image.jpg", Body: &gmail.MessagePartBody{AttachmentId: ""}},
 				},
 			},
-			expectedFound: false,
 		},
 		{
-			name:          "Empty Payload",
-			payload:       &gmail.MessagePart{},
-			expectedFound: false,
+			name:    "Empty Payload",
+			payload: &gmail.MessagePart{},
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			foundPart, foundID := findAttachmemtPart(tc.payload)
-			if (foundPart != nil) != tc.expectedFound {
-				t.Errorf("expected to find attachment: %v, but got: %v", tc.expectedFound, (foundPart != nil))
+			found := findAttachmentParts(tc.payload)
+			if len(found) != len(tc.expectedIDs) {
+				t.Fatalf("expected %d attachments, but got: %d", len(tc.expectedIDs), len(found))
 			}
 
-			if tc.expectedFound {
-				if foundID != tc.expectedID {
-					t.Errorf("expected attachment ID %s, but got %s", tc.expectedID, foundID)
+			for i, attachment := range found {
+				if attachment.AttachmentID != tc.expectedIDs[i] {
+					t.Errorf("expected attachment ID %s, but got %s", tc.expectedIDs[i], attachment.AttachmentID)
 				}
-				if foundPart.Filename != tc.expectedFilename {
-					t.Errorf("expected filename %s, but got %s", tc.expectedFilename, foundPart.Filename)
+				if attachment.Filename != tc.expectedFilenames[i] {
+					t.Errorf("expected filename %s, but got %s", tc.expectedFilenames[i], attachment.Filename)
 				}
 			}
 		})
 	}
 }
+
+func TestBodyText(t *testing.T) {
+	encode := func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) }
+	testCases := []struct {
+		name     string
+		payload  *gmail.MessagePart
+		expected string
+	}{
+		{
+			name: "Plain Part Preferred",
+			payload: &gmail.MessagePart{
+				MimeType: "multipart/alternative",
+				Parts: []*gmail.MessagePart{
+					{MimeType: "text/plain", Body: &gmail.MessagePartBody{Data: encode("Your receipt")}},
+					{MimeType: "text/html", Body: &gmail.MessagePartBody{Data: encode("<p>Your <b>receipt</b></p>")}},
+				},
+			},
+			expected: "Your receipt",
+		},
+		{
+			name: "HTML Only",
+			payload: &gmail.MessagePart{
+				MimeType: "text/html",
+				Body:     &gmail.MessagePartBody{Data: encode("<p>Tax invoice</p><p>Total 100</p>")},
+			},
+			expected: "Tax invoice\nTotal 100",
+		},
+		{
+			name: "Attached Text Ignored",
+			payload: &gmail.MessagePart{
+				MimeType: "multipart/mixed",
+				Parts: []*gmail.MessagePart{
+					{MimeType: "text/plain", Filename: "notes.txt", Body: &gmail.MessagePartBody{Data: encode("invoice")}},
+				},
+			},
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := bodyText(tc.payload); got != tc.expected {
+				t.Errorf("expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		criteria mailsource.SearchCriteria
+		expected string
+	}{
+		{
+			name: "Keywords Only",
+			criteria: mailsource.SearchCriteria{
+				SubjectKeywords: []string{"invoice", "receipt", "bill from"},
+				BodyKeywords:    []string{"invoice", "receipt"},
+			},
+			expected: `subject:(invoice OR receipt OR "bill from") OR "invoice" OR "receipt"`,
+		},
+		{
+			name:     "Hebrew Defaults",
+			criteria: mailsource.InvoiceCriteria,
+			expected: `subject:(invoice OR receipt OR "bill from" OR חשבונית OR קבלה) OR "invoice" OR "receipt" OR "חשבונית" OR "קבלה"`,
+		},
+		{
+			name: "Senders Labels And Date",
+			criteria: mailsource.SearchCriteria{
+				SubjectKeywords: []string{"invoice"},
+				AllowedSenders:  []string{"billing@acme.com", "@paddle.com"},
+				BlockedSenders:  []string{"news.example.com"},
+				IncludeLabels:   []string{"Receipts", "Work/Bills"},
+				ExcludeLabels:   []string{"CATEGORY_PROMOTIONS"},
+				After:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expected: `(subject:(invoice) OR from:(billing@acme.com OR paddle.com)) -from:(news.example.com) (label:receipts OR label:work-bills) -label:category_promotions after:1704067200`,
+		},
+		{
+			name:     "Body Only",
+			criteria: mailsource.SearchCriteria{BodyKeywords: []string{"tax invoice"}},
+			expected: `"tax invoice"`,
+		},
+		{
+			name:     "Quotes Stripped",
+			criteria: mailsource.SearchCriteria{SubjectKeywords: []string{`"order" confirmation`}},
+			expected: `subject:("order confirmation")`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := buildQuery(tc.criteria); got != tc.expected {
+				t.Errorf("expected query %s, but got %s", tc.expected, got)
+			}
+		})
+	}
+}
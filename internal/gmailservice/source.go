@@ -0,0 +1,137 @@
+package gmailservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"google.golang.org/api/gmail/v1"
+)
+
+var _ mailsource.MailSource = (*Service)(nil)
+
+func (s *Service) Name() string {
+	return SourceName
+}
+
+// Search returns the IDs of the messages matching the criteria, newest first.
+func (s *Service) Search(ctx context.Context, criteria mailsource.SearchCriteria, limit int) ([]string, error) {
+	if criteria.IsEmpty() {
+		return nil, nil
+	}
+
+	var messageIDs []string
+	errLimitReached := errors.New("limit reached")
+	req := s.Users.Messages.List("me").Q(buildQuery(criteria))
+	err := req.Pages(ctx, func(resp *gmail.ListMessagesResponse) error {
+		for _, msg := range resp.Messages {
+			messageIDs = append(messageIDs, msg.Id)
+			if limit > 0 && len(messageIDs) >= limit {
+				return errLimitReached
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errLimitReached {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return messageIDs, nil
+}
+
+func (s *Service) GetMetadata(ctx context.Context, messageID string) (*mailsource.Message, error) {
+	fullMsg, err := s.GetFullMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	return toMessage(fullMsg), nil
+}
+
+// GetAttachment looks the part up again since attachment IDs change between fetches.
+func (s *Service) GetAttachment(ctx context.Context, messageID, partID string) ([]byte, error) {
+	attachments, err := s.ListAttachments(messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if attachment.PartID == partID {
+			return s.GetAttachmentData(messageID, attachment.AttachmentID)
+		}
+	}
+	return nil, fmt.Errorf("part %s is no longer in message %s", partID, messageID)
+}
+
+func (s *Service) GetRaw(ctx context.Context, messageID string) ([]byte, error) {
+	return s.GetRawMessage(messageID)
+}
+
+// buildQuery compiles the criteria into a Gmail search query, e.g.
+// subject:(invoice OR receipt OR "bill from") OR "invoice" OR "receipt"
+// Filters are added after the keywords, which are then put in parentheses.
+func buildQuery(criteria mailsource.SearchCriteria) string {
+	var terms []string
+	if len(criteria.SubjectKeywords) > 0 {
+		terms = append(terms, "subject:"+joinTerms(criteria.SubjectKeywords, false))
+	}
+	for _, keyword := range criteria.BodyKeywords {
+		terms = append(terms, quoteTerm(keyword, true))
+	}
+	if len(criteria.AllowedSenders) > 0 {
+		terms = append(terms, "from:"+joinTerms(senderTerms(criteria.AllowedSenders), false))
+	}
+	query := strings.Join(terms, " OR ")
+
+	var filters []string
+	if len(criteria.BlockedSenders) > 0 {
+		filters = append(filters, "-from:"+joinTerms(senderTerms(criteria.BlockedSenders), false))
+	}
+	if len(criteria.IncludeLabels) > 0 {
+		labels := make([]string, len(criteria.IncludeLabels))
+		for i, label := range criteria.IncludeLabels {
+			labels[i] = "label:" + mailsource.NormalizeLabel(label)
+		}
+		if len(labels) == 1 {
+			filters = append(filters, labels[0])
+		} else {
+			filters = append(filters, "("+strings.Join(labels, " OR ")+")")
+		}
+	}
+	for _, label := range criteria.ExcludeLabels {
+		filters = append(filters, "-label:"+mailsource.NormalizeLabel(label))
+	}
+	if !criteria.After.IsZero() {
+		filters = append(filters, fmt.Sprintf("after:%d", criteria.After.Unix()))
+	}
+
+	if len(filters) == 0 {
+		return query
+	}
+	return "(" + query + ") " + strings.Join(filters, " ")
+}
+
+func joinTerms(values []string, alwaysQuote bool) string {
+	terms := make([]string, len(values))
+	for i, value := range values {
+		terms[i] = quoteTerm(value, alwaysQuote)
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+func senderTerms(senders []string) []string {
+	terms := make([]string, len(senders))
+	for i, sender := range senders {
+		terms[i] = strings.TrimPrefix(sender, "@")
+	}
+	return terms
+}
+
+// quoteTerm quotes phrases, and single words too when always is set so Gmail matches
+// them exactly instead of stemming.
+func quoteTerm(term string, always bool) string {
+	term = strings.ReplaceAll(term, `"`, "")
+	if always || strings.ContainsAny(term, " \t") {
+		return `"` + term + `"`
+	}
+	return term
+}
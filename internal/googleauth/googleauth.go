@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/tokencrypt"
 	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 )
@@ -50,7 +51,7 @@ func GetGoogleUserInfo(client *http.Client) (*GoogleUserInfo, error) {
 	return &userInfo, nil
 }
 
-func StoreTokenInDB(ctx context.Context, db *database.Queries, userInfo *GoogleUserInfo, token *oauth2.Token) (string, error) {
+func StoreTokenInDB(ctx context.Context, db *database.Queries, keyring *tokencrypt.Keyring, userInfo *GoogleUserInfo, token *oauth2.Token) (string, error) {
 	now := time.Now().Unix()
 
 	existingUser, err := db.GetUser(ctx, userInfo.Email)
@@ -76,10 +77,28 @@ func StoreTokenInDB(ctx context.Context, db *database.Queries, userInfo *GoogleU
 		}
 	}
 
+	if err := upsertToken(ctx, db, keyring, existingUser.ID, token); err != nil {
+		return "", err
+	}
+	return existingUser.ID, nil
+}
+
+// upsertToken encrypts both tokens before they reach google_auths.
+func upsertToken(ctx context.Context, db *database.Queries, keyring *tokencrypt.Keyring, userID string, token *oauth2.Token) error {
+	accessToken, err := keyring.Encrypt(token.AccessToken, userID)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	refreshToken, err := keyring.Encrypt(token.RefreshToken, userID)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+
+	now := time.Now().Unix()
 	params := database.UpsertGoogleAuthParams{
-		UserID:       existingUser.ID,
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
+		UserID:       userID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 		TokenExpiry:  token.Expiry.Unix(),
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -87,9 +106,54 @@ func StoreTokenInDB(ctx context.Context, db *database.Queries, userInfo *GoogleU
 
 	err = db.UpsertGoogleAuth(ctx, params)
 	if err != nil {
-		return "", fmt.Errorf("failed to upsert token: %w", err)
+		return fmt.Errorf("failed to upsert token: %w", err)
 	}
-	return existingUser.ID, nil
+	return nil
+}
+
+// ReencryptTokens rewrites every stored token that is still plaintext or sealed with
+// an older key so it uses the keyring's current key. It returns how many rows changed.
+func ReencryptTokens(ctx context.Context, db *database.Queries, keyring *tokencrypt.Keyring) (int, error) {
+	rows, err := db.ListGoogleAuthTokens(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list google auths: %w", err)
+	}
+
+	updated := 0
+	for _, row := range rows {
+		if !keyring.NeedsRotation(row.AccessToken) && !keyring.NeedsRotation(row.RefreshToken) {
+			continue
+		}
+
+		accessToken, err := rotate(keyring, row.AccessToken, row.UserID)
+		if err != nil {
+			return updated, fmt.Errorf("failed to re-encrypt access token for user ID %s: %w", row.UserID, err)
+		}
+		refreshToken, err := rotate(keyring, row.RefreshToken, row.UserID)
+		if err != nil {
+			return updated, fmt.Errorf("failed to re-encrypt refresh token for user ID %s: %w", row.UserID, err)
+		}
+
+		err = db.UpdateGoogleAuthTokens(ctx, database.UpdateGoogleAuthTokensParams{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			UpdatedAt:    time.Now().Unix(),
+			UserID:       row.UserID,
+		})
+		if err != nil {
+			return updated, fmt.Errorf("failed to update tokens for user ID %s: %w", row.UserID, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func rotate(keyring *tokencrypt.Keyring, value, userID string) (string, error) {
+	plaintext, err := keyring.Decrypt(value, userID)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Encrypt(plaintext, userID)
 }
 
 func GenerateOauthStateString(w http.ResponseWriter, r *http.Request) string {
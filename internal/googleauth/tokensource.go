@@ -0,0 +1,105 @@
+package googleauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/tokencrypt"
+	"golang.org/x/oauth2"
+)
+
+// ErrReauthRequired is returned when Google has revoked or expired the stored refresh token
+// and the user has to go through the OAuth flow again.
+var ErrReauthRequired = errors.New("google authorization has expired, user must log in again")
+
+// dbTokenSource refreshes tokens through the oauth2 config and writes every rotated token
+// back to google_auths, so the next client built for the user starts from it.
+type dbTokenSource struct {
+	db      *database.Queries
+	keyring *tokencrypt.Keyring
+	userID  string
+	base    oauth2.TokenSource
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func NewDBTokenSource(ctx context.Context, config *oauth2.Config, db *database.Queries, keyring *tokencrypt.Keyring, userID string) (oauth2.TokenSource, error) {
+	dbAuth, err := db.GetGoogleAuthByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get google auth for user: %w", err)
+	}
+	if dbAuth.NeedsReauth {
+		return nil, ErrReauthRequired
+	}
+
+	accessToken, err := keyring.Decrypt(dbAuth.AccessToken, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	refreshToken, err := keyring.Decrypt(dbAuth.RefreshToken, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expiry:       time.Unix(dbAuth.TokenExpiry, 0),
+		TokenType:    "Bearer",
+	}
+
+	return &dbTokenSource{
+		db:      db,
+		keyring: keyring,
+		userID:  userID,
+		// refreshes outlive the request that created the client
+		base: config.TokenSource(context.Background(), token),
+		last: token,
+	}, nil
+}
+
+func (s *dbTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.base.Token()
+	if err != nil {
+		if isInvalidGrant(err) {
+			log.Printf("Refresh token for user ID %s was rejected, marking for re-authorization", s.userID)
+			markErr := s.db.MarkGoogleAuthNeedsReauth(context.Background(), database.MarkGoogleAuthNeedsReauthParams{
+				UpdatedAt: time.Now().Unix(),
+				UserID:    s.userID,
+			})
+			if markErr != nil {
+				log.Printf("Failed to mark user ID %s for re-authorization: %v", s.userID, markErr)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrReauthRequired, err)
+		}
+		return nil, err
+	}
+
+	if token.AccessToken == s.last.AccessToken {
+		return token, nil
+	}
+
+	err = upsertToken(context.Background(), s.db, s.keyring, s.userID, token)
+	if err != nil {
+		// the token is still good for this client, the next one will just refresh again
+		log.Printf("Warning: failed to persist refreshed token for user ID %s: %v", s.userID, err)
+	} else {
+		log.Printf("Persisted refreshed Google token for user ID %s", s.userID)
+	}
+	s.last = token
+	return token, nil
+}
+
+func isInvalidGrant(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant"
+}
@@ -0,0 +1,269 @@
+package imapservice
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long a single command may take when the context has no earlier deadline
+const commandTimeout = 2 * time.Minute
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Mailbox  string
+	// TLSConfig is optional, the default verifies the server certificate against Host.
+	TLSConfig *tls.Config
+}
+
+// Client is a minimal IMAP4rev1 client over implicit TLS. It only knows the handful of
+// commands needed to search a mailbox and download messages, and opens the mailbox
+// read only so scanning never changes the \Seen flags.
+type Client struct {
+	mailbox string
+
+	mu          sync.Mutex
+	conn        net.Conn
+	r           *bufio.Reader
+	tagNum      int
+	uidValidity uint32
+}
+
+// response is one line from the server. Literals are cut out of the line and replaced
+// by their "{n}" announcement.
+type response struct {
+	line     string
+	literals [][]byte
+}
+
+// Dial connects, logs in and selects the configured mailbox.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: cfg.Host}
+	}
+	mailbox := cfg.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Host, err)
+	}
+
+	c := &Client{
+		mailbox: mailbox,
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+	}
+
+	c.setDeadline(ctx)
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") && !strings.HasPrefix(greeting.line, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting.line)
+	}
+
+	if _, err := c.command(ctx, "LOGIN", cfg.Username, cfg.Password); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to log in: %w", err)
+	}
+
+	untagged, err := c.command(ctx, "EXAMINE", mailbox)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open mailbox %s: %w", mailbox, err)
+	}
+	for _, resp := range untagged {
+		if v, ok := responseCode(resp.line, "UIDVALIDITY"); ok {
+			validity, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("invalid UIDVALIDITY %q", v)
+			}
+			c.uidValidity = uint32(validity)
+		}
+	}
+	return c, nil
+}
+
+// Close logs out and closes the connection.
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.command(ctx, "LOGOUT")
+	return c.conn.Close()
+}
+
+// command sends one command and returns its untagged responses once the server has
+// completed it. Strings are sent quoted, or as literals when quoting can't carry them.
+func (c *Client) command(ctx context.Context, name string, args ...any) ([]response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tagNum++
+	tag := fmt.Sprintf("A%04d", c.tagNum)
+	c.setDeadline(ctx)
+
+	var buf strings.Builder
+	buf.WriteString(tag + " " + name)
+	for _, arg := range args {
+		buf.WriteByte(' ')
+		switch v := arg.(type) {
+		case atom:
+			buf.WriteString(string(v))
+		case string:
+			if !quotable(v) {
+				if err := c.sendLiteral(&buf, []byte(v)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			buf.WriteString(quote(v))
+		default:
+			return nil, fmt.Errorf("unsupported argument type %T", arg)
+		}
+	}
+	buf.WriteString("\r\n")
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return nil, err
+	}
+
+	var untagged []response
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(resp.line, tag+" ") {
+			status := strings.TrimPrefix(resp.line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("%s failed: %s", name, status)
+			}
+			return untagged, nil
+		}
+		if strings.HasPrefix(resp.line, "* BYE") {
+			return nil, fmt.Errorf("server closed the connection: %s", resp.line)
+		}
+		untagged = append(untagged, resp)
+	}
+}
+
+// atom is sent exactly as given.
+type atom string
+
+// sendLiteral flushes what is buffered so far followed by the literal announcement,
+// waits for the server to ask for the data and sends it.
+func (c *Client) sendLiteral(buf *strings.Builder, data []byte) error {
+	fmt.Fprintf(buf, "{%d}\r\n", len(data))
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return err
+	}
+	buf.Reset()
+
+	resp, err := c.readResponse()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(resp.line, "+") {
+		return fmt.Errorf("server refused literal: %s", resp.line)
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+func (c *Client) readResponse() (response, error) {
+	var resp response
+	var line strings.Builder
+	for {
+		part, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		line.WriteString(part)
+
+		size, ok := literalSize(part)
+		if !ok {
+			break
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, data)
+	}
+	resp.line = line.String()
+	return resp, nil
+}
+
+func (c *Client) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(commandTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+}
+
+// literalSize reports the size of the literal announced at the end of a line.
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+	size, err := strconv.Atoi(line[open+1 : len(line)-1])
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// responseCode extracts the value of a response code such as [UIDVALIDITY 42].
+func responseCode(line, code string) (string, bool) {
+	start := strings.Index(line, "["+code+" ")
+	if start < 0 {
+		return "", false
+	}
+	rest := line[start+len(code)+2:]
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return "", false
+	}
+	return rest[:end], true
+}
+
+// quotable reports whether s can be sent as a quoted string, which only carries 7-bit
+// text without line breaks.
+func quotable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 0x7e || s[i] == '\r' || s[i] == '\n' || s[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,354 @@
+package imapservice
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+const testMessageWithPDF = "From: Acme Billing <billing@acme.example>\r\n" +
+	"Subject: =?UTF-8?B?15fXqdeR15XXoNeZ16o=?= Invoice 42\r\n" +
+	"Message-ID: <42@acme.example>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your invoice is attached.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/pdf; name=invoice-42.pdf\r\n" +
+	"Content-Disposition: attachment; filename=invoice-42.pdf\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--b1--\r\n"
+
+const testMessagePlain = "From: shop@example.com\r\n" +
+	"Subject: Your receipt\r\n" +
+	"Message-ID: <3@example.com>\r\n" +
+	"\r\n" +
+	"Thanks for your order.\r\n"
+
+// fakeServer speaks just enough IMAP over TLS for the client in this package.
+type fakeServer struct {
+	listener    net.Listener
+	uidValidity uint32
+	messages    map[uint32]string
+
+	mu       sync.Mutex
+	searches []string
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, Config) {
+	t.Helper()
+	cert, pool := selfSignedCert(t)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeServer{
+		listener:    listener,
+		uidValidity: 7,
+		messages: map[uint32]string{
+			3: testMessagePlain,
+			5: testMessageWithPDF,
+		},
+	}
+	go s.serve()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return s, Config{
+		Host:      "127.0.0.1",
+		Port:      addr.Port,
+		Username:  "duck@example.com",
+		Password:  `p"ss`,
+		TLSConfig: &tls.Config{RootCAs: pool},
+	}
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+
+	for {
+		line, err := readCommand(conn, r)
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(line, " ")
+
+		switch {
+		case strings.HasPrefix(command, "LOGIN "):
+			if command != `LOGIN "duck@example.com" "p\"ss"` {
+				fmt.Fprintf(conn, "%s NO invalid credentials\r\n", tag)
+				continue
+			}
+			fmt.Fprintf(conn, "%s OK logged in\r\n", tag)
+		case strings.HasPrefix(command, "EXAMINE "):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n* OK [UIDVALIDITY %d] UIDs valid\r\n%s OK [READ-ONLY] done\r\n", len(s.messages), s.uidValidity, tag)
+		case strings.HasPrefix(command, "UID SEARCH "):
+			s.mu.Lock()
+			s.searches = append(s.searches, command)
+			s.mu.Unlock()
+
+			var uids []int
+			for uid := range s.messages {
+				uids = append(uids, int(uid))
+			}
+			sort.Ints(uids)
+			var fields []string
+			for _, uid := range uids {
+				fields = append(fields, strconv.Itoa(uid))
+			}
+			fmt.Fprintf(conn, "* SEARCH %s\r\n%s OK search done\r\n", strings.Join(fields, " "), tag)
+		case strings.HasPrefix(command, "UID FETCH "):
+			uid, _ := strconv.Atoi(strings.Fields(command)[2])
+			raw, ok := s.messages[uint32(uid)]
+			if ok {
+				fmt.Fprintf(conn, "* 1 FETCH (UID %d INTERNALDATE \" 5-Mar-2025 10:30:00 +0200\" BODY[] {%d}\r\n%s)\r\n", uid, len(raw), raw)
+			}
+			fmt.Fprintf(conn, "%s OK fetch done\r\n", tag)
+		case command == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE logging out\r\n%s OK done\r\n", tag)
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+		}
+	}
+}
+
+// readCommand reads one command line, asking the client for every literal it announces
+// and inlining the literal as a quoted string.
+func readCommand(conn net.Conn, r *bufio.Reader) (string, error) {
+	var line strings.Builder
+	for {
+		part, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		size, ok := literalSize(part)
+		if !ok {
+			line.WriteString(part)
+			return line.String(), nil
+		}
+
+		line.WriteString(part[:strings.LastIndexByte(part, '{')])
+		fmt.Fprint(conn, "+ ready\r\n")
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		line.WriteString(quote(string(data)))
+	}
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestClientSearchAndFetch(t *testing.T) {
+	server, cfg := newFakeServer(t)
+	ctx := context.Background()
+
+	client, err := Dial(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	criteria := mailsource.SearchCriteria{
+		SubjectKeywords: []string{"invoice", "receipt", "bill from"},
+		BodyKeywords:    []string{"invoice", "receipt"},
+	}
+	ids, err := client.Search(ctx, criteria, 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if strings.Join(ids, ",") != "7:5,7:3" {
+		t.Errorf("expected newest first message IDs 7:5,7:3, but got %v", ids)
+	}
+
+	expectedSearch := `UID SEARCH OR OR OR OR SUBJECT "invoice" SUBJECT "receipt" SUBJECT "bill from" BODY "invoice" BODY "receipt"`
+	if server.searches[0] != expectedSearch {
+		t.Errorf("expected search %s, but got %s", expectedSearch, server.searches[0])
+	}
+
+	msg, err := client.GetMetadata(ctx, "7:5")
+	if err != nil {
+		t.Fatalf("failed to get metadata: %v", err)
+	}
+	if msg.Subject != "חשבונית Invoice 42" {
+		t.Errorf("expected decoded subject, but got %q", msg.Subject)
+	}
+	if msg.ThreadID != "<42@acme.example>" {
+		t.Errorf("expected Message-ID as thread ID, but got %q", msg.ThreadID)
+	}
+	if msg.Snippet != "Your invoice is attached." {
+		t.Errorf("unexpected snippet %q", msg.Snippet)
+	}
+	expectedDate := time.Date(2025, 3, 5, 8, 30, 0, 0, time.UTC)
+	if !msg.ReceivedAt.Equal(expectedDate) {
+		t.Errorf("expected received at %v, but got %v", expectedDate, msg.ReceivedAt)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "invoice-42.pdf" || msg.Attachments[0].MimeType != "application/pdf" {
+		t.Fatalf("unexpected attachments %+v", msg.Attachments)
+	}
+
+	data, err := client.GetAttachment(ctx, "7:5", msg.Attachments[0].PartID)
+	if err != nil {
+		t.Fatalf("failed to get attachment: %v", err)
+	}
+	if string(data) != "%PDF-1.4\n" {
+		t.Errorf("unexpected attachment data %q", data)
+	}
+
+	raw, err := client.GetRaw(ctx, "7:3")
+	if err != nil {
+		t.Fatalf("failed to get raw message: %v", err)
+	}
+	if string(raw) != testMessagePlain {
+		t.Errorf("raw message does not match")
+	}
+}
+
+func TestClientSearchNonASCII(t *testing.T) {
+	server, cfg := newFakeServer(t)
+	ctx := context.Background()
+
+	client, err := Dial(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.Search(ctx, mailsource.SearchCriteria{SubjectKeywords: []string{"חשבונית", "invoice"}}, 0)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+
+	expected := `UID SEARCH CHARSET UTF-8 OR SUBJECT "חשבונית" SUBJECT "invoice"`
+	if server.searches[0] != expected {
+		t.Errorf("expected search %s, but got %s", expected, server.searches[0])
+	}
+}
+
+func TestClientSearchFilters(t *testing.T) {
+	server, cfg := newFakeServer(t)
+	ctx := context.Background()
+
+	client, err := Dial(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	ids, err := client.Search(ctx, mailsource.SearchCriteria{
+		SubjectKeywords: []string{"invoice"},
+		AllowedSenders:  []string{"@acme.example"},
+		BlockedSenders:  []string{"news.example.com"},
+		IncludeLabels:   []string{"Receipts"},
+		After:           time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC),
+	}, 1)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "7:5" {
+		t.Errorf("expected only the newest message, but got %v", ids)
+	}
+
+	expected := `UID SEARCH OR SUBJECT "invoice" FROM "acme.example" NOT FROM "news.example.com" SINCE 5-Mar-2025`
+	if server.searches[0] != expected {
+		t.Errorf("expected search %s, but got %s", expected, server.searches[0])
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	_, cfg := newFakeServer(t)
+	ctx := context.Background()
+
+	badCfg := cfg
+	badCfg.Password = "wrong"
+	if _, err := Dial(ctx, badCfg); err == nil {
+		t.Error("expected login with the wrong password to fail")
+	}
+
+	client, err := Dial(ctx, cfg)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	testCases := []struct {
+		name      string
+		messageID string
+	}{
+		{name: "Stale UIDVALIDITY", messageID: "6:5"},
+		{name: "Malformed ID", messageID: "5"},
+		{name: "Missing Message", messageID: "7:9"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := client.GetRaw(ctx, tc.messageID); err == nil {
+				t.Errorf("expected an error for message ID %s", tc.messageID)
+			}
+		})
+	}
+}
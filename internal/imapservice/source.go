@@ -0,0 +1,185 @@
+package imapservice
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// SourceName is recorded on every invoice staged from an IMAP mailbox.
+const SourceName = "imap"
+
+var _ mailsource.MailSource = (*Client)(nil)
+
+var internalDatePattern = regexp.MustCompile(`INTERNALDATE "([^"]+)"`)
+
+func (c *Client) Name() string {
+	return SourceName
+}
+
+// Search runs UID SEARCH with every keyword and allowed sender OR'ed together. Labels
+// don't exist in IMAP and are ignored. Message IDs are "<uidvalidity>:<uid>" so they
+// stop resolving if the mailbox is ever recreated.
+func (c *Client) Search(ctx context.Context, criteria mailsource.SearchCriteria, limit int) ([]string, error) {
+	var matchKeys []any
+	var values []string
+	for _, keyword := range criteria.SubjectKeywords {
+		matchKeys = append(matchKeys, atom("SUBJECT"), keyword)
+		values = append(values, keyword)
+	}
+	for _, keyword := range criteria.BodyKeywords {
+		matchKeys = append(matchKeys, atom("BODY"), keyword)
+		values = append(values, keyword)
+	}
+	for _, sender := range criteria.AllowedSenders {
+		sender = strings.TrimPrefix(sender, "@")
+		matchKeys = append(matchKeys, atom("FROM"), sender)
+		values = append(values, sender)
+	}
+	matchCount := len(values)
+	if matchCount == 0 {
+		return nil, nil
+	}
+
+	var filterKeys []any
+	for _, sender := range criteria.BlockedSenders {
+		sender = strings.TrimPrefix(sender, "@")
+		filterKeys = append(filterKeys, atom("NOT"), atom("FROM"), sender)
+		values = append(values, sender)
+	}
+	if !criteria.After.IsZero() {
+		filterKeys = append(filterKeys, atom("SINCE"), atom(criteria.After.Format("2-Jan-2006")))
+	}
+
+	var args []any
+	if !quotable(strings.Join(values, "")) {
+		args = append(args, atom("CHARSET"), atom("UTF-8"))
+	}
+	// OR only takes two search keys, so n keys need n-1 leading ORs
+	for i := 1; i < matchCount; i++ {
+		args = append(args, atom("OR"))
+	}
+	args = append(args, matchKeys...)
+	args = append(args, filterKeys...)
+
+	untagged, err := c.command(ctx, "UID SEARCH", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search mailbox: %w", err)
+	}
+
+	var messageIDs []string
+	for _, resp := range untagged {
+		if !strings.HasPrefix(resp.line, "* SEARCH") {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(resp.line, "* SEARCH")) {
+			uid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UID %q in search results", field)
+			}
+			messageIDs = append(messageIDs, c.messageID(uint32(uid)))
+		}
+	}
+
+	// newest first, like the Gmail search
+	for i, j := 0, len(messageIDs)-1; i < j; i, j = i+1, j-1 {
+		messageIDs[i], messageIDs[j] = messageIDs[j], messageIDs[i]
+	}
+	if limit > 0 && len(messageIDs) > limit {
+		messageIDs = messageIDs[:limit]
+	}
+	return messageIDs, nil
+}
+
+// GetMetadata downloads the whole message, IMAP has no cheap way to list attachments.
+func (c *Client) GetMetadata(ctx context.Context, messageID string) (*mailsource.Message, error) {
+	raw, internalDate, err := c.fetch(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return mailsource.ParseRaw(messageID, raw, internalDate)
+}
+
+// GetAttachment returns the attachment at the position GetMetadata gave it.
+func (c *Client) GetAttachment(ctx context.Context, messageID, partID string) ([]byte, error) {
+	raw, _, err := c.fetch(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := mailsource.RawAttachment(raw, partID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", messageID, err)
+	}
+	return data, nil
+}
+
+func (c *Client) GetRaw(ctx context.Context, messageID string) ([]byte, error) {
+	raw, _, err := c.fetch(ctx, messageID)
+	return raw, err
+}
+
+// fetch downloads the message source without marking it as read.
+func (c *Client) fetch(ctx context.Context, messageID string) ([]byte, time.Time, error) {
+	uid, err := c.parseMessageID(messageID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	untagged, err := c.command(ctx, "UID FETCH", atom(strconv.FormatUint(uint64(uid), 10)), atom("(INTERNALDATE BODY.PEEK[])"))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to fetch message %s: %w", messageID, err)
+	}
+
+	for _, resp := range untagged {
+		if !strings.Contains(resp.line, " FETCH ") || len(resp.literals) == 0 {
+			continue
+		}
+		var internalDate time.Time
+		if m := internalDatePattern.FindStringSubmatch(resp.line); m != nil {
+			internalDate, _ = time.Parse("2-Jan-2006 15:04:05 -0700", strings.TrimSpace(m[1]))
+		}
+		return resp.literals[len(resp.literals)-1], internalDate, nil
+	}
+	return nil, time.Time{}, fmt.Errorf("message %s not found", messageID)
+}
+
+func (c *Client) messageID(uid uint32) string {
+	return fmt.Sprintf("%d:%d", c.uidValidity, uid)
+}
+
+func (c *Client) parseMessageID(messageID string) (uint32, error) {
+	validity, uid, ok := strings.Cut(messageID, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid IMAP message ID %q", messageID)
+	}
+	if validity != strconv.FormatUint(uint64(c.uidValidity), 10) {
+		return 0, fmt.Errorf("message %s is from an earlier version of the mailbox", messageID)
+	}
+	n, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid IMAP message ID %q", messageID)
+	}
+	return uint32(n), nil
+}
+
+// Scanner connects for the duration of one scan.
+type Scanner struct {
+	Config Config
+}
+
+func (s Scanner) ScanAndStageInvoices(ctx context.Context, db *database.Queries, userID string, criteria mailsource.SearchCriteria, progress mailsource.ProgressFunc) (mailsource.ScanStats, error) {
+	client, err := Dial(ctx, s.Config)
+	if err != nil {
+		return mailsource.ScanStats{}, err
+	}
+	defer client.Close()
+
+	return mailsource.SearchScanner{Source: client}.ScanAndStageInvoices(ctx, db, userID, criteria, progress)
+}
@@ -0,0 +1,532 @@
+// Package invoicefields finds the values accounting cares about in the text of an
+// invoice. Every value comes with a confidence between 0 and 1: labelled values score
+// high, guesses such as "the largest amount on the page" score low so the UI can tell
+// the user which ones to check.
+package invoicefields
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field is a text value and how sure the extraction is about it.
+type Field struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Amount is a money value and how sure the extraction is about it.
+type Amount struct {
+	Value      float64 `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Fields holds everything Extract found. Missing values have zero confidence.
+type Fields struct {
+	Total         Amount `json:"total"`
+	VAT           Amount `json:"vat"`
+	Currency      Field  `json:"currency"`
+	InvoiceNumber Field  `json:"invoice_number"`
+	// dates are formatted as 2006-01-02
+	IssueDate     Field `json:"issue_date"`
+	DueDate       Field `json:"due_date"`
+	SupplierTaxID Field `json:"supplier_tax_id"`
+	// Israel Tax Authority approval of a large tax invoice
+	AllocationNumber Field `json:"allocation_number"`
+}
+
+// VAT rates checked when deciding whether a VAT amount matches the total, Israel's
+// current and previous rates first
+var vatRates = []float64{0.18, 0.17, 0.20, 0.19, 0.21, 0.25, 0.10}
+
+// a label matched against a line, and the confidence of the value found next to it
+type label struct {
+	pattern    *regexp.Regexp
+	confidence float64
+}
+
+var (
+	totalLabels = []label{
+		{regexp.MustCompile(`(?i)(total amount due|amount due|balance due|grand total|total to pay|total payable|סה"כ לתשלום|סך הכל לתשלום|סך הכול לתשלום|סכום לתשלום)`), 0.9},
+		{regexp.MustCompile(`(?i)(total|סה"כ|סך הכל|סך הכול|לתשלום)`), 0.6},
+	}
+	// totals that aren't the amount to pay
+	notTotalPattern = regexp.MustCompile(`(?i)(sub\s*-?total|before (vat|tax)|excl|net total|לפני מע"מ|ללא מע"מ|חייב במע"מ|פטור)`)
+
+	vatLabels = []label{
+		{regexp.MustCompile(`(?i)(vat|מע"מ|מעמ|sales tax|\bgst\b|\btax\b)`), 0.8},
+	}
+	// lines mentioning VAT that carry something other than the VAT amount
+	notVATPattern = regexp.MustCompile(`(?i)(vat\s*(no|num|number|id|reg)|tax\s*(id|no|number)|(incl|including|before|excl|excluding)\.?\s*(vat|tax)|tax invoice|(כולל|לפני|ללא) מע"מ|חייב במע"מ|עוסק)`)
+
+	invoiceNumberLabels = []label{
+		{regexp.MustCompile(`(?i)(?:invoice|receipt|document|bill)\s*(?:no\.?|number|num\.?|#|nr\.?)\s*[:#.]?\s*([A-Z0-9][A-Z0-9/-]*)`), 0.85},
+		{regexp.MustCompile(`(?:חשבונית(?: מס)?(?:[ /-]?קבלה)?|קבלה|מסמך)\s*(?:מס'|מספר)\s*[:#]?\s*([A-Z0-9][A-Z0-9/-]*)`), 0.85},
+		{regexp.MustCompile(`(?:מס'|מספר) (?:חשבונית|קבלה|מסמך)\s*[:#]?\s*([A-Z0-9][A-Z0-9/-]*)`), 0.85},
+		{regexp.MustCompile(`(?i)(?:invoice|חשבונית(?: מס)?)\s*[:#]\s*([A-Z0-9][A-Z0-9/-]*)`), 0.7},
+	}
+
+	issueDateLabels = []label{
+		{regexp.MustCompile(`(?i)(invoice date|date of issue|issue date|issued on|document date|תאריך הפקה|תאריך חשבונית|תאריך מסמך|תאריך הנפקה)`), 0.85},
+		{regexp.MustCompile(`(?i)(date|תאריך)`), 0.6},
+	}
+	dueDateLabels = []label{
+		{regexp.MustCompile(`(?i)(due date|payment due|due on|pay by|תאריך פירעון|לתשלום עד|מועד תשלום|תאריך תשלום)`), 0.85},
+	}
+
+	// numbers of Israeli businesses, see israel.go for the check digit
+	israeliTaxIDPattern = regexp.MustCompile(`(?:ע\.מ\.?|ע"מ|עוסק מורשה|עוסק פטור|ח\.פ\.?|ח"פ|ע\.ר\.?|מספר עוסק|מספר חברה)\s*[:#]?\s*(\d[\d -]{6,10}\d)`)
+	foreignTaxIDPattern = regexp.MustCompile(`(?i)(?:vat\s*(?:no|num|number|id|reg(?:istration)?(?:\s*no)?)|tax\s*(?:id|no|number)|company\s*(?:no|number|reg(?:istration)?(?:\s*no)?)|\bein\b|\babn\b)\.?\s*[:#]?\s*(?:[A-Z]{2} ?)?(\d[\d -]{6,13}\d)`)
+
+	amountPattern = regexp.MustCompile(`-?\d{1,3}(?:,\d{3})+(?:\.\d{1,2})?|-?\d{1,3}(?:\.\d{3})+,\d{2}|-?\d+(?:[.,]\d{1,2})?`)
+
+	numericDatePattern = regexp.MustCompile(`\b(\d{1,4})[./-](\d{1,2})[./-](\d{2,4})\b`)
+	namedDatePattern   = regexp.MustCompile(`(?i)\b(?:(\d{1,2})(?:st|nd|rd|th)?\s+([a-z]{3,9})\.?,?\s+(\d{4})|([a-z]{3,9})\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4}))\b`)
+)
+
+var currencies = []struct {
+	pattern *regexp.Regexp
+	code    string
+}{
+	{regexp.MustCompile(`₪|ש"ח|\bILS\b|\bNIS\b|שקל`), "ILS"},
+	{regexp.MustCompile(`\$|\bUSD\b|דולר`), "USD"},
+	{regexp.MustCompile(`€|\bEUR\b|אירו|יורו`), "EUR"},
+	{regexp.MustCompile(`£|\bGBP\b`), "GBP"},
+}
+
+// Extract reads the fields out of text from pdftext or an email body.
+func Extract(text string) Fields {
+	lines := Lines(text)
+
+	var fields Fields
+	var totalLine int
+	fields.Total, totalLine = findTotal(lines)
+	fields.VAT = findVAT(lines, fields.Total)
+	fields.Currency = findCurrency(lines, totalLine, fields.Total.Confidence > 0)
+	fields.InvoiceNumber = findLabelled(lines, invoiceNumberLabels, invoiceNumber)
+	fields.DueDate = findDate(lines, dueDateLabels, nil)
+	fields.IssueDate = findDate(lines, issueDateLabels, dueDateLabels)
+	if fields.IssueDate.Confidence == 0 {
+		// no label, take the first date that isn't the due date
+		for _, line := range lines {
+			if d, ok := firstDate(line); ok && d != fields.DueDate.Value {
+				fields.IssueDate = Field{Value: d, Confidence: 0.3}
+				break
+			}
+		}
+	}
+	fields.SupplierTaxID = findTaxID(lines)
+	fields.AllocationNumber = findLabelled(lines, allocationLabels, func(string) bool { return true })
+	return fields
+}
+
+// Lines normalizes the text for matching and splits it into lines. Hebrew PDFs written
+// in visual order come out reversed and are turned back around.
+func Lines(text string) []string {
+	text = strings.NewReplacer(
+		"״", `"`, "“", `"`, "”", `"`, "„", `"`,
+		"׳", "'", "‘", "'", "’", "'",
+		"‏", "", "‎", "", "‪", "", "‫", "", "‬", "",
+		" ", " ",
+	).Replace(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if isVisualOrder(lines) {
+		for i, line := range lines {
+			lines[i] = logicalOrder(line)
+		}
+	}
+	return lines
+}
+
+// common words that only read correctly in one direction
+var directionMarkers = []string{`סה"כ`, "חשבונית", `מע"מ`, "תאריך", "לתשלום", "קבלה", "סכום"}
+
+func isVisualOrder(lines []string) bool {
+	text := strings.Join(lines, "\n")
+	forward, backward := 0, 0
+	for _, marker := range directionMarkers {
+		forward += strings.Count(text, marker)
+		backward += strings.Count(text, reverse(marker))
+	}
+	return backward > forward
+}
+
+// logicalOrder reverses a visual-order line but keeps runs of digits and Latin text,
+// which visual order already stores left to right, the right way around.
+func logicalOrder(line string) string {
+	runes := []rune(reverse(line))
+	for i := 0; i < len(runes); {
+		if !isLTR(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (isLTR(runes[j]) || runes[j] == ' ' && j+1 < len(runes) && isLTR(runes[j+1])) {
+			j++
+		}
+		for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+			runes[a], runes[b] = runes[b], runes[a]
+		}
+		i = j
+	}
+	return string(runes)
+}
+
+func isLTR(r rune) bool {
+	return r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".,/:-%$", r))
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// valuesNear returns the candidate values on a labelled line, after the label first,
+// then before it, then on the following line with a lower confidence.
+func valuesNear(lines []string, i int, loc []int, find func(string) []string) ([]string, float64) {
+	line := lines[i]
+	if values := find(line[loc[1]:]); len(values) > 0 {
+		return values, 0
+	}
+	if values := find(line[:loc[0]]); len(values) > 0 {
+		return values, 0
+	}
+	if i+1 < len(lines) {
+		if values := find(lines[i+1]); len(values) > 0 {
+			return values, 0.15
+		}
+	}
+	return nil, 0
+}
+
+func findTotal(lines []string) (Amount, int) {
+	for _, l := range totalLabels {
+		best, bestLine := Amount{}, -1
+		for i, line := range lines {
+			loc := l.pattern.FindStringIndex(line)
+			if loc == nil || notTotalPattern.MatchString(line) {
+				continue
+			}
+			values, penalty := valuesNear(lines, i, loc, amounts)
+			for _, v := range values {
+				amount, ok := parseAmount(v)
+				// the largest labelled total wins, later pages repeat subtotals
+				if ok && amount > best.Value {
+					best = Amount{Value: amount, Confidence: l.confidence - penalty}
+					bestLine = i
+				}
+			}
+		}
+		if bestLine >= 0 {
+			return best, bestLine
+		}
+	}
+
+	// no label at all, guess the largest amount
+	best, bestLine := Amount{}, -1
+	for i, line := range lines {
+		for _, v := range amounts(line) {
+			if amount, ok := parseAmount(v); ok && amount > best.Value && strings.ContainsAny(v, ".,") {
+				best = Amount{Value: amount, Confidence: 0.3}
+				bestLine = i
+			}
+		}
+	}
+	return best, bestLine
+}
+
+func findVAT(lines []string, total Amount) Amount {
+	var candidates []Amount
+	for _, l := range vatLabels {
+		for i, line := range lines {
+			loc := l.pattern.FindStringIndex(line)
+			if loc == nil || notVATPattern.MatchString(line) {
+				continue
+			}
+			values, penalty := valuesNear(lines, i, loc, amounts)
+			for _, v := range values {
+				if amount, ok := parseAmount(v); ok && amount > 0 {
+					candidates = append(candidates, Amount{Value: amount, Confidence: l.confidence - penalty})
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return Amount{}
+	}
+	if total.Confidence == 0 {
+		return candidates[0]
+	}
+
+	// prefer the candidate that is the VAT part of a gross total at a known rate
+	for _, c := range candidates {
+		for _, rate := range vatRates {
+			if math.Abs(c.Value-total.Value*rate/(1+rate)) <= 0.05 || math.Abs(c.Value-total.Value*rate) <= 0.05 {
+				c.Confidence = math.Min(0.95, c.Confidence+0.15)
+				return c
+			}
+		}
+	}
+	for _, c := range candidates {
+		if c.Value < total.Value {
+			return c
+		}
+	}
+	return Amount{Value: candidates[0].Value, Confidence: 0.2}
+}
+
+func findCurrency(lines []string, totalLine int, hasTotal bool) Field {
+	if hasTotal && totalLine >= 0 {
+		if code := currencyIn(lines[totalLine]); code != "" {
+			return Field{Value: code, Confidence: 0.9}
+		}
+	}
+
+	counts := map[string]int{}
+	for _, line := range lines {
+		for _, c := range currencies {
+			counts[c.code] += len(c.pattern.FindAllString(line, -1))
+		}
+	}
+	best := ""
+	for _, c := range currencies {
+		if counts[c.code] > counts[best] {
+			best = c.code
+		}
+	}
+	if best != "" {
+		return Field{Value: best, Confidence: 0.7}
+	}
+	for _, line := range lines {
+		if strings.IndexFunc(line, isHebrew) >= 0 {
+			return Field{Value: "ILS", Confidence: 0.3}
+		}
+	}
+	return Field{}
+}
+
+func currencyIn(line string) string {
+	for _, c := range currencies {
+		if c.pattern.MatchString(line) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+func isHebrew(r rune) bool {
+	return r >= 0x0590 && r <= 0x05ff
+}
+
+// findLabelled returns the first value a label captures, trying the most specific
+// labels first.
+func findLabelled(lines []string, labels []label, valid func(string) bool) Field {
+	for _, l := range labels {
+		for _, line := range lines {
+			for _, m := range l.pattern.FindAllStringSubmatch(line, -1) {
+				if valid(m[1]) {
+					return Field{Value: m[1], Confidence: l.confidence}
+				}
+			}
+		}
+	}
+	return Field{}
+}
+
+func invoiceNumber(s string) bool {
+	if len(s) > 30 || strings.IndexFunc(s, unicode.IsDigit) < 0 {
+		return false
+	}
+	_, isDate := firstDate(s)
+	return !isDate
+}
+
+// findDate returns the date next to the first matching label, skipping lines that
+// match any of the excluded labels.
+func findDate(lines []string, labels, exclude []label) Field {
+	for _, l := range labels {
+	line:
+		for i, line := range lines {
+			loc := l.pattern.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			for _, ex := range exclude {
+				if ex.pattern.MatchString(line) {
+					continue line
+				}
+			}
+			values, penalty := valuesNear(lines, i, loc, dates)
+			if len(values) > 0 {
+				return Field{Value: values[0], Confidence: l.confidence - penalty}
+			}
+		}
+	}
+	return Field{}
+}
+
+func firstDate(s string) (string, bool) {
+	found := dates(s)
+	if len(found) == 0 {
+		return "", false
+	}
+	return found[0], true
+}
+
+// dates returns the valid dates in s in order, as 2006-01-02. Numeric dates are read
+// day first, the way Israeli and European invoices write them, unless that can't be a
+// valid date.
+func dates(s string) []string {
+	type match struct {
+		pos   int
+		value string
+	}
+	var found []match
+
+	for _, m := range numericDatePattern.FindAllStringSubmatchIndex(s, -1) {
+		a, _ := strconv.Atoi(s[m[2]:m[3]])
+		b, _ := strconv.Atoi(s[m[4]:m[5]])
+		c, _ := strconv.Atoi(s[m[6]:m[7]])
+		var t time.Time
+		var ok bool
+		if m[3]-m[2] == 4 {
+			t, ok = makeDate(a, b, c)
+		} else {
+			if m[7]-m[6] == 2 {
+				c += 2000
+			}
+			if m[7]-m[6] == 3 {
+				continue
+			}
+			t, ok = makeDate(c, b, a)
+			if !ok {
+				t, ok = makeDate(c, a, b)
+			}
+		}
+		if ok {
+			found = append(found, match{m[0], t.Format(time.DateOnly)})
+		}
+	}
+
+	for _, m := range namedDatePattern.FindAllStringSubmatchIndex(s, -1) {
+		var day, month, year string
+		if m[2] >= 0 {
+			day, month, year = s[m[2]:m[3]], s[m[4]:m[5]], s[m[6]:m[7]]
+		} else {
+			month, day, year = s[m[8]:m[9]], s[m[10]:m[11]], s[m[12]:m[13]]
+		}
+		mon, ok := monthNumber(month)
+		if !ok {
+			continue
+		}
+		d, _ := strconv.Atoi(day)
+		y, _ := strconv.Atoi(year)
+		if t, ok := makeDate(y, mon, d); ok {
+			found = append(found, match{m[0], t.Format(time.DateOnly)})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].pos < found[j].pos })
+	values := make([]string, len(found))
+	for i, m := range found {
+		values[i] = m.value
+	}
+	return values
+}
+
+func makeDate(year, month, day int) (time.Time, bool) {
+	if year < 2000 || year > 2100 || month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func monthNumber(s string) (int, bool) {
+	s = strings.ToLower(s)
+	if len(s) < 3 {
+		return 0, false
+	}
+	for m := time.January; m <= time.December; m++ {
+		full := strings.ToLower(m.String())
+		if strings.HasPrefix(full, s) || s == "sept" && m == time.September {
+			return int(m), true
+		}
+	}
+	return 0, false
+}
+
+// amounts returns the numbers in s that could be money, skipping percentages, dates
+// and anything glued to letters like "INV2024".
+func amounts(s string) []string {
+	for _, m := range numericDatePattern.FindAllStringIndex(s, -1) {
+		s = s[:m[0]] + strings.Repeat(" ", m[1]-m[0]) + s[m[1]:]
+	}
+	var values []string
+	for _, m := range amountPattern.FindAllStringIndex(s, -1) {
+		if m[1] < len(s) && (s[m[1]] == '%' || isWordByte(s[m[1]])) {
+			continue
+		}
+		if m[0] > 0 && isWordByte(s[m[0]-1]) {
+			continue
+		}
+		values = append(values, s[m[0]:m[1]])
+	}
+	return values
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// parseAmount reads 1,234.50, 1.234,50 and 1234,50.
+func parseAmount(s string) (float64, bool) {
+	switch {
+	case strings.Contains(s, ".") && strings.Contains(s, ","):
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case strings.Contains(s, ","):
+		parts := strings.Split(s, ",")
+		if len(parts) == 2 && len(parts[1]) <= 2 {
+			s = parts[0] + "." + parts[1]
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return math.Round(v*100) / 100, true
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,131 @@
+package invoicefields
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected Fields
+	}{
+		{
+			name: "English Invoice",
+			text: "ACME Ltd\nVAT Reg No: GB 123 4567 89\nTax Invoice\nInvoice No: INV-2024-0042\nInvoice Date: 14/03/2024\nDue Date: 13 April 2024\n" +
+				"Subtotal £1,000.00\nVAT 20% £200.00\nTotal £1,200.00",
+			expected: Fields{
+				Total:         Amount{Value: 1200, Confidence: 0.6},
+				VAT:           Amount{Value: 200, Confidence: 0.95},
+				Currency:      Field{Value: "GBP", Confidence: 0.9},
+				InvoiceNumber: Field{Value: "INV-2024-0042", Confidence: 0.85},
+				IssueDate:     Field{Value: "2024-03-14", Confidence: 0.85},
+				DueDate:       Field{Value: "2024-04-13", Confidence: 0.85},
+				SupplierTaxID: Field{Value: "123456789", Confidence: 0.8},
+			},
+		},
+		{
+			name: "Hebrew Invoice",
+			text: "חברת הדוגמה בע״מ\nח.פ. 51-527092-4\nחשבונית מס מס׳ 10234\nמספר הקצאה: 123456789\nתאריך: 01.05.2024\nתאריך פירעון: 31.05.2024\n" +
+				"סה״כ לפני מע״מ 1,000.00\nמע״מ 17% 170.00\nסה״כ לתשלום ₪1,170.00",
+			expected: Fields{
+				Total:            Amount{Value: 1170, Confidence: 0.9},
+				VAT:              Amount{Value: 170, Confidence: 0.95},
+				Currency:         Field{Value: "ILS", Confidence: 0.9},
+				InvoiceNumber:    Field{Value: "10234", Confidence: 0.85},
+				IssueDate:        Field{Value: "2024-05-01", Confidence: 0.6},
+				DueDate:          Field{Value: "2024-05-31", Confidence: 0.85},
+				SupplierTaxID:    Field{Value: "515270924", Confidence: 0.95},
+				AllocationNumber: Field{Value: "123456789", Confidence: 0.9},
+			},
+		},
+		{
+			name: "Visual Order Hebrew",
+			text: "10234 'סמ סמ תינובשח\n2024/05/01 :ךיראת\n1,170.00 םולשתל כ\"הס",
+			expected: Fields{
+				Total:         Amount{Value: 1170, Confidence: 0.9},
+				Currency:      Field{Value: "ILS", Confidence: 0.3},
+				InvoiceNumber: Field{Value: "10234", Confidence: 0.85},
+				IssueDate:     Field{Value: "2024-05-01", Confidence: 0.6},
+			},
+		},
+		{
+			name: "Value On Next Line",
+			text: "Amount Due\n$ 89.90\nReceipt #: 7781-2\nApril 2, 2024",
+			expected: Fields{
+				Total:         Amount{Value: 89.9, Confidence: 0.75},
+				Currency:      Field{Value: "USD", Confidence: 0.7},
+				InvoiceNumber: Field{Value: "7781-2", Confidence: 0.85},
+				IssueDate:     Field{Value: "2024-04-02", Confidence: 0.3},
+			},
+		},
+		{
+			name: "Unlabelled",
+			text: "Thanks for your order\n2 x widget 10.00\nshipping 5.50\n25.50 EUR",
+			expected: Fields{
+				Total:    Amount{Value: 25.5, Confidence: 0.3},
+				Currency: Field{Value: "EUR", Confidence: 0.9},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Extract(tc.text)
+			if got != tc.expected {
+				t.Errorf("expected %+v, but got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+	}{
+		{input: "1,234.50", expected: 1234.5},
+		{input: "1.234,50", expected: 1234.5},
+		{input: "1234,5", expected: 1234.5},
+		{input: "1,234,567", expected: 1234567},
+		{input: "99", expected: 99},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, ok := parseAmount(tc.input)
+			if !ok || got != tc.expected {
+				t.Errorf("expected %v, but got %v (ok %v)", tc.expected, got, ok)
+			}
+		})
+	}
+}
+
+func TestDates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "Day First", input: "01/02/2024", expected: []string{"2024-02-01"}},
+		{name: "Month First When Day First Is Invalid", input: "12/25/2024", expected: []string{"2024-12-25"}},
+		{name: "ISO", input: "2024-02-29", expected: []string{"2024-02-29"}},
+		{name: "Short Year", input: "5.6.24", expected: []string{"2024-06-05"}},
+		{name: "Named Months In Order", input: "Mar 3rd, 2024 to 1 April 2024", expected: []string{"2024-03-03", "2024-04-01"}},
+		{name: "Invalid", input: "31/02/2024 and 2024-13-01", expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := dates(tc.input)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected %v, but got %v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("expected %v, but got %v", tc.expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package invoicefields
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Issue is something about an invoice the user should look at before approving it.
+type Issue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	IssueMissingAllocationNumber = "missing_allocation_number"
+	IssueInvalidSupplierTaxID    = "invalid_supplier_tax_id"
+	IssueFieldsNotExtracted      = "fields_not_extracted"
+)
+
+// NotExtracted is the issue of an invoice whose attachments haven't been read yet, so
+// nothing could be checked.
+var NotExtracted = Issue{
+	Code:    IssueFieldsNotExtracted,
+	Message: "The invoice hasn't been read yet, so its allocation number couldn't be checked",
+}
+
+// the Tax Authority's allocation numbers are 9 digits
+var allocationLabels = []label{
+	{regexp.MustCompile(`(?i)(?:מספר הקצאה|מס' הקצאה|הקצאה|allocation\s*(?:no\.?|num\.?|number)?)\s*[:#]?\s*(\d{9})(?:\D|$)`), 0.9},
+}
+
+// allocationThresholds are the amounts before VAT, in shekels, above which a tax
+// invoice needs an allocation number to be deductible, by the date they took effect.
+var allocationThresholds = []struct {
+	from   time.Time
+	amount float64
+}{
+	{time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC), 5000},
+	{time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), 10000},
+	{time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), 20000},
+	{time.Date(2024, time.May, 5, 0, 0, 0, 0, time.UTC), 25000},
+}
+
+// AllocationThreshold returns the threshold in force on date, or 0 before the reform.
+func AllocationThreshold(date time.Time) float64 {
+	for _, t := range allocationThresholds {
+		if !date.Before(t.from) {
+			return t.amount
+		}
+	}
+	return 0
+}
+
+// israeliVATRate returns the rate in force on date, used when the VAT amount wasn't found.
+func israeliVATRate(date time.Time) float64 {
+	if date.Before(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		return 0.17
+	}
+	return 0.18
+}
+
+// ValidIsraeliID checks the check digit of a ח.פ., ע.מ. or ת.ז. number. It is the Luhn
+// scheme over 9 digits, shorter numbers are padded with leading zeros.
+func ValidIsraeliID(id string) bool {
+	if len(id) == 0 || len(id) > 9 || digitsOnly(id) != id {
+		return false
+	}
+	for len(id) < 9 {
+		id = "0" + id
+	}
+	sum := 0
+	for i, c := range id {
+		d := int(c-'0') * (i%2 + 1)
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+	}
+	return sum%10 == 0 && id != "000000000"
+}
+
+// findTaxID prefers an Israeli number with a valid check digit, which also skips a
+// customer number that is mistyped on the invoice. One that fails the check is kept
+// with low confidence when nothing better turns up.
+func findTaxID(lines []string) Field {
+	var invalid, foreign Field
+	for _, line := range lines {
+		for _, m := range israeliTaxIDPattern.FindAllStringSubmatch(line, -1) {
+			id := digitsOnly(m[1])
+			if ValidIsraeliID(id) {
+				return Field{Value: id, Confidence: 0.95}
+			}
+			if invalid.Value == "" {
+				invalid = Field{Value: id, Confidence: 0.4}
+			}
+		}
+		if foreign.Value == "" {
+			if m := foreignTaxIDPattern.FindStringSubmatch(line); m != nil {
+				foreign = Field{Value: digitsOnly(m[1]), Confidence: 0.8}
+			}
+		}
+	}
+	if invalid.Value != "" {
+		return invalid
+	}
+	return foreign
+}
+
+// Check reports what could get the VAT deduction of an Israeli tax invoice rejected:
+// a supplier number that fails its check digit, or an amount above the allocation
+// threshold without an allocation number, which is only looked for when
+// needsAllocation says the document is a tax invoice. Invoices in other currencies
+// aren't checked. date is when the invoice was issued.
+func Check(f Fields, date time.Time, needsAllocation bool) []Issue {
+	if f.Currency.Value != "ILS" {
+		return nil
+	}
+
+	var issues []Issue
+	if f.SupplierTaxID.Value != "" && len(f.SupplierTaxID.Value) <= 9 && !ValidIsraeliID(f.SupplierTaxID.Value) {
+		issues = append(issues, Issue{
+			Code:    IssueInvalidSupplierTaxID,
+			Message: "The supplier's ח.פ./ע.מ. number " + f.SupplierTaxID.Value + " fails its check digit",
+		})
+	}
+
+	threshold := AllocationThreshold(date)
+	if !needsAllocation || threshold == 0 || f.Total.Confidence == 0 || f.AllocationNumber.Value != "" {
+		return issues
+	}
+	net := f.Total.Value / (1 + israeliVATRate(date))
+	if f.VAT.Confidence > 0 && f.VAT.Value < f.Total.Value {
+		net = f.Total.Value - f.VAT.Value
+	}
+	if net > threshold {
+		issues = append(issues, Issue{
+			Code: IssueMissingAllocationNumber,
+			Message: "The amount before VAT is above the " + formatShekels(threshold) +
+				" allocation threshold but no allocation number (מספר הקצאה) was found",
+		})
+	}
+	return issues
+}
+
+func formatShekels(v float64) string {
+	s := strconv.FormatInt(int64(math.Round(v)), 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return "₪" + s
+}
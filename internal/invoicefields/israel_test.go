@@ -0,0 +1,139 @@
+package invoicefields
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidIsraeliID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{name: "Company", id: "515270924", expected: true},
+		{name: "Wrong Check Digit", id: "515270929", expected: false},
+		{name: "Short Personal ID", id: "18", expected: true},
+		{name: "Too Long", id: "5152709240", expected: false},
+		{name: "Not Digits", id: "51-527092-4", expected: false},
+		{name: "Zeros", id: "000000000", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ValidIsraeliID(tc.id); got != tc.expected {
+				t.Errorf("expected %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestFindTaxID(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected Field
+	}{
+		{
+			name:     "Skips Invalid Number",
+			text:     "לקוח ע.מ. 123456789\nספק ח\"פ 515270924",
+			expected: Field{Value: "515270924", Confidence: 0.95},
+		},
+		{
+			name:     "Only Invalid Number",
+			text:     "עוסק מורשה 515270929",
+			expected: Field{Value: "515270929", Confidence: 0.4},
+		},
+		{
+			name:     "Foreign Number",
+			text:     "VAT No: DE 123456789",
+			expected: Field{Value: "123456789", Confidence: 0.8},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := findTaxID(Lines(tc.text)); got != tc.expected {
+				t.Errorf("expected %+v, but got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ils := Field{Value: "ILS", Confidence: 0.9}
+	validID := Field{Value: "515270924", Confidence: 0.95}
+	june2026 := time.Date(2026, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		fields   Fields
+		date     time.Time
+		receipt  bool
+		expected []string
+	}{
+		{
+			name:     "Above Threshold Without Allocation Number",
+			fields:   Fields{Total: Amount{Value: 11800, Confidence: 0.9}, VAT: Amount{Value: 1800, Confidence: 0.95}, Currency: ils, SupplierTaxID: validID},
+			date:     june2026,
+			expected: []string{IssueMissingAllocationNumber},
+		},
+		{
+			name:     "Above Threshold With Allocation Number",
+			fields:   Fields{Total: Amount{Value: 11800, Confidence: 0.9}, Currency: ils, SupplierTaxID: validID, AllocationNumber: Field{Value: "123456789", Confidence: 0.9}},
+			date:     june2026,
+			expected: nil,
+		},
+		{
+			name:     "Below Threshold Of The Issue Date",
+			fields:   Fields{Total: Amount{Value: 11800, Confidence: 0.9}, Currency: ils},
+			date:     time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC),
+			expected: nil,
+		},
+		{
+			name:     "Net Amount From VAT Rate",
+			fields:   Fields{Total: Amount{Value: 6000, Confidence: 0.6}, Currency: ils},
+			date:     june2026,
+			expected: []string{IssueMissingAllocationNumber},
+		},
+		{
+			name:     "Before The Reform",
+			fields:   Fields{Total: Amount{Value: 100000, Confidence: 0.9}, Currency: ils},
+			date:     time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			expected: nil,
+		},
+		{
+			name:     "Invalid Supplier Number",
+			fields:   Fields{Total: Amount{Value: 100, Confidence: 0.9}, Currency: ils, SupplierTaxID: Field{Value: "515270929", Confidence: 0.4}},
+			date:     june2026,
+			expected: []string{IssueInvalidSupplierTaxID},
+		},
+		{
+			name:     "Receipt Above Threshold",
+			fields:   Fields{Total: Amount{Value: 11800, Confidence: 0.9}, VAT: Amount{Value: 1800, Confidence: 0.95}, Currency: ils, SupplierTaxID: validID},
+			date:     june2026,
+			receipt:  true,
+			expected: nil,
+		},
+		{
+			name:     "Foreign Currency",
+			fields:   Fields{Total: Amount{Value: 100000, Confidence: 0.9}, Currency: Field{Value: "USD", Confidence: 0.9}},
+			date:     june2026,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Check(tc.fields, tc.date, !tc.receipt)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected %v, but got %+v", tc.expected, got)
+			}
+			for i := range got {
+				if got[i].Code != tc.expected[i] {
+					t.Errorf("expected %v, but got %+v", tc.expected, got)
+				}
+			}
+		})
+	}
+}
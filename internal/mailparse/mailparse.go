@@ -0,0 +1,312 @@
+package mailparse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Part is a decoded leaf of a MIME message that isn't the text or HTML body.
+type Part struct {
+	Filename    string
+	MimeType    string
+	ContentID   string
+	Disposition string
+	Data        []byte
+}
+
+type Message struct {
+	Header      mail.Header
+	TextBody    string
+	HTMLBody    []byte
+	HTMLCharset string
+	Parts       []Part
+}
+
+// MIME types worth staging: documents, scans and photos of receipts, XML e-invoices
+// and archives of them.
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf":              true,
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/heic":                   true,
+	"image/tiff":                   true,
+	"application/xml":              true,
+	"text/xml":                     true,
+	"application/zip":              true,
+	"application/x-zip-compressed": true,
+}
+
+// many mailers send everything as octet-stream, so the extension decides for them
+var attachmentTypesByExtension = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".xml":  "application/xml",
+	".zip":  "application/zip",
+}
+
+// AttachmentType resolves the effective MIME type of an attachment and reports whether
+// it is a type worth staging.
+func AttachmentType(mimeType, filename string) (string, bool) {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		ext := strings.ToLower(path.Ext(filename))
+		if byExt, ok := attachmentTypesByExtension[ext]; ok {
+			mimeType = byExt
+		}
+	}
+	return mimeType, allowedAttachmentTypes[mimeType]
+}
+
+// IsInlineImage reports images that are rendered inside the HTML body, which is how
+// logos and signature images arrive. An attachment disposition always wins, Gmail and
+// phones give attached photos a Content-ID too, so a Content-ID only counts when the
+// HTML actually shows it.
+func IsInlineImage(mimeType, disposition, contentID string, htmlBody []byte) bool {
+	if !strings.HasPrefix(mimeType, "image/") {
+		return false
+	}
+	disposition = strings.ToLower(strings.TrimSpace(disposition))
+	if strings.HasPrefix(disposition, "attachment") {
+		return false
+	}
+	if contentID = strings.Trim(strings.TrimSpace(contentID), "<>"); contentID != "" {
+		return bytes.Contains(htmlBody, []byte("cid:"+contentID))
+	}
+	return strings.HasPrefix(disposition, "inline")
+}
+
+// Parse reads a raw RFC 822 message and decodes its body and parts. Forwarded
+// messages attached as message/rfc822 are parsed into the same result.
+func Parse(raw []byte) (*Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	parsed := &Message{Header: msg.Header}
+	err = parsed.walk(msg.Header, msg.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// Attachments returns the parts that would be staged as invoice documents.
+func (m *Message) Attachments() []Part {
+	var attachments []Part
+	for _, part := range m.Parts {
+		if part.Filename == "" {
+			continue
+		}
+		mimeType, ok := AttachmentType(part.MimeType, part.Filename)
+		if !ok || IsInlineImage(mimeType, part.Disposition, part.ContentID, m.HTMLBody) {
+			continue
+		}
+		part.MimeType = mimeType
+		attachments = append(attachments, part)
+	}
+	return attachments
+}
+
+// StandaloneHTML returns the HTML body with every cid: image reference replaced by a
+// data URI, so the document renders without the rest of the message. Plain text only
+// messages are wrapped in a pre block. ok is false when the message has no body.
+func (m *Message) StandaloneHTML() (doc []byte, ok bool) {
+	if len(m.HTMLBody) == 0 {
+		if strings.TrimSpace(m.TextBody) == "" {
+			return nil, false
+		}
+		return []byte("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head><body><pre>" +
+			html.EscapeString(m.TextBody) + "</pre></body></html>\n"), true
+	}
+
+	body := m.HTMLBody
+	for _, part := range m.Parts {
+		if part.ContentID == "" {
+			continue
+		}
+		dataURI := "data:" + part.MimeType + ";base64," + base64.StdEncoding.EncodeToString(part.Data)
+		body = bytes.ReplaceAll(body, []byte("cid:"+part.ContentID), []byte(dataURI))
+	}
+
+	// the original charset lives in the MIME header, which the standalone file loses
+	if m.HTMLCharset != "" && !bytes.Contains(bytes.ToLower(body), []byte("charset")) {
+		body = append([]byte(`<meta charset="`+m.HTMLCharset+`">`+"\n"), body...)
+	}
+	return body, true
+}
+
+// PlainText returns the body as text, the plain part when there is one and otherwise
+// the HTML with its tags stripped.
+func (m *Message) PlainText() string {
+	if strings.TrimSpace(m.TextBody) != "" {
+		return toUTF8([]byte(m.TextBody))
+	}
+	body := scriptPattern.ReplaceAll(m.HTMLBody, nil)
+	body = blockTagPattern.ReplaceAll(body, []byte("\n"))
+	body = tagPattern.ReplaceAll(body, []byte(" "))
+
+	var lines []string
+	for _, line := range strings.Split(html.UnescapeString(toUTF8(body)), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	scriptPattern   = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	blockTagPattern = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])\b[^>]*>`)
+	tagPattern      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// toUTF8 reads anything that isn't UTF-8 as windows-1255, the legacy charset of
+// Hebrew mail. Its Latin half matches Latin-1.
+func toUTF8(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	var out strings.Builder
+	for _, c := range b {
+		switch {
+		case c >= 0xe0 && c <= 0xfa:
+			out.WriteRune(rune(0x05d0 + int(c) - 0xe0))
+		case c == 0xa4:
+			out.WriteRune('₪')
+		default:
+			out.WriteRune(rune(c))
+		}
+	}
+	return out.String()
+}
+
+// header is satisfied by both mail.Header and textproto.MIMEHeader
+type header interface {
+	Get(key string) string
+}
+
+// deepest multipart or forwarded message nesting followed, real mail stays well below
+const maxNesting = 20
+
+func (m *Message) walk(h header, body io.Reader, depth int) error {
+	if depth > maxNesting {
+		return fmt.Errorf("message is nested more than %d levels deep", maxNesting)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s part: %w", mediaType, err)
+			}
+			if err := m.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := decodeBody(h.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return err
+	}
+
+	if mediaType == "message/rfc822" {
+		forwarded, err := mail.ReadMessage(bytes.NewReader(data))
+		if err == nil {
+			return m.walk(forwarded.Header, forwarded.Body, depth+1)
+		}
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := DecodeHeader(dispositionParams["filename"])
+	if filename == "" {
+		filename = DecodeHeader(params["name"])
+	}
+	contentID := strings.Trim(strings.TrimSpace(h.Get("Content-ID")), "<>")
+
+	if filename == "" && disposition != "attachment" {
+		switch mediaType {
+		case "text/html":
+			if m.HTMLBody == nil {
+				m.HTMLBody = data
+				m.HTMLCharset = params["charset"]
+			}
+			return nil
+		case "text/plain":
+			if m.TextBody == "" {
+				m.TextBody = string(data)
+			}
+			return nil
+		}
+	}
+
+	m.Parts = append(m.Parts, Part{
+		Filename:    filename,
+		MimeType:    mediaType,
+		ContentID:   contentID,
+		Disposition: disposition,
+		Data:        data,
+	})
+	return nil
+}
+
+func decodeBody(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 part: %w", err)
+		}
+		return data, nil
+	case "quoted-printable":
+		data, err := io.ReadAll(quotedprintable.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode quoted-printable part: %w", err)
+		}
+		return data, nil
+	default:
+		return io.ReadAll(body)
+	}
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+// DecodeHeader decodes RFC 2047 encoded words such as =?UTF-8?B?...?= in header values
+// and filenames, which net/mail and mime.ParseMediaType leave alone.
+func DecodeHeader(s string) string {
+	decoded, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
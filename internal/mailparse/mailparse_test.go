@@ -0,0 +1,200 @@
+package mailparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const receiptMessage = "From: Wolt <info@wolt.com>\r\n" +
+	"Subject: =?UTF-8?B?15fXqdeR15XXoNeZ16o=?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=\"windows-1255\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><body><img src=3D\"cid:logo@wolt\">Total 42.00</body></html>\r\n" +
+	"--inner\r\n" +
+	"Content-Type: image/png; name=\"logo.png\"\r\n" +
+	"Content-ID: <logo@wolt>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0K\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=\"=?UTF-8?B?15fXqdeR15XXoNeZ16o=?=.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQ=\r\n" +
+	"--outer--\r\n"
+
+func TestParse(t *testing.T) {
+	msg, err := Parse([]byte(receiptMessage))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	if got := DecodeHeader(msg.Header.Get("Subject")); got != "חשבונית" {
+		t.Errorf("expected decoded subject, but got %q", got)
+	}
+
+	attachments := msg.Attachments()
+	if len(attachments) != 1 {
+		t.Fatalf("expected 1 attachment, but got %d", len(attachments))
+	}
+	if attachments[0].Filename != "חשבונית.pdf" || attachments[0].MimeType != "application/pdf" {
+		t.Errorf("unexpected attachment %q of type %s", attachments[0].Filename, attachments[0].MimeType)
+	}
+	if string(attachments[0].Data) != "%PDF-1.4" {
+		t.Errorf("unexpected attachment data %q", attachments[0].Data)
+	}
+
+	doc, ok := msg.StandaloneHTML()
+	if !ok {
+		t.Fatal("expected an HTML document")
+	}
+	if !strings.Contains(string(doc), `src="data:image/png;base64,iVBORw0K"`) {
+		t.Errorf("expected inline image to be embedded, got %s", doc)
+	}
+	if !strings.HasPrefix(string(doc), `<meta charset="windows-1255">`) {
+		t.Errorf("expected charset declaration, got %s", doc)
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+	testCases := []struct {
+		name    string
+		depth   int
+		wantErr bool
+	}{
+		{name: "Within Limit", depth: maxNesting},
+		{name: "Too Deep", depth: maxNesting + 1, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var raw strings.Builder
+			raw.WriteString("Subject: nested\r\nContent-Type: multipart/mixed; boundary=\"b0\"\r\n\r\n")
+			for i := 1; i < tc.depth; i++ {
+				fmt.Fprintf(&raw, "--b%d\r\nContent-Type: multipart/mixed; boundary=\"b%d\"\r\n\r\n", i-1, i)
+			}
+			fmt.Fprintf(&raw, "--b%d\r\nContent-Type: text/plain\r\n\r\nTotal 42.00\r\n", tc.depth-1)
+			for i := tc.depth - 1; i >= 0; i-- {
+				fmt.Fprintf(&raw, "--b%d--\r\n", i)
+			}
+
+			msg, err := Parse([]byte(raw.String()))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected an error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse message: %v", err)
+			}
+			if !strings.Contains(msg.TextBody, "Total 42.00") {
+				t.Errorf("expected the innermost body, but got %q", msg.TextBody)
+			}
+		})
+	}
+}
+
+func TestAttachmentsWithContentID(t *testing.T) {
+	testCases := []struct {
+		name        string
+		html        string
+		disposition string
+		expected    int
+	}{
+		{name: "Attached Photo", html: "<p>receipt attached</p>", disposition: "attachment; filename=\"receipt.jpg\"", expected: 1},
+		{name: "Attached Photo Shown In Body", html: "<img src=\"cid:ii_m1\">", disposition: "attachment; filename=\"receipt.jpg\"", expected: 1},
+		{name: "Inline Photo Not In Body", html: "<p>receipt attached</p>", disposition: "inline; filename=\"receipt.jpg\"", expected: 1},
+		{name: "Logo Shown In Body", html: "<img src=\"cid:ii_m1\">", disposition: "", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := "Subject: Receipt\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				tc.html + "\r\n" +
+				"--b\r\n" +
+				"Content-Type: image/jpeg; name=\"receipt.jpg\"\r\n"
+			if tc.disposition != "" {
+				raw += "Content-Disposition: " + tc.disposition + "\r\n"
+			}
+			raw += "Content-ID: <ii_m1>\r\n" +
+				"X-Attachment-Id: ii_m1\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"/9j/4AAQ\r\n" +
+				"--b--\r\n"
+
+			msg, err := Parse([]byte(raw))
+			if err != nil {
+				t.Fatalf("failed to parse message: %v", err)
+			}
+			if got := len(msg.Attachments()); got != tc.expected {
+				t.Errorf("expected %d attachments, but got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestStandaloneHTMLPlainText(t *testing.T) {
+	msg, err := Parse([]byte("Subject: Receipt\r\n\r\nTotal <42.00>\r\n"))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+
+	doc, ok := msg.StandaloneHTML()
+	if !ok {
+		t.Fatal("expected an HTML document")
+	}
+	if !strings.Contains(string(doc), "<pre>Total &lt;42.00&gt;") {
+		t.Errorf("expected escaped text body, got %s", doc)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		msg      *Message
+		expected string
+	}{
+		{
+			name:     "Text Body",
+			msg:      &Message{TextBody: "Total 42.00", HTMLBody: []byte("<p>ignored</p>")},
+			expected: "Total 42.00",
+		},
+		{
+			name:     "Stripped HTML",
+			msg:      &Message{HTMLBody: []byte("<html><head><style>p{}</style></head><body><p>Receipt</p>Total&nbsp;<b>42.00</b></body></html>")},
+			expected: "Receipt\nTotal 42.00",
+		},
+		{
+			name:     "Windows-1255",
+			msg:      &Message{HTMLBody: []byte("\xf7\xe1\xec\xe4 42 \xa4")},
+			expected: "קבלה 42 ₪",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.msg.PlainText(); got != tc.expected {
+				t.Errorf("expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
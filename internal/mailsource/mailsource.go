@@ -0,0 +1,162 @@
+package mailsource
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// MailSource is a mailbox the scanner can read invoices from. Message IDs are opaque to
+// callers and only have to be stable for the lifetime of the message in that mailbox.
+type MailSource interface {
+	// Name is stored as the source of every invoice staged from this mailbox.
+	Name() string
+	// Search returns the IDs of matching messages, newest first. A limit of 0 returns all.
+	Search(ctx context.Context, criteria SearchCriteria, limit int) ([]string, error)
+	GetMetadata(ctx context.Context, messageID string) (*Message, error)
+	// GetAttachment downloads the attachment identified by Attachment.PartID.
+	GetAttachment(ctx context.Context, messageID, partID string) ([]byte, error)
+	// GetRaw returns the complete RFC 822 source of the message.
+	GetRaw(ctx context.Context, messageID string) ([]byte, error)
+}
+
+type Message struct {
+	ID       string
+	ThreadID string
+	// InternetMessageID is the Message-ID header, the same in every mailbox and export
+	InternetMessageID string
+	From              string
+	Subject           string
+	Snippet           string
+	// Body is the text of the message when the source fetched it along
+	Body   string
+	Labels []string
+	// ListUnsubscribe is set when the message has a List-Unsubscribe header, which
+	// newsletters have and invoices rarely do
+	ListUnsubscribe bool
+	ReceivedAt      time.Time
+	Attachments     []Attachment
+}
+
+type Attachment struct {
+	PartID   string
+	Filename string
+	MimeType string
+	Size     int64
+}
+
+// SearchCriteria selects the messages a scan stages. A message matches when it passes
+// every filter and either contains one of the keywords or comes from an allowed
+// sender. Subject keywords are looked for in the subject, body keywords in the body.
+// Matching is case insensitive.
+type SearchCriteria struct {
+	SubjectKeywords []string
+	BodyKeywords    []string
+
+	// senders are full addresses or domains, a domain covers its subdomains too
+	AllowedSenders []string
+	BlockedSenders []string
+
+	// labels are Gmail label names, sources without labels ignore them
+	IncludeLabels []string
+	ExcludeLabels []string
+
+	// messages received before After never match
+	After time.Time
+
+	// matching messages that score below MinScore are staged as low confidence
+	MinScore int
+}
+
+// InvoiceCriteria is what a scan looks for unless the user configured otherwise.
+var InvoiceCriteria = SearchCriteria{
+	SubjectKeywords: []string{"invoice", "receipt", "bill from", "חשבונית", "קבלה"},
+	BodyKeywords:    []string{"invoice", "receipt", "חשבונית", "קבלה"},
+	MinScore:        DefaultMinScore,
+}
+
+// IsEmpty reports whether nothing could ever match, an empty Gmail query would
+// otherwise match the whole mailbox.
+func (c SearchCriteria) IsEmpty() bool {
+	return len(c.SubjectKeywords) == 0 && len(c.BodyKeywords) == 0 && len(c.AllowedSenders) == 0
+}
+
+// Matches applies the criteria locally. Body keywords are looked for in the body,
+// or in the snippet when the source didn't fetch it, which a mailbox search would
+// have matched against the whole text.
+func (c SearchCriteria) Matches(msg *Message) bool {
+	if !c.After.IsZero() && msg.ReceivedAt.Before(c.After) {
+		return false
+	}
+
+	for _, sender := range c.BlockedSenders {
+		if SenderMatches(msg.From, sender) {
+			return false
+		}
+	}
+
+	if len(c.IncludeLabels) > 0 && !hasAnyLabel(msg.Labels, c.IncludeLabels) {
+		return false
+	}
+	if hasAnyLabel(msg.Labels, c.ExcludeLabels) {
+		return false
+	}
+
+	for _, sender := range c.AllowedSenders {
+		if SenderMatches(msg.From, sender) {
+			return true
+		}
+	}
+
+	subject := strings.ToLower(msg.Subject)
+	for _, keyword := range c.SubjectKeywords {
+		if strings.Contains(subject, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+
+	body := msg.Body
+	if body == "" {
+		body = msg.Snippet
+	}
+	body = strings.ToLower(body)
+	for _, keyword := range c.BodyKeywords {
+		if strings.Contains(body, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SenderMatches reports whether the From header is the sender, an address such as
+// billing@acme.com, or belongs to the domain such as acme.com.
+func SenderMatches(from, sender string) bool {
+	address := senderAddress(from)
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	if sender == "" {
+		return false
+	}
+
+	if strings.Contains(strings.TrimPrefix(sender, "@"), "@") {
+		return address == sender
+	}
+	domain := strings.TrimPrefix(sender, "@")
+	return strings.HasSuffix(address, "@"+domain) || strings.HasSuffix(address, "."+domain)
+}
+
+// NormalizeLabel turns a label name into the form Gmail uses in label: searches.
+func NormalizeLabel(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	return strings.NewReplacer(" ", "-", "/", "-").Replace(label)
+}
+
+func hasAnyLabel(labels, wanted []string) bool {
+	for _, label := range labels {
+		for _, w := range wanted {
+			if NormalizeLabel(label) == NormalizeLabel(w) {
+				return true
+			}
+		}
+	}
+	return false
+}
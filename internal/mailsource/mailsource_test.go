@@ -0,0 +1,240 @@
+package mailsource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/automation"
+)
+
+func TestInvoiceCriteriaMatches(t *testing.T) {
+	testCases := []struct {
+		name     string
+		subject  string
+		snippet  string
+		body     string
+		expected bool
+	}{
+		{name: "Subject Keyword", subject: "Your Invoice #1234", expected: true},
+		{name: "Bill From Subject", subject: "Your bill from Acme", expected: true},
+		{name: "Snippet Keyword", subject: "Order update", snippet: "Please find your receipt attached", expected: true},
+		{name: "No Keywords", subject: "Weekly newsletter", snippet: "Top stories this week", expected: false},
+		{name: "Body Keyword Past Snippet", subject: "Order update", snippet: "Thanks for your order", body: "Thanks for your order.\n...\nYour receipt is attached", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &Message{Subject: tc.subject, Snippet: tc.snippet, Body: tc.body}
+			if got := InvoiceCriteria.Matches(msg); got != tc.expected {
+				t.Errorf("expected match %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestScanStatsAdd(t *testing.T) {
+	a := ScanStats{Seen: 3, Staged: 1, Skipped: 1, Failed: 1, LastError: "first"}
+	b := ScanStats{Seen: 2, Staged: 2}
+
+	sum := a.Add(b)
+	if sum.Seen != 5 || sum.Staged != 3 || sum.Skipped != 1 || sum.Failed != 1 {
+		t.Errorf("unexpected totals: %+v", sum)
+	}
+	if sum.LastError != "first" {
+		t.Errorf("expected last error to be kept, but got %q", sum.LastError)
+	}
+	if got := sum.Add(ScanStats{LastError: "second"}).LastError; got != "second" {
+		t.Errorf("expected newer error, but got %q", got)
+	}
+}
+
+func TestCriteriaFilters(t *testing.T) {
+	criteria := SearchCriteria{
+		SubjectKeywords: []string{"invoice"},
+		AllowedSenders:  []string{"billing@acme.com", "@paddle.com"},
+		BlockedSenders:  []string{"news.example.com"},
+		ExcludeLabels:   []string{"CATEGORY_PROMOTIONS"},
+		After:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	recent := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		msg      Message
+		expected bool
+	}{
+		{name: "Keyword", msg: Message{Subject: "Invoice 1", ReceivedAt: recent}, expected: true},
+		{name: "Allowed Address", msg: Message{From: "Acme <billing@acme.com>", Subject: "Your order", ReceivedAt: recent}, expected: true},
+		{name: "Allowed Subdomain", msg: Message{From: "noreply@mail.paddle.com", Subject: "Payment", ReceivedAt: recent}, expected: true},
+		{name: "Other Address At Allowed Domain", msg: Message{From: "sales@acme.com", Subject: "Hello", ReceivedAt: recent}, expected: false},
+		{name: "Blocked Sender", msg: Message{From: "weekly@news.example.com", Subject: "Invoice tips", ReceivedAt: recent}, expected: false},
+		{name: "Excluded Label", msg: Message{Subject: "Invoice", Labels: []string{"CATEGORY_PROMOTIONS"}, ReceivedAt: recent}, expected: false},
+		{name: "Before Date Floor", msg: Message{Subject: "Invoice", ReceivedAt: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)}, expected: false},
+		{name: "Hebrew Default", msg: Message{Subject: "חשבונית מס 1001"}, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := criteria
+			if tc.name == "Hebrew Default" {
+				c = InvoiceCriteria
+			}
+			if got := c.Matches(&tc.msg); got != tc.expected {
+				t.Errorf("expected match %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	rules := Rules{
+		UseDefaultKeywords: false,
+		IncludeKeywords:    []string{" Rechnung ", "rechnung", ""},
+		IncludeLabels:      []string{"Receipts"},
+		DateFloor:          "2024-01-01",
+	}
+	if err := rules.Normalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules.IncludeKeywords) != 1 || rules.IncludeKeywords[0] != "Rechnung" {
+		t.Errorf("expected keywords to be trimmed and deduplicated, but got %q", rules.IncludeKeywords)
+	}
+
+	criteria := rules.Criteria()
+	if len(criteria.SubjectKeywords) != 1 || len(criteria.BodyKeywords) != 1 {
+		t.Errorf("expected include keywords in subject and body only, but got %+v", criteria)
+	}
+	if !criteria.After.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date floor %v", criteria.After)
+	}
+
+	invalid := []Rules{
+		{UseDefaultKeywords: false},
+		{UseDefaultKeywords: true, DateFloor: "01/01/2024"},
+	}
+	for _, r := range invalid {
+		if err := r.Normalize(); err == nil {
+			t.Errorf("expected rules %+v to be rejected", r)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	history := SenderHistory{
+		"billing@acme.com":   {Approved: 3},
+		"deals@shop.example": {Rejected: 2},
+	}
+	pdf := []Attachment{{Filename: "invoice-1001.pdf", MimeType: "application/pdf"}}
+
+	testCases := []struct {
+		name     string
+		msg      Message
+		expected int
+	}{
+		{
+			name:     "Invoice With PDF",
+			msg:      Message{From: "billing@other.com", Subject: "Invoice 1001", Attachments: pdf},
+			expected: 85,
+		},
+		{
+			name:     "Hebrew Tax Invoice",
+			msg:      Message{From: "x@y.co.il", Subject: "חשבונית מס 1001", Snippet: "מצורפת חשבונית"},
+			expected: 65,
+		},
+		{
+			name:     "Approved Sender",
+			msg:      Message{From: "Acme <billing@acme.com>", Subject: "Your monthly statement"},
+			expected: 50,
+		},
+		{
+			name: "Promotion",
+			msg: Message{
+				From:            "deals@shop.example",
+				Subject:         "Summer sale! Keep your receipt",
+				ListUnsubscribe: true,
+				Labels:          []string{"CATEGORY_PROMOTIONS"},
+			},
+			expected: 0,
+		},
+		{
+			name:     "Clamped",
+			msg:      Message{From: "billing@acme.com", Subject: "Invoice", Snippet: "receipt", Attachments: pdf, Labels: []string{"CATEGORY_UPDATES"}},
+			expected: MaxScore,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Score(&tc.msg, history); got != tc.expected {
+				t.Errorf("expected score %d, but got %d", tc.expected, got)
+			}
+		})
+	}
+
+	assessor := Assessor{History: history, MinScore: DefaultMinScore}
+	if status := assessor.Assess(&testCases[0].msg).Status; status != StatusPendingReview {
+		t.Errorf("expected %s, but got %s", StatusPendingReview, status)
+	}
+	if status := assessor.Assess(&testCases[3].msg).Status; status != StatusLowConfidence {
+		t.Errorf("expected %s, but got %s", StatusLowConfidence, status)
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		keyword  string
+		expected bool
+	}{
+		{name: "Whole Word", s: "summer sale!", keyword: "sale", expected: true},
+		{name: "Inside Word", s: "wholesale order 1001", keyword: "sale", expected: false},
+		{name: "Prefix Of Word", s: "invoice from your dealer", keyword: "deal", expected: false},
+		{name: "Later Occurrence", s: "wholesale deal", keyword: "deal", expected: true},
+		{name: "Symbol Keyword", s: "20% off everything", keyword: "% off", expected: true},
+		{name: "Hebrew", s: "מבצע: 50% הנחה", keyword: "הנחה", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containsWord(tc.s, tc.keyword); got != tc.expected {
+				t.Errorf("expected %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAssessRules(t *testing.T) {
+	assessor := Assessor{
+		MinScore: DefaultMinScore,
+		Rules: []automation.Rule{
+			{ID: "1", Name: "Acme", SenderDomain: "acme.com", Action: automation.ActionAutoApprove},
+			{ID: "2", Name: "Shop", SenderDomain: "shop.example", Action: automation.ActionAutoReject},
+			{ID: "3", Name: "Spam", SenderDomain: "spam.example", Action: automation.ActionSkip},
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		from   string
+		status string
+		skip   bool
+	}{
+		{name: "Auto Approve Low Score", from: "hello@acme.com", status: StatusApprovalQueued},
+		{name: "Auto Reject", from: "deals@shop.example", status: StatusRejected},
+		{name: "Skip", from: "x@spam.example", status: StatusLowConfidence, skip: true},
+		{name: "No Rule", from: "someone@else.org", status: StatusLowConfidence},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assessment := assessor.Assess(&Message{From: tc.from, Subject: "Hello"})
+			if assessment.Status != tc.status {
+				t.Errorf("expected status %s, but got %s", tc.status, assessment.Status)
+			}
+			if assessment.Skip() != tc.skip {
+				t.Errorf("expected skip %v, but got %v", tc.skip, assessment.Skip())
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package mailsource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/mailparse"
+)
+
+// how much of the text body is kept as the snippet
+const snippetLength = 200
+
+// ParseRaw builds a Message from RFC 822 source, for mailboxes that only hand out whole
+// messages. Attachments are numbered by their position among the allowed attachments,
+// which is what RawAttachment expects as part ID. A zero receivedAt falls back to the
+// Date header.
+func ParseRaw(messageID string, raw []byte, receivedAt time.Time) (*Message, error) {
+	parsed, err := mailparse.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message %s: %w", messageID, err)
+	}
+
+	if receivedAt.IsZero() {
+		receivedAt, _ = parsed.Header.Date()
+	}
+
+	var attachments []Attachment
+	for i, part := range parsed.Attachments() {
+		attachments = append(attachments, Attachment{
+			PartID:   strconv.Itoa(i),
+			Filename: part.Filename,
+			MimeType: part.MimeType,
+			Size:     int64(len(part.Data)),
+		})
+	}
+
+	// without threads the Message-ID header is the closest stable identifier
+	internetMessageID := strings.TrimSpace(parsed.Header.Get("Message-ID"))
+	return &Message{
+		ID:                messageID,
+		ThreadID:          internetMessageID,
+		InternetMessageID: internetMessageID,
+		From:              mailparse.DecodeHeader(parsed.Header.Get("From")),
+		Subject:           mailparse.DecodeHeader(parsed.Header.Get("Subject")),
+		Snippet:           snippet(parsed.TextBody),
+		Body:              parsed.PlainText(),
+		ListUnsubscribe:   parsed.Header.Get("List-Unsubscribe") != "",
+		ReceivedAt:        receivedAt,
+		Attachments:       attachments,
+	}, nil
+}
+
+// RawAttachment returns the attachment ParseRaw numbered partID.
+func RawAttachment(raw []byte, partID string) ([]byte, error) {
+	parsed, err := mailparse.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	attachments := parsed.Attachments()
+	i, err := strconv.Atoi(partID)
+	if err != nil || i < 0 || i >= len(attachments) {
+		return nil, fmt.Errorf("part %s is not in the message", partID)
+	}
+	return attachments[i].Data, nil
+}
+
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > snippetLength {
+		text = string(runes[:snippetLength])
+	}
+	return text
+}
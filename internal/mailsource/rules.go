@@ -0,0 +1,115 @@
+package mailsource
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// limits that keep a compiled Gmail query well below the length Gmail accepts
+const (
+	maxRuleEntries     = 50
+	maxRuleEntryLength = 100
+)
+
+// DateFloorLayout is the format of Rules.DateFloor.
+const DateFloorLayout = "2006-01-02"
+
+// Rules are a user's scan settings in the shape they're stored and edited in.
+type Rules struct {
+	// UseDefaultKeywords keeps the keywords of InvoiceCriteria next to IncludeKeywords
+	UseDefaultKeywords bool     `json:"use_default_keywords"`
+	IncludeKeywords    []string `json:"include_keywords"`
+	AllowedSenders     []string `json:"allowed_senders"`
+	BlockedSenders     []string `json:"blocked_senders"`
+	IncludeLabels      []string `json:"include_labels"`
+	ExcludeLabels      []string `json:"exclude_labels"`
+	// DateFloor is a YYYY-MM-DD date, empty for no floor
+	DateFloor string `json:"date_floor"`
+	// MinScore is the score from 0 to MaxScore a message needs to be staged for review
+	MinScore int `json:"min_score"`
+}
+
+// DefaultRules are the rules of users who never configured any.
+func DefaultRules() Rules {
+	return Rules{UseDefaultKeywords: true, MinScore: DefaultMinScore}
+}
+
+// Normalize trims and deduplicates every list and checks the rules can be compiled.
+func (r *Rules) Normalize() error {
+	lists := []struct {
+		name   string
+		values *[]string
+	}{
+		{"include_keywords", &r.IncludeKeywords},
+		{"allowed_senders", &r.AllowedSenders},
+		{"blocked_senders", &r.BlockedSenders},
+		{"include_labels", &r.IncludeLabels},
+		{"exclude_labels", &r.ExcludeLabels},
+	}
+	for _, list := range lists {
+		normalized, err := normalizeList(*list.values)
+		if err != nil {
+			return fmt.Errorf("%s: %w", list.name, err)
+		}
+		*list.values = normalized
+	}
+
+	r.DateFloor = strings.TrimSpace(r.DateFloor)
+	if r.DateFloor != "" {
+		if _, err := time.Parse(DateFloorLayout, r.DateFloor); err != nil {
+			return fmt.Errorf("date_floor must be a YYYY-MM-DD date, got %q", r.DateFloor)
+		}
+	}
+
+	if r.MinScore < 0 || r.MinScore > MaxScore {
+		return fmt.Errorf("min_score must be between 0 and %d", MaxScore)
+	}
+
+	if r.Criteria().IsEmpty() {
+		return fmt.Errorf("rules need at least one keyword or allowed sender")
+	}
+	return nil
+}
+
+// Criteria compiles the rules. Include keywords are looked for in both subject and body.
+func (r Rules) Criteria() SearchCriteria {
+	var criteria SearchCriteria
+	if r.UseDefaultKeywords {
+		criteria.SubjectKeywords = append(criteria.SubjectKeywords, InvoiceCriteria.SubjectKeywords...)
+		criteria.BodyKeywords = append(criteria.BodyKeywords, InvoiceCriteria.BodyKeywords...)
+	}
+	criteria.SubjectKeywords = append(criteria.SubjectKeywords, r.IncludeKeywords...)
+	criteria.BodyKeywords = append(criteria.BodyKeywords, r.IncludeKeywords...)
+
+	criteria.AllowedSenders = r.AllowedSenders
+	criteria.BlockedSenders = r.BlockedSenders
+	criteria.IncludeLabels = r.IncludeLabels
+	criteria.ExcludeLabels = r.ExcludeLabels
+	criteria.MinScore = r.MinScore
+
+	if r.DateFloor != "" {
+		criteria.After, _ = time.Parse(DateFloorLayout, r.DateFloor)
+	}
+	return criteria
+}
+
+func normalizeList(values []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		if len([]rune(value)) > maxRuleEntryLength {
+			return nil, fmt.Errorf("%q is longer than %d characters", value, maxRuleEntryLength)
+		}
+		seen[strings.ToLower(value)] = true
+		normalized = append(normalized, value)
+	}
+	if len(normalized) > maxRuleEntries {
+		return nil, fmt.Errorf("at most %d entries are allowed", maxRuleEntries)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,323 @@
+package mailsource
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyStaged is returned by StageMessage for a message whose Message-ID the user
+// already has staged, from this source or another one.
+var ErrAlreadyStaged = errors.New("message is already staged")
+
+// invoice events recorded when a message is staged, an auto-rejected one gets both
+const (
+	EventStaged       = "staged"
+	EventAutoRejected = "auto_rejected"
+)
+
+// Scanner stages new invoice messages from one mailbox.
+type Scanner interface {
+	ScanAndStageInvoices(ctx context.Context, db *database.Queries, userID string, criteria SearchCriteria, progress ProgressFunc) (ScanStats, error)
+}
+
+// ScanStats counts what a scan did with the messages it looked at.
+type ScanStats struct {
+	Seen      int64
+	Staged    int64
+	Skipped   int64
+	Failed    int64
+	LastError string
+}
+
+// Add returns the sum of both stats, keeping the most recent error.
+func (s ScanStats) Add(other ScanStats) ScanStats {
+	sum := ScanStats{
+		Seen:      s.Seen + other.Seen,
+		Staged:    s.Staged + other.Staged,
+		Skipped:   s.Skipped + other.Skipped,
+		Failed:    s.Failed + other.Failed,
+		LastError: s.LastError,
+	}
+	if other.LastError != "" {
+		sum.LastError = other.LastError
+	}
+	return sum
+}
+
+// ProgressFunc receives the running totals of a scan as it goes.
+type ProgressFunc func(stats ScanStats)
+
+// Scan is one pass over a mailbox. It knows which messages are already staged, scores
+// the ones it stages and keeps the stats up to date as messages are staged or fail.
+type Scan struct {
+	DB     *database.Queries
+	UserID string
+	Source string
+	Stats  ScanStats
+
+	stagedIDs map[string]bool
+	assessor  *Assessor
+	progress  ProgressFunc
+}
+
+func NewScan(ctx context.Context, db *database.Queries, userID, source string, criteria SearchCriteria, progress ProgressFunc) (*Scan, error) {
+	messageIDs, err := db.ListStagedMessageIDsByUser(ctx, database.ListStagedMessageIDsByUserParams{
+		UserID: userID,
+		Source: source,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged message IDs: %w", err)
+	}
+
+	stagedIDs := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		stagedIDs[id.String] = true
+	}
+
+	assessor, err := NewAssessor(ctx, db, userID, criteria.MinScore)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Scan{
+		DB:        db,
+		UserID:    userID,
+		Source:    source,
+		stagedIDs: stagedIDs,
+		assessor:  assessor,
+		progress:  progress,
+	}, nil
+}
+
+func (sc *Scan) IsStaged(messageID string) bool {
+	return sc.stagedIDs[messageID]
+}
+
+func (sc *Scan) Fail(messageID string, err error) {
+	sc.Stats.Failed++
+	sc.Stats.LastError = fmt.Sprintf("message %s: %v", messageID, err)
+}
+
+func (sc *Scan) ReportProgress() {
+	if sc.progress != nil {
+		sc.progress(sc.Stats)
+	}
+}
+
+// Stage assesses the message and records it and its attachments as a staged invoice,
+// unless one of the user's rules skips it.
+func (sc *Scan) Stage(ctx context.Context, msg *Message) error {
+	assessment := sc.assessor.Assess(msg)
+	if assessment.Skip() {
+		log.Printf("A rule skipped message %s with subject: %s", msg.ID, msg.Subject)
+		sc.Stats.Skipped++
+		return nil
+	}
+
+	err := StageMessage(ctx, sc.DB, sc.UserID, sc.Source, msg, assessment)
+	if errors.Is(err, ErrAlreadyStaged) {
+		log.Printf("Message %s is already staged as %s", msg.ID, msg.InternetMessageID)
+		sc.stagedIDs[msg.ID] = true
+		sc.Stats.Skipped++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sc.stagedIDs[msg.ID] = true
+	sc.Stats.Staged++
+	return nil
+}
+
+// recordStagedEvents starts the invoice's history. The invoice is staged by then, so
+// a failure to record is only logged.
+func recordStagedEvents(ctx context.Context, db *database.Queries, invoiceID, status string, now int64) {
+	events := []string{EventStaged}
+	if status == StatusRejected {
+		events = append(events, EventAutoRejected)
+	}
+	for _, event := range events {
+		err := db.CreateInvoiceEvent(ctx, database.CreateInvoiceEventParams{
+			ID:              uuid.New().String(),
+			StagedInvoiceID: invoiceID,
+			Event:           event,
+			ToStatus:        sql.NullString{String: status, Valid: true},
+			Actor:           "automation",
+			CreatedAt:       now,
+		})
+		if err != nil {
+			log.Printf("Failed to record %s event of invoice %s: %v", event, invoiceID, err)
+		}
+	}
+}
+
+// AlreadyStaged reports whether the user has a message with the Message-ID staged.
+// Messages without one can't be told apart and never count as staged.
+func AlreadyStaged(ctx context.Context, db *database.Queries, userID, internetMessageID string) (bool, error) {
+	if internetMessageID == "" {
+		return false, nil
+	}
+	_, err := db.GetStagedInvoiceByInternetMessageID(ctx, database.GetStagedInvoiceByInternetMessageIDParams{
+		UserID:            userID,
+		InternetMessageID: sql.NullString{String: internetMessageID, Valid: true},
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up Message-ID %s: %w", internetMessageID, err)
+	}
+	return true, nil
+}
+
+// StageMessage records the message and its attachments as a staged invoice from source,
+// with what the assessment decided about it, including the rules that applied. The
+// same message reaching the user twice, say forwarded and found in their mailbox, is
+// staged once.
+func StageMessage(ctx context.Context, db *database.Queries, userID, source string, msg *Message, assessment Assessment) error {
+	staged, err := AlreadyStaged(ctx, db, userID, msg.InternetMessageID)
+	if err != nil {
+		return err
+	}
+	if staged {
+		return ErrAlreadyStaged
+	}
+	now := time.Now().Unix()
+
+	tags, err := json.Marshal(append([]string{}, assessment.Outcome.Tags...))
+	if err != nil {
+		return err
+	}
+
+	invoice, err := db.CreateStagedInvoice(ctx, database.CreateStagedInvoiceParams{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Source:         source,
+		GmailMessageID: sql.NullString{String: msg.ID, Valid: true},
+		InternetMessageID: sql.NullString{
+			String: msg.InternetMessageID,
+			Valid:  msg.InternetMessageID != "",
+		},
+		GmailThreadID:      msg.ThreadID,
+		Status:             assessment.Status,
+		Score:              sql.NullInt64{Int64: int64(assessment.Score), Valid: true},
+		ApproveProbability: assessment.ApproveProbability,
+		Suggestion: sql.NullString{
+			String: assessment.Suggestion,
+			Valid:  assessment.Suggestion != "",
+		},
+		Tags: string(tags),
+		Category: sql.NullString{
+			String: assessment.Outcome.Category,
+			Valid:  assessment.Outcome.Category != "",
+		},
+		Sender:  msg.From,
+		Subject: msg.Subject,
+		Snippet: sql.NullString{
+			String: msg.Snippet,
+			Valid:  true,
+		},
+		HasAttachment: len(msg.Attachments) > 0,
+		ReceivedAt:    msg.ReceivedAt.Unix(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, attachment := range msg.Attachments {
+		err = db.CreateStagedAttachment(ctx, database.CreateStagedAttachmentParams{
+			ID:              uuid.New().String(),
+			StagedInvoiceID: invoice.ID,
+			Position:        int64(i),
+			GmailPartID:     attachment.PartID,
+			Filename:        attachment.Filename,
+			MimeType:        attachment.MimeType,
+			Size:            attachment.Size,
+			CreatedAt:       now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to stage attachment %s: %w", attachment.Filename, err)
+		}
+	}
+
+	for _, hit := range assessment.Outcome.Hits {
+		err = db.CreateInvoiceRuleHit(ctx, database.CreateInvoiceRuleHitParams{
+			ID:              uuid.New().String(),
+			StagedInvoiceID: invoice.ID,
+			RuleID:          hit.RuleID,
+			RuleName:        hit.RuleName,
+			Action:          hit.Action,
+			Value:           hit.Value,
+			CreatedAt:       now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record hit of rule %s: %w", hit.RuleName, err)
+		}
+	}
+
+	recordStagedEvents(ctx, db, invoice.ID, assessment.Status, now)
+
+	log.Printf("Successfully staged message for %s with subject: %s (%d attachments, score %d, %s)", msg.From, msg.Subject, len(msg.Attachments), assessment.Score, assessment.Status)
+	return nil
+}
+
+// SearchScanner scans any MailSource by searching it with the criteria.
+type SearchScanner struct {
+	Source MailSource
+}
+
+// how many messages go by between progress reports
+const progressInterval = 25
+
+func (s SearchScanner) ScanAndStageInvoices(ctx context.Context, db *database.Queries, userID string, criteria SearchCriteria, progress ProgressFunc) (ScanStats, error) {
+	sc, err := NewScan(ctx, db, userID, s.Source.Name(), criteria, progress)
+	if err != nil {
+		return ScanStats{}, err
+	}
+
+	log.Printf("Performing %s scan for user ID %s", s.Source.Name(), userID)
+	if criteria.IsEmpty() {
+		return sc.Stats, nil
+	}
+	messageIDs, err := s.Source.Search(ctx, criteria, 0)
+	if err != nil {
+		return sc.Stats, fmt.Errorf("failed to search %s mailbox: %w", s.Source.Name(), err)
+	}
+
+	for i, messageID := range messageIDs {
+		sc.Stats.Seen++
+		if sc.IsStaged(messageID) {
+			sc.Stats.Skipped++
+			continue
+		}
+
+		msg, err := s.Source.GetMetadata(ctx, messageID)
+		if err != nil {
+			log.Printf("Failed to get message metadata for %s: %v", messageID, err)
+			sc.Fail(messageID, err)
+			continue
+		}
+
+		if err := sc.Stage(ctx, msg); err != nil {
+			log.Printf("Failed to create staged invoice for message %s: %v", messageID, err)
+			sc.Fail(messageID, err)
+		}
+
+		if (i+1)%progressInterval == 0 {
+			sc.ReportProgress()
+		}
+	}
+	sc.ReportProgress()
+	log.Printf("Finished %s scan for user ID %s", s.Source.Name(), userID)
+	return sc.Stats, nil
+}
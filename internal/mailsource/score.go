@@ -0,0 +1,308 @@
+package mailsource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/felixsolom/fetch-duck/internal/automation"
+	"github.com/felixsolom/fetch-duck/internal/classifier"
+	"github.com/felixsolom/fetch-duck/internal/database"
+)
+
+// statuses a message can be staged with
+const (
+	StatusPendingReview = "pending_review"
+	StatusLowConfidence = "low_confidence"
+	// StatusApprovalQueued waits for an auto-approve rule to be carried out
+	StatusApprovalQueued = "approval_queued"
+	StatusRejected       = "rejected"
+)
+
+// DefaultMinScore is the score below which a message is staged as low confidence.
+const DefaultMinScore = 40
+
+// MaxScore is the highest score a message can get.
+const MaxScore = 100
+
+// every message starts from here, so an unremarkable search hit lands below the
+// default threshold until something speaks for it
+const baseScore = 20
+
+// keywords that make a message likely to be an invoice, strongest first
+var (
+	strongKeywords = []string{
+		"tax invoice", "invoice", "receipt", "bill from", "payment confirmation",
+		"חשבונית מס", "חשבונית", "קבלה", "חשבון עסקה", "אישור תשלום",
+	}
+	promotionKeywords = []string{
+		"% off", "sale", "deal", "discount", "newsletter", "webinar", "coupon", "free shipping",
+		"מבצע", "הנחה", "קופון", "ניוזלטר",
+	}
+	attachmentNameKeywords = []string{"invoice", "receipt", "bill", "חשבונית", "קבלה", "inv"}
+)
+
+// Gmail category labels and what they say about a message
+var categoryWeights = map[string]int{
+	"category_promotions": -25,
+	"category_social":     -30,
+	"category_forums":     -15,
+	"category_updates":    5,
+}
+
+// SenderStats counts the user's decisions on earlier invoices from one sender.
+type SenderStats struct {
+	Approved int
+	Rejected int
+}
+
+// SenderHistory is keyed by lowercase sender address.
+type SenderHistory map[string]SenderStats
+
+// LoadSenderHistory collects the user's approvals and rejections per sender.
+func LoadSenderHistory(ctx context.Context, db *database.Queries, userID string) (SenderHistory, error) {
+	decisions, err := db.ListSenderDecisionsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sender decisions: %w", err)
+	}
+
+	history := make(SenderHistory)
+	for _, decision := range decisions {
+		address := senderAddress(decision.Sender)
+		stats := history[address]
+		if decision.Status == "approved" {
+			stats.Approved++
+		} else {
+			stats.Rejected++
+		}
+		history[address] = stats
+	}
+	return history, nil
+}
+
+// Assessor decides how likely a message is to be an invoice, which of the user's
+// rules apply to it and which status it is staged with.
+type Assessor struct {
+	History  SenderHistory
+	MinScore int
+	// Model is the user's classifier, nil to stage without suggestions
+	Model *classifier.Model
+	// Rules are the user's enabled automation rules in evaluation order
+	Rules []automation.Rule
+}
+
+// Assessment is what the assessor decided about a message.
+type Assessment struct {
+	Score  int
+	Status string
+	// ApproveProbability and Suggestion are only set once the classifier is trained
+	ApproveProbability sql.NullFloat64
+	Suggestion         string
+	Outcome            automation.Outcome
+}
+
+// Skip reports whether a rule said the message shouldn't be staged at all.
+func (a Assessment) Skip() bool {
+	return a.Outcome.Decision == automation.ActionSkip
+}
+
+// NewAssessor loads the user's sender history, classifier and automation rules.
+func NewAssessor(ctx context.Context, db *database.Queries, userID string, minScore int) (*Assessor, error) {
+	history, err := LoadSenderHistory(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	model, err := classifier.Load(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := LoadAutomationRules(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Assessor{History: history, MinScore: minScore, Model: model, Rules: rules}, nil
+}
+
+// LoadAutomationRules returns the user's enabled rules in evaluation order.
+func LoadAutomationRules(ctx context.Context, db *database.Queries, userID string) ([]automation.Rule, error) {
+	rows, err := db.ListEnabledInvoiceRulesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invoice rules: %w", err)
+	}
+
+	rules := make([]automation.Rule, 0, len(rows))
+	for _, row := range rows {
+		rule := automation.Rule{
+			ID:              row.ID,
+			Name:            row.Name,
+			SenderDomain:    row.SenderDomain,
+			SubjectContains: row.SubjectContains,
+			Action:          row.Action,
+			Value:           row.Value,
+		}
+		// rules saved before Validate got stricter, such as an auto_approve without conditions
+		if err := rule.Validate(); err != nil {
+			log.Printf("Ignoring invalid rule %s of user ID %s: %v", row.ID, userID, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Assess scores the message, asks the classifier about it and applies the rules.
+// Messages the classifier expects the user to reject are staged as low confidence
+// whatever their score, and a rule's decision overrides both.
+func (s *Assessor) Assess(msg *Message) Assessment {
+	assessment := Assessment{
+		Score:   Score(msg, s.History),
+		Status:  StatusPendingReview,
+		Outcome: automation.Evaluate(s.Rules, msg.From, msg.Subject),
+	}
+
+	if s.Model.Trained() {
+		p, suggestion := s.Model.Suggest(classifierExample(msg))
+		assessment.ApproveProbability = sql.NullFloat64{Float64: p, Valid: true}
+		assessment.Suggestion = suggestion
+	}
+
+	switch {
+	case assessment.Outcome.Decision == automation.ActionAutoApprove:
+		assessment.Status = StatusApprovalQueued
+	case assessment.Outcome.Decision == automation.ActionAutoReject:
+		assessment.Status = StatusRejected
+	case assessment.Score < s.MinScore || assessment.Suggestion == classifier.SuggestReject:
+		assessment.Status = StatusLowConfidence
+	}
+	return assessment
+}
+
+func classifierExample(msg *Message) classifier.Example {
+	ex := classifier.Example{
+		Sender:        msg.From,
+		Subject:       msg.Subject,
+		HasAttachment: len(msg.Attachments) > 0,
+	}
+	for _, attachment := range msg.Attachments {
+		ex.MimeTypes = append(ex.MimeTypes, attachment.MimeType)
+	}
+	return ex
+}
+
+// Score rates how likely msg is to be an invoice, from 0 to MaxScore. It weighs the
+// keywords in the subject and snippet, the attachments, how the user treated earlier
+// mail from the sender, List-Unsubscribe and Gmail category labels.
+func Score(msg *Message, history SenderHistory) int {
+	score := baseScore
+
+	subject := strings.ToLower(msg.Subject)
+	if containsAny(subject, strongKeywords) {
+		score += 30
+	}
+	if containsAny(strings.ToLower(msg.Snippet), strongKeywords) {
+		score += 15
+	}
+	if containsAnyWord(subject, promotionKeywords) {
+		score -= 15
+	}
+
+	score += attachmentScore(msg.Attachments)
+
+	// a sender the user always approves is worth as much as a keyword, one they
+	// always reject takes the message below any sensible threshold
+	if stats, ok := history[senderAddress(msg.From)]; ok {
+		if decisions := stats.Approved + stats.Rejected; decisions > 0 {
+			score += 30 * (stats.Approved - stats.Rejected) / decisions
+		}
+	}
+
+	if msg.ListUnsubscribe {
+		score -= 15
+	}
+	for _, label := range msg.Labels {
+		score += categoryWeights[NormalizeLabel(label)]
+	}
+
+	return min(max(score, 0), MaxScore)
+}
+
+// attachmentScore counts the best attachment only, a second PDF says nothing new.
+func attachmentScore(attachments []Attachment) int {
+	best := 0
+	for _, attachment := range attachments {
+		points := 0
+		switch {
+		case attachment.MimeType == "application/pdf":
+			points = 25
+		case strings.HasPrefix(attachment.MimeType, "image/"):
+			points = 10
+		default:
+			points = 5
+		}
+		if containsAny(strings.ToLower(attachment.Filename), attachmentNameKeywords) {
+			points += 10
+		}
+		best = max(best, points)
+	}
+	return best
+}
+
+func containsAny(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(s, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAnyWord is containsAny for keywords that only count as whole words, a
+// wholesale supplier or a car dealer isn't running a promotion.
+func containsAnyWord(s string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if containsWord(s, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWord(s, keyword string) bool {
+	if keyword == "" {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(keyword)
+	last, _ := utf8.DecodeLastRuneInString(keyword)
+	for offset := 0; offset < len(s); {
+		i := strings.Index(s[offset:], keyword)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(keyword)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if (start == 0 || !isWordRune(first) || !isWordRune(before)) &&
+			(end == len(s) || !isWordRune(last) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		offset = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func senderAddress(from string) string {
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		return strings.ToLower(parsed.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
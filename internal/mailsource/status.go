@@ -0,0 +1,30 @@
+package mailsource
+
+// statuses an invoice moves through after review
+const (
+	// StatusApproving is an approval job in progress
+	StatusApproving = "approving"
+	StatusApproved  = "approved"
+)
+
+// transitions lists where each status may go. Approving again continues the job in
+// flight, and approving can only end approved or back in review.
+var transitions = map[string][]string{
+	StatusPendingReview:  {StatusApproving, StatusRejected},
+	StatusLowConfidence:  {StatusApproving, StatusRejected},
+	StatusApprovalQueued: {StatusApproving, StatusRejected},
+	StatusApproving:      {StatusApproving, StatusApproved, StatusPendingReview},
+	// revoking an approval, reopening a rejection
+	StatusApproved: {StatusPendingReview},
+	StatusRejected: {StatusPendingReview},
+}
+
+// CanTransition reports whether an invoice may go from one status to the other.
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package mailsource
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from     string
+		to       string
+		expected bool
+	}{
+		{name: "Approve From Review", from: StatusPendingReview, to: StatusApproving, expected: true},
+		{name: "Reject Low Confidence", from: StatusLowConfidence, to: StatusRejected, expected: true},
+		{name: "Approve Again While Approving", from: StatusApproving, to: StatusApproving, expected: true},
+		{name: "Approval Finished", from: StatusApproving, to: StatusApproved, expected: true},
+		{name: "Reopen Rejected", from: StatusRejected, to: StatusPendingReview, expected: true},
+		{name: "Revoke Approved", from: StatusApproved, to: StatusPendingReview, expected: true},
+		{name: "Reject While Approving", from: StatusApproving, to: StatusRejected, expected: false},
+		{name: "Reject Approved", from: StatusApproved, to: StatusRejected, expected: false},
+		{name: "Approve Rejected", from: StatusRejected, to: StatusApproving, expected: false},
+		{name: "Skip Approval Job", from: StatusPendingReview, to: StatusApproved, expected: false},
+		{name: "Unknown Status", from: "archived", to: StatusPendingReview, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CanTransition(tc.from, tc.to); got != tc.expected {
+				t.Errorf("expected %s -> %s to be %v, but got %v", tc.from, tc.to, tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Reader splits an mbox file into messages without holding more than one message in
+// memory. ">From " quoting in bodies is undone as in mboxrd, which is what Google
+// Takeout writes. Input that doesn't start with a "From " line is read as a single
+// .eml message.
+type Reader struct {
+	r       *bufio.Reader
+	started bool
+	single  bool
+	done    bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the raw source of the next message, or io.EOF after the last one.
+func (m *Reader) Next() ([]byte, error) {
+	if m.done {
+		return nil, io.EOF
+	}
+
+	if !m.started {
+		m.started = true
+		first, err := m.r.Peek(5)
+		if err != nil && len(first) == 0 {
+			m.done = true
+			return nil, io.EOF
+		}
+		if isFromLine(first) {
+			// the separator line isn't part of the message
+			if _, err := m.r.ReadBytes('\n'); err != nil {
+				m.done = true
+				return nil, io.EOF
+			}
+		} else {
+			m.single = true
+		}
+	}
+
+	var msg bytes.Buffer
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if len(line) > 0 {
+			if !m.single && isFromLine(line) {
+				return trimSeparator(msg.Bytes()), nil
+			}
+			if !m.single {
+				line = unquoteFrom(line)
+			}
+			msg.Write(line)
+		}
+		if err == io.EOF {
+			m.done = true
+			if msg.Len() == 0 {
+				return nil, io.EOF
+			}
+			return trimSeparator(msg.Bytes()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// unquoteFrom removes one '>' from lines such as ">From " or ">>From ".
+func unquoteFrom(line []byte) []byte {
+	i := 0
+	for i < len(line) && line[i] == '>' {
+		i++
+	}
+	if i > 0 && bytes.HasPrefix(line[i:], []byte("From ")) {
+		return line[1:]
+	}
+	return line
+}
+
+// trimSeparator drops the blank line mbox puts between messages.
+func trimSeparator(msg []byte) []byte {
+	if bytes.HasSuffix(msg, []byte("\r\n\r\n")) {
+		return msg[:len(msg)-2]
+	}
+	if bytes.HasSuffix(msg, []byte("\n\n")) {
+		return msg[:len(msg)-1]
+	}
+	return msg
+}
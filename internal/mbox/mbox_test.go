@@ -0,0 +1,75 @@
+package mbox
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input string) []string {
+	t.Helper()
+	r := NewReader(strings.NewReader(input))
+	var messages []string
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		messages = append(messages, string(msg))
+	}
+}
+
+func TestReader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name: "Two Messages",
+			input: "From 1234@xxx Mon Jan 01 00:00:00 +0000 2024\n" +
+				"Subject: Invoice 1\n\nfirst body\n\n" +
+				"From 5678@xxx Tue Jan 02 00:00:00 +0000 2024\n" +
+				"Subject: Invoice 2\n\nsecond body\n",
+			expected: []string{
+				"Subject: Invoice 1\n\nfirst body\n",
+				"Subject: Invoice 2\n\nsecond body\n",
+			},
+		},
+		{
+			name: "Quoted From Lines",
+			input: "From 1234@xxx Mon Jan 01 00:00:00 +0000 2024\n" +
+				"Subject: Receipt\n\n>From the team\n>>From nested\n> From quoted reply\n",
+			expected: []string{
+				"Subject: Receipt\n\nFrom the team\n>From nested\n> From quoted reply\n",
+			},
+		},
+		{
+			name:     "Single EML",
+			input:    "Subject: Receipt\r\n\r\nFrom here on it's the body\r\n",
+			expected: []string{"Subject: Receipt\r\n\r\nFrom here on it's the body\r\n"},
+		},
+		{
+			name:     "Empty Input",
+			input:    "",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := readAll(t, tc.input)
+			if len(got) != len(tc.expected) {
+				t.Fatalf("expected %d messages, but got %d: %q", len(tc.expected), len(got), got)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("message %d: expected %q, but got %q", i, tc.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
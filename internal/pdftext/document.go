@@ -0,0 +1,339 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// largest decoded stream we'll hold in memory, guards against zip bombs
+const maxStreamBytes = 32 << 20
+
+// total decoded across all streams of a document, a small bomb referenced from many
+// places adds up too
+const maxDecodedBytes = 64 << 20
+
+// page tree nodes visited before giving up on a document
+const maxPageTreeNodes = 1000
+
+var objectHeaderPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// errUnsupportedFilter is returned for streams compressed with anything but Flate.
+var errUnsupportedFilter = errors.New("unsupported stream filter")
+
+var errDecodeBudget = errors.New("document decodes to too much data")
+
+// document finds objects by scanning for "n g obj" headers instead of trusting the xref
+// table. That is slower but reads files with broken offsets, which scanners and cheap
+// invoicing tools produce a lot of. Later definitions win, like incremental updates.
+type document struct {
+	data    []byte
+	offsets map[int]int
+	cache   map[int]object
+	// objects stored inside object streams, keyed by object number
+	packed map[int]object
+	// bytes decoded so far, see maxDecodedBytes
+	decoded int
+}
+
+func openDocument(data []byte) (*document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+
+	d := &document{
+		data:    data,
+		offsets: map[int]int{},
+		cache:   map[int]object{},
+		packed:  map[int]object{},
+	}
+	for _, m := range objectHeaderPattern.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		d.offsets[num] = m[1]
+	}
+	if len(d.offsets) == 0 {
+		return nil, errors.New("no objects found")
+	}
+
+	for num := range d.offsets {
+		s, ok := d.resolve(ref{num: num}).(*stream)
+		if !ok || s.dict["Type"] != name("ObjStm") {
+			continue
+		}
+		d.unpackObjectStream(s)
+	}
+	return d, nil
+}
+
+// parseAt reads the object whose body starts at offset, including its stream data.
+func (d *document) parseAt(offset int) object {
+	l := &lexer{data: d.data, pos: offset}
+	obj := l.object()
+	dic, ok := obj.(dict)
+	if !ok {
+		return obj
+	}
+
+	save := l.pos
+	if k, ok := l.next().(keyword); !ok || k != "stream" {
+		l.pos = save
+		return dic
+	}
+	start := l.pos
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+
+	end := -1
+	if length, ok := d.resolve(dic["Length"]).(float64); ok {
+		candidate := start + int(length)
+		if candidate >= start && candidate <= len(d.data) {
+			rest := bytes.TrimLeft(d.data[candidate:], "\r\n \t")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				end = candidate
+			}
+		}
+	}
+	if end < 0 {
+		// the length is wrong or points at an object we can't read, fall back to the marker
+		i := bytes.Index(d.data[start:], []byte("endstream"))
+		if i < 0 {
+			return dic
+		}
+		end = start + i
+	}
+	return &stream{dict: dic, raw: d.data[start:end]}
+}
+
+// resolve follows references, anything else is returned as is.
+func (d *document) resolve(obj object) object {
+	for depth := 0; depth < 16; depth++ {
+		r, ok := obj.(ref)
+		if !ok {
+			return obj
+		}
+		if cached, ok := d.cache[r.num]; ok {
+			obj = cached
+			continue
+		}
+		if offset, ok := d.offsets[r.num]; ok {
+			// mark before parsing so a self-referencing /Length can't recurse forever
+			d.cache[r.num] = nil
+			parsed := d.parseAt(offset)
+			d.cache[r.num] = parsed
+			obj = parsed
+			continue
+		}
+		if packed, ok := d.packed[r.num]; ok {
+			return packed
+		}
+		return nil
+	}
+	return nil
+}
+
+func (d *document) dict(obj object) dict {
+	switch v := d.resolve(obj).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *document) array(obj object) []object {
+	arr, _ := d.resolve(obj).([]object)
+	return arr
+}
+
+// unpackObjectStream reads the objects compressed inside an /ObjStm.
+func (d *document) unpackObjectStream(s *stream) {
+	data, err := d.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(s.dict["N"]).(float64)
+	first, _ := d.resolve(s.dict["First"]).(float64)
+	if int(first) > len(data) {
+		return
+	}
+
+	header := &lexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, ok1 := header.next().(float64)
+		offset, ok2 := header.next().(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		pos := int(first) + int(offset)
+		if pos >= len(data) {
+			continue
+		}
+		if _, direct := d.offsets[int(num)]; direct {
+			continue
+		}
+		body := &lexer{data: data, pos: pos}
+		d.packed[int(num)] = body.object()
+	}
+}
+
+// decode returns the stream contents with its filters undone.
+func (d *document) decode(s *stream) ([]byte, error) {
+	var filters []object
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []object{f}
+	case []object:
+		filters = f
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		budget := min(maxStreamBytes, maxDecodedBytes-d.decoded)
+		if budget <= 0 {
+			return nil, errDecodeBudget
+		}
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to inflate stream: %w", err)
+			}
+			out, err := io.ReadAll(io.LimitReader(r, int64(budget)))
+			// truncated streams are common, keep whatever inflated
+			if err != nil && len(out) == 0 {
+				return nil, fmt.Errorf("failed to inflate stream: %w", err)
+			}
+			data = out
+		case name("ASCIIHexDecode"), name("AHx"):
+			l := &lexer{data: append(append([]byte{}, data...), '>')}
+			data = l.hexString()
+		default:
+			return nil, errUnsupportedFilter
+		}
+		d.decoded += len(data)
+	}
+	return data, nil
+}
+
+// catalog finds the document root through the trailer, an xref stream, or failing
+// both, any object typed /Catalog.
+func (d *document) catalog() dict {
+	for i := bytes.LastIndex(d.data, []byte("trailer")); i >= 0; {
+		l := &lexer{data: d.data, pos: i + len("trailer")}
+		if trailer, ok := l.object().(dict); ok {
+			if root := d.dict(trailer["Root"]); root != nil {
+				return root
+			}
+		}
+		i = bytes.LastIndex(d.data[:i], []byte("trailer"))
+	}
+
+	var fallback dict
+	for num := range d.offsets {
+		obj := d.dict(ref{num: num})
+		if obj == nil {
+			continue
+		}
+		if obj["Type"] == name("XRef") {
+			if root := d.dict(obj["Root"]); root != nil {
+				return root
+			}
+		}
+		if obj["Type"] == name("Catalog") {
+			fallback = obj
+		}
+	}
+	for _, obj := range d.packed {
+		if dic, ok := obj.(dict); ok && dic["Type"] == name("Catalog") && fallback == nil {
+			fallback = dic
+		}
+	}
+	return fallback
+}
+
+// page is a leaf of the page tree with its inherited resources.
+type page struct {
+	resources dict
+	contents  object
+}
+
+// pages walks the page tree up to MaxPages leaves. Every referenced node is visited
+// once, a /Kids entry pointing back up the tree would otherwise loop or fan out
+// exponentially.
+func (d *document) pages() []page {
+	root := d.catalog()
+	if root == nil {
+		return nil
+	}
+	var pages []page
+	visited := map[int]bool{}
+	nodes := 0
+	var walk func(obj object, resources dict, depth int)
+	walk = func(obj object, resources dict, depth int) {
+		if len(pages) >= MaxPages || nodes >= maxPageTreeNodes || depth > 32 {
+			return
+		}
+		if r, ok := obj.(ref); ok {
+			if visited[r.num] {
+				return
+			}
+			visited[r.num] = true
+		}
+		nodes++
+		node := d.dict(obj)
+		if node == nil {
+			return
+		}
+		if r := d.dict(node["Resources"]); r != nil {
+			resources = r
+		}
+		kids := d.array(node["Kids"])
+		if node["Type"] == name("Page") || kids == nil {
+			pages = append(pages, page{resources: resources, contents: node["Contents"]})
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	walk(root["Pages"], nil, 0)
+	return pages
+}
+
+// contentStream concatenates a page's content streams, which may be split anywhere.
+func (d *document) contentStream(contents object) []byte {
+	var parts []object
+	switch v := d.resolve(contents).(type) {
+	case *stream:
+		parts = []object{v}
+	case []object:
+		parts = v
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		s, ok := d.resolve(part).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
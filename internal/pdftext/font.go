@@ -0,0 +1,144 @@
+package pdftext
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// font maps character codes from a content stream to text.
+type font struct {
+	// codeBytes is how many bytes each character code takes, 2 for CID fonts
+	codeBytes int
+	toUnicode map[uint32]string
+}
+
+func (d *document) loadFont(obj object) *font {
+	dic := d.dict(obj)
+	f := &font{codeBytes: 1}
+	if dic == nil {
+		return f
+	}
+	if dic["Subtype"] == name("Type0") {
+		f.codeBytes = 2
+	}
+	s, ok := d.resolve(dic["ToUnicode"]).(*stream)
+	if !ok {
+		return f
+	}
+	data, err := d.decode(s)
+	if err != nil {
+		return f
+	}
+	f.toUnicode, f.codeBytes = parseCMap(data, f.codeBytes)
+	return f
+}
+
+// parseCMap reads the bfchar and bfrange sections of a ToUnicode CMap. The code width
+// comes from the codespace range when there is one.
+func parseCMap(data []byte, codeBytes int) (map[uint32]string, int) {
+	mapping := map[uint32]string{}
+	l := &lexer{data: data}
+
+	var operands []object
+	section := ""
+	for !l.eof() {
+		tok := l.object()
+		k, ok := tok.(keyword)
+		if !ok {
+			if section != "" {
+				operands = append(operands, tok)
+			}
+			continue
+		}
+		switch k {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = string(k)
+			operands = nil
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					codeBytes = len(lo)
+				}
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					mapping[codeValue(src)] = utf16String(dst)
+				}
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					base := []rune(utf16String(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(code - start)
+						mapping[code] = string(r)
+					}
+				case []object:
+					for j, item := range dst {
+						if b, ok := item.([]byte); ok && start+uint32(j) <= end {
+							mapping[start+uint32(j)] = utf16String(b)
+						}
+					}
+				}
+			}
+			section = ""
+		}
+	}
+	return mapping, codeBytes
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func utf16String(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// text decodes a string operand. Codes missing from the CMap of a single-byte font are
+// read as Latin-1, which is right for the standard fonts invoices mostly use.
+func (f *font) text(b []byte) string {
+	var out strings.Builder
+	width := f.codeBytes
+	if width < 1 {
+		width = 1
+	}
+	for i := 0; i+width <= len(b); i += width {
+		code := codeValue(b[i : i+width])
+		if s, ok := f.toUnicode[code]; ok {
+			out.WriteString(s)
+			continue
+		}
+		if width == 1 && (code >= 0x20 && code < 0x7f || code >= 0xa0) {
+			out.WriteRune(rune(code))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,290 @@
+package pdftext
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// object is a parsed PDF value: nil, bool, float64, name, []byte for strings,
+// []object, dict, ref, *stream, or keyword for bare words such as content operators.
+type object any
+
+type name string
+
+type keyword string
+
+type dict map[name]object
+
+type ref struct {
+	num int
+	gen int
+}
+
+type stream struct {
+	dict dict
+	raw  []byte
+}
+
+// lexer reads PDF tokens from a byte slice. It never fails, malformed input just
+// produces odd tokens, since half-broken PDFs are common and mostly still readable.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *lexer) eof() bool {
+	l.skipSpace()
+	return l.pos >= len(l.data)
+}
+
+// delimiter tokens are returned as keywords, "<<" and ">>" included
+func (l *lexer) next() object {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return name(decodeName(l.data[start:l.pos]))
+	case c == '(':
+		l.pos++
+		return l.literalString()
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		return keyword("<<")
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return keyword(">>")
+	case c == '<':
+		l.pos++
+		return l.hexString()
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return keyword(string(c))
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n
+	}
+	switch word {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return keyword(word)
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) literalString() []byte {
+	var buf bytes.Buffer
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf.Bytes()
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return buf.Bytes()
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case '\r':
+				// line continuation
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					buf.WriteByte(byte(v))
+					continue
+				}
+				buf.WriteByte(e)
+			}
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.Bytes()
+}
+
+func (l *lexer) hexString() []byte {
+	var out []byte
+	var hi byte
+	odd := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// decodeName resolves #xx escapes in names.
+func decodeName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			hi, ok1 := hexValue(raw[i+1])
+			lo, ok2 := hexValue(raw[i+2])
+			if ok1 && ok2 {
+				out = append(out, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
+
+// object reads a complete value, collecting arrays and dictionaries and turning
+// "n g R" into references.
+func (l *lexer) object() object {
+	tok := l.next()
+	switch t := tok.(type) {
+	case keyword:
+		switch t {
+		case "[":
+			var arr []object
+			for !l.eof() {
+				save := l.pos
+				if k, ok := l.next().(keyword); ok && k == "]" {
+					return arr
+				}
+				l.pos = save
+				arr = append(arr, l.object())
+			}
+			return arr
+		case "<<":
+			d := dict{}
+			for !l.eof() {
+				key := l.next()
+				if k, ok := key.(keyword); ok && k == ">>" {
+					return d
+				}
+				n, ok := key.(name)
+				if !ok {
+					continue
+				}
+				d[n] = l.object()
+			}
+			return d
+		}
+		return t
+	case float64:
+		// look ahead for "gen R"
+		save := l.pos
+		if gen, ok := l.next().(float64); ok {
+			if k, ok := l.next().(keyword); ok && k == "R" {
+				return ref{num: int(t), gen: int(gen)}
+			}
+		}
+		l.pos = save
+		return t
+	}
+	return tok
+}
@@ -0,0 +1,223 @@
+// Package pdftext pulls the text out of PDF files. It only understands as much of the
+// format as invoices need: Flate streams, object streams, ToUnicode CMaps and the text
+// operators. Layout is approximated with line breaks where the text moves down the
+// page, which is enough for finding labelled values.
+package pdftext
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// MaxPages caps how many pages are read. Invoice totals are never on page 30.
+const MaxPages = 20
+
+// ErrNoText is returned when a PDF has pages but no text on them, which usually means
+// it is a scanned image.
+var ErrNoText = errors.New("PDF has no text layer")
+
+// TJ adjustments below this many thousandths of an em are treated as word gaps
+const wordGap = -200
+
+// how deeply Form XObjects may nest
+const maxFormDepth = 4
+
+var inlineImageEnd = regexp.MustCompile(`\sEI(\s|$)`)
+
+// Extract returns the text of the first MaxPages pages, one page after another.
+func Extract(data []byte) (string, error) {
+	doc, err := openDocument(data)
+	if err != nil {
+		return "", err
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", errors.New("no pages found")
+	}
+	if len(pages) > MaxPages {
+		pages = pages[:MaxPages]
+	}
+
+	e := &extractor{doc: doc, fonts: map[ref]*font{}}
+	for _, p := range pages {
+		e.run(doc.contentStream(p.contents), p.resources, 0)
+		e.newline()
+	}
+
+	text := strings.TrimSpace(e.out.String())
+	if text == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+type extractor struct {
+	doc   *document
+	out   bytes.Buffer
+	fonts map[ref]*font
+	lastY float64
+	hasY  bool
+}
+
+func (e *extractor) run(content []byte, resources dict, depth int) {
+	l := &lexer{data: content}
+	var operands []object
+	var current *font
+
+	for !l.eof() {
+		tok := l.object()
+		op, ok := tok.(keyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			e.hasY = false
+		case "ET":
+			e.newline()
+		case "Tf":
+			if len(operands) >= 2 {
+				if fontName, ok := operands[0].(name); ok {
+					current = e.font(resources, fontName)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[0].(float64)
+				ty, _ := operands[1].(float64)
+				e.move(tx, ty)
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if e.hasY && math.Abs(y-e.lastY) > 1 {
+					e.newline()
+				} else {
+					e.space()
+				}
+				e.lastY, e.hasY = y, true
+			}
+		case "T*":
+			e.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				e.show(current, operands[0])
+			}
+		case "'":
+			e.newline()
+			if len(operands) >= 1 {
+				e.show(current, operands[0])
+			}
+		case "\"":
+			e.newline()
+			if len(operands) >= 3 {
+				e.show(current, operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[0].([]object)
+				for _, item := range arr {
+					if n, ok := item.(float64); ok {
+						if n < wordGap {
+							e.space()
+						}
+						continue
+					}
+					e.show(current, item)
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				if xName, ok := operands[0].(name); ok {
+					e.form(resources, xName, depth)
+				}
+			}
+		case "ID":
+			// inline image data is binary, skip to the end marker
+			if m := inlineImageEnd.FindIndex(content[l.pos:]); m != nil {
+				l.pos += m[1]
+			} else {
+				l.pos = len(content)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (e *extractor) font(resources dict, fontName name) *font {
+	obj := e.doc.dict(resources["Font"])[fontName]
+	r, isRef := obj.(ref)
+	if !isRef {
+		// direct font dictionaries can't be map keys, so they aren't cached
+		return e.doc.loadFont(obj)
+	}
+	if f, ok := e.fonts[r]; ok {
+		return f
+	}
+	f := e.doc.loadFont(r)
+	e.fonts[r] = f
+	return f
+}
+
+func (e *extractor) form(resources dict, xName name, depth int) {
+	s, ok := e.doc.resolve(e.doc.dict(resources["XObject"])[xName]).(*stream)
+	if !ok || s.dict["Subtype"] != name("Form") {
+		return
+	}
+	data, err := e.doc.decode(s)
+	if err != nil {
+		return
+	}
+	formResources := e.doc.dict(s.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+	e.run(data, formResources, depth+1)
+}
+
+func (e *extractor) move(tx, ty float64) {
+	if ty != 0 {
+		e.newline()
+	} else if tx != 0 {
+		e.space()
+	}
+	if e.hasY {
+		e.lastY += ty
+	}
+}
+
+func (e *extractor) show(f *font, operand object) {
+	b, ok := operand.([]byte)
+	if !ok {
+		return
+	}
+	if f == nil {
+		f = &font{codeBytes: 1}
+	}
+	e.out.WriteString(f.text(b))
+}
+
+func (e *extractor) newline() {
+	b := e.out.Bytes()
+	for len(b) > 0 && b[len(b)-1] == ' ' {
+		b = b[:len(b)-1]
+	}
+	e.out.Truncate(len(b))
+	if len(b) == 0 || b[len(b)-1] == '\n' {
+		return
+	}
+	e.out.WriteByte('\n')
+}
+
+func (e *extractor) space() {
+	b := e.out.Bytes()
+	if len(b) == 0 || b[len(b)-1] == ' ' || b[len(b)-1] == '\n' {
+		return
+	}
+	e.out.WriteByte(' ')
+}
@@ -0,0 +1,183 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF numbers the objects from 1 and writes a trailer pointing at object 1 as the
+// catalog. Empty objects are left out and the xref table too, extraction never reads it.
+func buildPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		if obj == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func contentStream(content string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+// objectStream packs the objects into an /ObjStm numbered from first.
+func objectStream(first int, objects ...string) string {
+	var header, body strings.Builder
+	for i, obj := range objects {
+		fmt.Fprintf(&header, "%d %d ", first+i, body.Len())
+		body.WriteString(obj + " ")
+	}
+	extra := fmt.Sprintf("/Type /ObjStm /N %d /First %d", len(objects), header.Len())
+	return flateStream(extra, header.String()+body.String())
+}
+
+func flateStream(extra, content string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(content))
+	w.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode %s >>\nstream\n%s\nendstream", buf.Len(), extra, buf.String())
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+
+// maps CIDs 1-4 to "חשבונית" split over a bfchar and a bfrange
+const hebrewCMap = `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar
+<0001> <05D7>
+<0002> <05E9>
+endbfchar
+2 beginbfrange
+<0003> <0003> <05D1>
+<0004> <0006> [<05D5> <05E0> <05D9>]
+endbfrange
+1 beginbfchar <0007> <05EA> endbfchar
+endcmap`
+
+func TestExtract(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pdf      []byte
+		expected string
+	}{
+		{
+			name: "Plain Text Lines",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+				contentStream("BT /F1 12 Tf 72 720 Td (Invoice No. 1042) Tj 0 -14 Td (Total: \\(USD\\) 1,234.50) Tj ET"),
+				helvetica,
+			),
+			expected: "Invoice No. 1042\nTotal: (USD) 1,234.50",
+		},
+		{
+			name: "Compressed With Kerning",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents [4 0 R 6 0 R] >>",
+				flateStream("", "BT /F1 10 Tf 1 0 0 1 50 700 Tm [(V)80(AT)-250(17%)] TJ ET"),
+				helvetica,
+				flateStream("", "BT /F1 10 Tf 1 0 0 1 50 680 Tm (Due 2024-05-01) Tj T* (Thanks) ' ET"),
+			),
+			expected: "VAT 17%\nDue 2024-05-01\nThanks",
+		},
+		{
+			name: "Identity Font With ToUnicode",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F2 5 0 R >> >> /Contents 4 0 R >>",
+				contentStream("BT /F2 12 Tf <0001000200030004000500060007> Tj ET"),
+				"<< /Type /Font /Subtype /Type0 /BaseFont /David /Encoding /Identity-H /ToUnicode 6 0 R >>",
+				flateStream("", hebrewCMap),
+			),
+			expected: "חשבונית",
+		},
+		{
+			name: "Objects In Object Stream",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"",
+				"",
+				contentStream("BT /F1 12 Tf (Receipt) Tj ET"),
+				helvetica,
+				objectStream(2,
+					"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+					"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+				),
+			),
+			expected: "Receipt",
+		},
+		{
+			name: "Page Tree Loop",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R 2 0 R 3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+				contentStream("BT /F1 12 Tf (Once) Tj ET"),
+				helvetica,
+			),
+			expected: "Once",
+		},
+		{
+			name: "Form XObject And Inline Image",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> /XObject << /X1 6 0 R >> >> /Contents 4 0 R >>",
+				contentStream("BI /W 2 /H 1 /BPC 8 /CS /G ID \x00(Tj)\xff EI\n/X1 Do"),
+				helvetica,
+				"<< /Type /XObject /Subtype /Form /BBox [0 0 100 100] /Length 33 >>\nstream\nBT /F1 9 Tf (Amount due 99) Tj ET\nendstream",
+			),
+			expected: "Amount due 99",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Extract(tc.pdf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	scanned := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		contentStream("q 600 0 0 800 0 0 cm /Im1 Do Q"),
+	)
+
+	if _, err := Extract(scanned); !errors.Is(err, ErrNoText) {
+		t.Errorf("expected ErrNoText for a scanned page, but got %v", err)
+	}
+	// each node lists itself twice, which used to take 2^32 calls to walk
+	selfReferencing := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [2 0 R 2 0 R] /Count 1 >>",
+	)
+	if _, err := Extract(selfReferencing); err == nil || !strings.Contains(err.Error(), "no pages") {
+		t.Errorf("expected a no pages error for a self-referencing page tree, but got %v", err)
+	}
+	if _, err := Extract([]byte("GIF89a")); err == nil || !strings.Contains(err.Error(), "not a PDF") {
+		t.Errorf("expected an error for a non-PDF file, but got %v", err)
+	}
+}
@@ -3,15 +3,21 @@ package s3service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/felixsolom/fetch-duck/internal/config"
 )
 
+// ErrNotFound is returned by DownloadFile when there is no object under the key.
+var ErrNotFound = errors.New("object not found")
+
 type Service struct {
 	S3Client   *s3.Client
 	BucketName string
@@ -45,3 +51,66 @@ func (s *Service) UploadFile(ctx context.Context, key string, data []byte) error
 	}
 	return nil
 }
+
+func (s *Service) DownloadFile(ctx context.Context, key string) ([]byte, error) {
+	body, _, err := s.OpenFile(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file from AWS: %w", err)
+	}
+	return data, nil
+}
+
+// OpenFile returns the object under key to be read as it arrives, with its size or -1
+// when S3 didn't say. The caller closes the body.
+func (s *Service) OpenFile(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	out, err := s.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download file from AWS: %w", err)
+	}
+	size := int64(-1)
+	if out.ContentLength != nil {
+		size = *out.ContentLength
+	}
+	return out.Body, size, nil
+}
+
+// DeletePrefix deletes every object whose key starts with prefix and returns the keys
+// it deleted. Nothing under the prefix is not an error.
+func (s *Service) DeletePrefix(ctx context.Context, prefix string) ([]string, error) {
+	var deleted []string
+	paginator := s3.NewListObjectsV2Paginator(s.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.BucketName),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list files in AWS: %w", err)
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			_, err := s.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.BucketName),
+				Key:    aws.String(key),
+			})
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete file %s from AWS: %w", key, err)
+			}
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,335 @@
+package smtpservice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long a client may stay idle between commands
+const commandTimeout = 5 * time.Minute
+
+// most recipients a single message may be addressed to
+const maxRecipients = 20
+
+// longest command line accepted, CRLF included (RFC 5321 section 4.5.3.1.4)
+const maxCommandLine = 512
+
+// clients served at once when MaxConnections isn't set
+const defaultMaxConnections = 100
+
+// ErrUnknownRecipient is returned by LookupRecipient for addresses nobody owns.
+var ErrUnknownRecipient = errors.New("unknown recipient")
+
+// ErrMessageRejected is returned by Deliver for messages that won't ever be accepted,
+// so the sender doesn't keep retrying them.
+var ErrMessageRejected = errors.New("message rejected")
+
+// Server is a receive-only SMTP server. It accepts mail for the recipients
+// LookupRecipient knows and hands every message to Deliver once per recipient. When
+// Deliver fails for one recipient the whole message is retried by the sender, so
+// Deliver has to accept a message it already has.
+type Server struct {
+	// Hostname is announced in the greeting.
+	Hostname        string
+	MaxMessageBytes int64
+	// MaxConnections caps the clients served at once, the rest are told to come back
+	// later. Zero means defaultMaxConnections.
+	MaxConnections int
+
+	// LookupRecipient maps an address from RCPT TO to a user ID.
+	LookupRecipient func(ctx context.Context, address string) (string, error)
+	Deliver         func(ctx context.Context, userID, from string, raw []byte) error
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// ListenAndServe listens on addr and serves until Close is called.
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	limit := s.MaxConnections
+	if limit <= 0 {
+		limit = defaultMaxConnections
+	}
+	slots := make(chan struct{}, limit)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		select {
+		case slots <- struct{}{}:
+			go func() {
+				defer func() { <-slots }()
+				s.handle(conn)
+			}()
+		default:
+			// senders retry on 421, the accept loop mustn't wait for a free slot
+			go refuse(conn, s.Hostname)
+		}
+	}
+}
+
+func refuse(conn net.Conn, hostname string) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	fmt.Fprintf(conn, "421 %s Too many connections, try again later\r\n", hostname)
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// session is the state of one SMTP transaction.
+type session struct {
+	from    string
+	hasFrom bool
+	userIDs []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	ctx := context.Background()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+		w.Flush()
+	}
+
+	reply("220 %s ESMTP ready", s.Hostname)
+
+	var sess session
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := readLine(r, maxCommandLine)
+		if errors.Is(err, errLineTooLong) {
+			reply("500 Line too long")
+			continue
+		}
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			sess = session{}
+			reply("250 %s", s.Hostname)
+		case "EHLO":
+			sess = session{}
+			fmt.Fprintf(w, "250-%s\r\n", s.Hostname)
+			fmt.Fprintf(w, "250-SIZE %d\r\n", s.MaxMessageBytes)
+			fmt.Fprint(w, "250-8BITMIME\r\n")
+			reply("250 SMTPUTF8")
+		case "MAIL":
+			from, ok := parsePath(arg, "FROM:")
+			if !ok {
+				reply("501 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			sess = session{from: from, hasFrom: true}
+			reply("250 OK")
+		case "RCPT":
+			if !sess.hasFrom {
+				reply("503 MAIL first")
+				continue
+			}
+			to, ok := parsePath(arg, "TO:")
+			if !ok {
+				reply("501 Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(sess.userIDs) >= maxRecipients {
+				reply("452 Too many recipients")
+				continue
+			}
+			userID, err := s.LookupRecipient(ctx, to)
+			if errors.Is(err, ErrUnknownRecipient) {
+				reply("550 No such user here")
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to look up SMTP recipient %s: %v", to, err)
+				reply("451 Temporary failure, try again later")
+				continue
+			}
+			sess.userIDs = append(sess.userIDs, userID)
+			reply("250 OK")
+		case "DATA":
+			if len(sess.userIDs) == 0 {
+				reply("503 RCPT first")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			raw, err := readData(r, s.MaxMessageBytes)
+			if errors.Is(err, errMessageTooLarge) {
+				reply("552 Message exceeds fixed maximum message size")
+				sess = session{}
+				continue
+			}
+			if err != nil {
+				return
+			}
+			err = s.deliver(ctx, sess, raw)
+			switch {
+			case errors.Is(err, ErrMessageRejected):
+				reply("554 Message rejected")
+			case err != nil:
+				reply("451 Failed to process message, try again later")
+			default:
+				reply("250 OK queued")
+			}
+			sess = session{}
+		case "RSET":
+			sess = session{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		case "VRFY":
+			reply("252 Cannot verify user")
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *Server) deliver(ctx context.Context, sess session, raw []byte) error {
+	var failed error
+	for _, userID := range sess.userIDs {
+		if err := s.Deliver(ctx, userID, sess.from, raw); err != nil {
+			log.Printf("Failed to deliver inbound message from %s to user ID %s: %v", sess.from, userID, err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+var (
+	errMessageTooLarge = errors.New("message too large")
+	errLineTooLong     = errors.New("line too long")
+)
+
+// readLine reads up to and including the next newline. A line longer than limit is
+// read to its end and dropped. A limit of 0 means no limit.
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if limit > 0 && len(line)+len(chunk) > limit {
+			for err == bufio.ErrBufferFull {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil {
+				return "", err
+			}
+			return "", errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(line), nil
+	}
+}
+
+// readData reads the message up to the terminating dot line and undoes dot stuffing.
+// An oversized message is read to the end anyway so the session stays in sync.
+func readData(r *bufio.Reader, maxBytes int64) ([]byte, error) {
+	var buf bytes.Buffer
+	tooLarge := false
+	// a line can't be longer than the message, plus dot stuffing and CRLF
+	lineLimit := 0
+	if maxBytes > 0 {
+		lineLimit = int(maxBytes) + 3
+	}
+	for {
+		line, err := readLine(r, lineLimit)
+		if errors.Is(err, errLineTooLong) {
+			tooLarge = true
+			buf.Reset()
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			break
+		}
+		line = strings.TrimPrefix(line, ".")
+		if tooLarge {
+			continue
+		}
+		if maxBytes > 0 && int64(buf.Len()+len(line)) > maxBytes {
+			tooLarge = true
+			buf.Reset()
+			continue
+		}
+		buf.WriteString(line)
+	}
+	if tooLarge {
+		return nil, errMessageTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePath extracts the address from "FROM:<a@b> SIZE=123". The null sender <> is valid.
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", false
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", false
+	}
+	return rest[1:end], true
+}
@@ -0,0 +1,229 @@
+package smtpservice
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type delivery struct {
+	userID string
+	from   string
+	raw    string
+}
+
+func startTestServer(t *testing.T, maxBytes int64) (string, func() []delivery) {
+	t.Helper()
+	var mu sync.Mutex
+	var deliveries []delivery
+
+	server := &Server{
+		Hostname:        "mx.example.com",
+		MaxMessageBytes: maxBytes,
+		LookupRecipient: func(ctx context.Context, address string) (string, error) {
+			if address == "invoices+abc123@example.com" {
+				return "user-1", nil
+			}
+			return "", ErrUnknownRecipient
+		},
+		Deliver: func(ctx context.Context, userID, from string, raw []byte) error {
+			if strings.Contains(string(raw), "Subject: garbage") {
+				return ErrMessageRejected
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			deliveries = append(deliveries, delivery{userID: userID, from: from, raw: string(raw)})
+			return nil
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return listener.Addr().String(), func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), deliveries...)
+	}
+}
+
+func TestServerDeliversMessage(t *testing.T) {
+	addr, deliveries := startTestServer(t, 1<<20)
+
+	msg := "From: supplier@acme.example\r\n" +
+		"Subject: Invoice 42\r\n" +
+		"\r\n" +
+		"Invoice attached.\r\n" +
+		".leading dot\r\n"
+	err := smtp.SendMail(addr, nil, "supplier@acme.example", []string{"invoices+abc123@example.com"}, []byte(msg))
+	if err != nil {
+		t.Fatalf("failed to send mail: %v", err)
+	}
+
+	got := deliveries()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 delivery, but got %d", len(got))
+	}
+	if got[0].userID != "user-1" || got[0].from != "supplier@acme.example" {
+		t.Errorf("unexpected delivery %+v", got[0])
+	}
+	if got[0].raw != msg {
+		t.Errorf("expected message to arrive unchanged, but got %q", got[0].raw)
+	}
+}
+
+func TestServerRejections(t *testing.T) {
+	testCases := []struct {
+		name      string
+		to        string
+		body      string
+		maxBytes  int64
+		errorCode string
+	}{
+		{
+			name:      "Unknown Recipient",
+			to:        "invoices+nope@example.com",
+			body:      "Subject: hi\r\n\r\nhello\r\n",
+			maxBytes:  1 << 20,
+			errorCode: "550",
+		},
+		{
+			name:      "Message Too Large",
+			to:        "invoices+abc123@example.com",
+			body:      "Subject: big\r\n\r\n" + strings.Repeat("x", 200) + "\r\n",
+			maxBytes:  100,
+			errorCode: "552",
+		},
+		{
+			name:      "Rejected Message",
+			to:        "invoices+abc123@example.com",
+			body:      "Subject: garbage\r\n\r\nnot a message\r\n",
+			maxBytes:  1 << 20,
+			errorCode: "554",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, deliveries := startTestServer(t, tc.maxBytes)
+
+			err := smtp.SendMail(addr, nil, "someone@example.org", []string{tc.to}, []byte(tc.body))
+			if err == nil || !strings.HasPrefix(err.Error(), tc.errorCode) {
+				t.Errorf("expected %s error, but got %v", tc.errorCode, err)
+			}
+			if n := len(deliveries()); n != 0 {
+				t.Errorf("expected no deliveries, but got %d", n)
+			}
+		})
+	}
+}
+
+func TestServerLongCommandLine(t *testing.T) {
+	addr, _ := startTestServer(t, 1<<20)
+
+	conn, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("unexpected greeting: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		command  string
+		expected int
+	}{
+		{name: "Too Long", command: "HELO " + strings.Repeat("x", 600), expected: 500},
+		{name: "Session Still Usable", command: "NOOP", expected: 250},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := conn.PrintfLine("%s", tc.command); err != nil {
+				t.Fatalf("failed to send command: %v", err)
+			}
+			if code, _, err := conn.ReadResponse(tc.expected); err != nil {
+				t.Errorf("expected %d reply, but got %d: %v", tc.expected, code, err)
+			}
+		})
+	}
+}
+
+func TestServerConnectionLimit(t *testing.T) {
+	server := &Server{Hostname: "mx.example.com", MaxMessageBytes: 1 << 20, MaxConnections: 1}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	first, err := textproto.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if _, _, err := first.ReadResponse(220); err != nil {
+		t.Fatalf("unexpected greeting: %v", err)
+	}
+
+	second, err := textproto.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer second.Close()
+	if code, _, err := second.ReadResponse(421); err != nil {
+		t.Errorf("expected 421 while the first client is connected, but got %d: %v", code, err)
+	}
+
+	// the slot is given back once the first client leaves
+	first.Close()
+	for range 50 {
+		third, err := textproto.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		code, _, _ := third.ReadResponse(220)
+		third.Close()
+		if code == 220 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("expected a greeting once the first client left")
+}
+
+func TestParsePath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      string
+		prefix   string
+		expected string
+		ok       bool
+	}{
+		{name: "Plain", arg: "FROM:<a@example.com>", prefix: "FROM:", expected: "a@example.com", ok: true},
+		{name: "With Parameters", arg: "from: <a@example.com> SIZE=100", prefix: "FROM:", expected: "a@example.com", ok: true},
+		{name: "Null Sender", arg: "FROM:<>", prefix: "FROM:", expected: "", ok: true},
+		{name: "Missing Brackets", arg: "TO:a@example.com", prefix: "TO:", ok: false},
+		{name: "Wrong Prefix", arg: "TO:<a@example.com>", prefix: "FROM:", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parsePath(tc.arg, tc.prefix)
+			if ok != tc.ok || got != tc.expected {
+				t.Errorf("expected (%q, %v), but got (%q, %v)", tc.expected, tc.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMake(t *testing.T) {
+	testCases := []struct {
+		name           string
+		width, height  int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "Landscape", width: 400, height: 200, expectedWidth: 160, expectedHeight: 80},
+		{name: "Portrait", width: 100, height: 320, expectedWidth: 50, expectedHeight: 160},
+		{name: "Already Small", width: 40, height: 30, expectedWidth: 40, expectedHeight: 30},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			thumb, err := Make(encodePNG(t, tc.width, tc.height), 160)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail is not a JPEG: %v", err)
+			}
+			if got := img.Bounds().Size(); got.X != tc.expectedWidth || got.Y != tc.expectedHeight {
+				t.Errorf("expected %dx%d, but got %dx%d", tc.expectedWidth, tc.expectedHeight, got.X, got.Y)
+			}
+		})
+	}
+}
+
+func TestMakeUnsupported(t *testing.T) {
+	if _, err := Make([]byte("%PDF-1.4"), 160); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, but got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package tokencrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encrypted values look like enc:v<key version>:<wrapped data key>:<sealed value>.
+// Every value gets its own random data key, sealed with AES-GCM, and the data key is
+// in turn sealed with the versioned master key from config.
+const prefix = "enc:v"
+
+var ErrUnknownKeyVersion = errors.New("value was encrypted with an unknown key version")
+
+type Keyring struct {
+	keys    map[int][]byte
+	primary int
+}
+
+// ParseKeyring reads a comma separated list of version:base64key pairs, for example
+// "1:<old key>,2:<new key>". The highest version encrypts new values, all of them decrypt.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keys := make(map[int][]byte)
+	primary := 0
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		versionStr, encodedKey, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("key entry %q is not in version:key form", entry)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("key version %q must be a positive integer", versionStr)
+		}
+		if _, exists := keys[version]; exists {
+			return nil, fmt.Errorf("key version %d is listed twice", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key version %d: %w", version, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key version %d must be 32 bytes, got %d", version, len(key))
+		}
+		keys[version] = key
+		if version > primary {
+			primary = version
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys configured")
+	}
+	return &Keyring{keys: keys, primary: primary}, nil
+}
+
+// Encrypt seals plaintext with the primary key. associatedData binds the value to its
+// owner so it can't be copied onto another row. Empty strings stay empty.
+func (k *Keyring) Encrypt(plaintext, associatedData string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := seal(k.keys[k.primary], dataKey, []byte(associatedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	sealed, err := seal(dataKey, []byte(plaintext), []byte(associatedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+
+	return fmt.Sprintf("%s%d:%s:%s", prefix, k.primary,
+		base64.RawURLEncoding.EncodeToString(wrappedKey),
+		base64.RawURLEncoding.EncodeToString(sealed)), nil
+}
+
+// Decrypt opens a value produced by Encrypt. Values stored before encryption was
+// introduced are returned unchanged.
+func (k *Keyring) Decrypt(value, associatedData string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	version, wrappedKey, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	masterKey, ok := k.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownKeyVersion, version)
+	}
+
+	dataKey, err := open(masterKey, wrappedKey, []byte(associatedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, sealed, []byte(associatedData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is plaintext or sealed with an older key.
+func (k *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	version, _, _, err := parse(value)
+	return err != nil || version != k.primary
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func parse(value string) (version int, wrappedKey, sealed []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return 0, nil, nil, errors.New("malformed encrypted value")
+	}
+	version, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed key version: %w", err)
+	}
+	wrappedKey, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed data key: %w", err)
+	}
+	sealed, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+	return version, wrappedKey, sealed, nil
+}
+
+// seal returns nonce || ciphertext.
+func seal(key, plaintext, associatedData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(key, sealed, associatedData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, associatedData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,88 @@
+package tokencrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	oldRing, err := ParseKeyring("1:" + testKey(1))
+	if err != nil {
+		t.Fatalf("failed to parse keyring: %v", err)
+	}
+	newRing, err := ParseKeyring("1:" + testKey(1) + ",2:" + testKey(2))
+	if err != nil {
+		t.Fatalf("failed to parse keyring: %v", err)
+	}
+
+	oldValue, err := oldRing.Encrypt("ya29.access-token", "user-1")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	newValue, err := newRing.Encrypt("ya29.access-token", "user-1")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	testCases := []struct {
+		name          string
+		ring          *Keyring
+		value         string
+		aad           string
+		expected      string
+		expectErr     bool
+		needsRotation bool
+	}{
+		{name: "Current Key", ring: newRing, value: newValue, aad: "user-1", expected: "ya29.access-token"},
+		{name: "Rotated Key", ring: newRing, value: oldValue, aad: "user-1", expected: "ya29.access-token", needsRotation: true},
+		{name: "Unknown Key Version", ring: oldRing, value: newValue, aad: "user-1", expectErr: true},
+		{name: "Wrong Owner", ring: newRing, value: newValue, aad: "user-2", expectErr: true},
+		{name: "Legacy Plaintext", ring: newRing, value: "plain-token", aad: "user-1", expected: "plain-token", needsRotation: true},
+		{name: "Empty Value", ring: newRing, value: "", aad: "user-1", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.ring.Decrypt(tc.value, tc.aad)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %v, but got: %v", tc.expectErr, err)
+			}
+			if !tc.expectErr && got != tc.expected {
+				t.Errorf("expected %q, but got %q", tc.expected, got)
+			}
+			if !tc.expectErr && tc.ring.NeedsRotation(tc.value) != tc.needsRotation {
+				t.Errorf("expected needs rotation %v", tc.needsRotation)
+			}
+		})
+	}
+
+	if strings.Contains(newValue, "ya29") {
+		t.Errorf("encrypted value leaks the plaintext: %s", newValue)
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec string
+	}{
+		{name: "Empty", spec: ""},
+		{name: "Missing Version", spec: testKey(1)},
+		{name: "Short Key", spec: "1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "Duplicate Version", spec: "1:" + testKey(1) + ",1:" + testKey(2)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseKeyring(tc.spec); err == nil {
+				t.Errorf("expected an error for spec %q", tc.spec)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// invoice events, status_changed is the only one with from and to statuses. Staging
+// records mailsource.EventStaged and mailsource.EventAutoRejected.
+const (
+	eventStatusChanged = "status_changed"
+	eventFileArchived  = "file_archived"
+	eventFileSubmitted = "file_submitted"
+	eventApprovalRetry = "approval_retry"
+	eventFileDeleted   = "file_deleted"
+)
+
+// invoiceActor is who caused an event, requests also say where they came from.
+type invoiceActor struct {
+	Kind      string
+	User      database.User
+	IP        string
+	UserAgent string
+}
+
+var (
+	automationActor  = invoiceActor{Kind: "automation"}
+	approvalJobActor = invoiceActor{Kind: "approval_job"}
+)
+
+func requestActor(r *http.Request, user database.User) invoiceActor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return invoiceActor{
+		Kind:      "user",
+		User:      user,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+type invoiceEvent struct {
+	Event              string
+	FromStatus         string
+	ToStatus           string
+	ApprovalJobID      string
+	S3Key              string
+	AccountingResponse string
+	Error              string
+}
+
+// recordInvoiceEvent appends to the invoice's history. The action it describes has
+// already happened, so a failure to record it is logged rather than returned.
+func (cfg *apiConfig) recordInvoiceEvent(ctx context.Context, invoiceID string, actor invoiceActor, event invoiceEvent) {
+	err := cfg.DB.CreateInvoiceEvent(context.WithoutCancel(ctx), database.CreateInvoiceEventParams{
+		ID:                 uuid.New().String(),
+		StagedInvoiceID:    invoiceID,
+		Event:              event.Event,
+		FromStatus:         toNullString(event.FromStatus),
+		ToStatus:           toNullString(event.ToStatus),
+		Actor:              actor.Kind,
+		ActorUserID:        toNullString(actor.User.ID),
+		ClientIp:           toNullString(actor.IP),
+		UserAgent:          toNullString(actor.UserAgent),
+		ApprovalJobID:      toNullString(event.ApprovalJobID),
+		S3Key:              toNullString(event.S3Key),
+		AccountingResponse: toNullString(event.AccountingResponse),
+		Error:              toNullString(event.Error),
+		CreatedAt:          time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Failed to record %s event of invoice %s: %v", event.Event, invoiceID, err)
+	}
+}
+
+func (cfg *apiConfig) recordStatusChange(ctx context.Context, invoiceID string, actor invoiceActor, from, to string, event invoiceEvent) {
+	event.Event, event.FromStatus, event.ToStatus = eventStatusChanged, from, to
+	cfg.recordInvoiceEvent(ctx, invoiceID, actor, event)
+}
+
+// decidedByUser reports whether the invoice last moved to status because a user asked,
+// rather than a rule or the approval worker.
+func (cfg *apiConfig) decidedByUser(ctx context.Context, invoiceID, status string) bool {
+	event, err := cfg.DB.GetLatestStatusChangeTo(ctx, database.GetLatestStatusChangeToParams{
+		StagedInvoiceID: invoiceID,
+		ToStatus:        toNullString(status),
+	})
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to look up who made invoice %s %s: %v", invoiceID, status, err)
+		}
+		return false
+	}
+	return event.Actor == "user"
+}
+
+// handlerGetInvoiceHistory lists everything that happened to an invoice since it was
+// staged, oldest first.
+func (cfg *apiConfig) handlerGetInvoiceHistory(w http.ResponseWriter, r *http.Request) {
+	invoiceID := chi.URLParam(r, "invoiceID")
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	stagedInvoice, err := cfg.DB.GetStagedInvoice(r.Context(), database.GetStagedInvoiceParams{
+		ID:     invoiceID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Staged invoice not found", err)
+		return
+	}
+
+	events, err := cfg.DB.ListInvoiceEventsByInvoice(r.Context(), stagedInvoice.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to list invoice history", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/accountingservice"
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/doctype"
+	"github.com/felixsolom/fetch-duck/internal/invoicefields"
+	"github.com/felixsolom/fetch-duck/internal/mailparse"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/felixsolom/fetch-duck/internal/pdftext"
+)
+
+const (
+	fieldsStatusExtracted = "extracted"
+	fieldsStatusNoPDF     = "no_pdf"
+	fieldsStatusNoText    = "no_text"
+	fieldsStatusFailed    = "failed"
+)
+
+// how many invoices one extraction run reads, the rest wait for the next run
+const fieldExtractionBatch = 50
+
+// most PDF attachments read per invoice
+const maxFieldAttachments = 5
+
+// how much extracted text is kept for later checks, a few pages worth
+const maxFieldsText = 64 << 10
+
+// fields less certain than this aren't passed on to the accounting service
+const minDetailConfidence = 0.7
+
+type invoiceFieldsResponse struct {
+	Status       string `json:"status"`
+	AttachmentID string `json:"attachment_id,omitempty"`
+	invoicefields.Fields
+	Issues []invoicefields.Issue `json:"issues"`
+	Error  string                `json:"error,omitempty"`
+}
+
+// processNewInvoices runs after invoices were staged: fields are read first so queued
+// approvals can pass them on.
+func (cfg *apiConfig) processNewInvoices(ctx context.Context, userID string) {
+	cfg.extractInvoiceFields(ctx, userID)
+	cfg.processQueuedApprovals(ctx, userID)
+}
+
+// extractInvoiceFields reads the PDF attachments of the user's open invoices that
+// haven't been read yet. An invoice whose mailbox can't be reached is left for the
+// next run, one whose PDF can't be read is recorded as failed so it isn't retried
+// forever.
+func (cfg *apiConfig) extractInvoiceFields(ctx context.Context, userID string) {
+	invoices, err := cfg.DB.ListStagedInvoicesWithoutFields(ctx, database.ListStagedInvoicesWithoutFieldsParams{
+		UserID: userID,
+		Limit:  fieldExtractionBatch,
+	})
+	if err != nil {
+		log.Printf("Failed to list invoices without fields for user ID %s: %v", userID, err)
+		return
+	}
+
+	// one connection per mailbox for the whole batch
+	sources := map[string]mailsource.MailSource{}
+	for _, invoice := range invoices {
+		source, ok := sources[invoice.Source]
+		if !ok {
+			var closeSource func()
+			source, closeSource, err = cfg.mailSourceForInvoice(ctx, invoice)
+			if err != nil {
+				log.Printf("Failed to connect to %s mailbox to read invoice %s: %v", invoice.Source, invoice.ID, err)
+				continue
+			}
+			defer closeSource()
+			sources[invoice.Source] = source
+		}
+
+		params := cfg.readInvoiceFields(ctx, source, invoice)
+		if ctx.Err() != nil {
+			return
+		}
+
+		docType := doctype.Classify(invoice.Subject, messageBody(ctx, source, invoice, params.Text), params.Text)
+		err = cfg.DB.UpdateStagedInvoiceDocumentType(ctx, database.UpdateStagedInvoiceDocumentTypeParams{
+			DocumentType:           sql.NullString{String: docType.Type, Valid: true},
+			DocumentTypeConfidence: sql.NullFloat64{Float64: docType.Confidence, Valid: true},
+			ID:                     invoice.ID,
+			UserID:                 invoice.UserID,
+		})
+		if err != nil {
+			log.Printf("Failed to save document type of invoice %s: %v", invoice.ID, err)
+		}
+
+		if err := cfg.DB.UpsertInvoiceFields(ctx, params); err != nil {
+			log.Printf("Failed to save fields of invoice %s: %v", invoice.ID, err)
+		}
+	}
+}
+
+// messageBody returns what the email says besides the subject. The full body is only
+// downloaded when there's no document text, otherwise the snippet is enough: the
+// document says what it is better than the email around it.
+func messageBody(ctx context.Context, source mailsource.MailSource, invoice database.StagedInvoice, documentText string) string {
+	if documentText != "" || !invoice.GmailMessageID.Valid {
+		return invoice.Snippet.String
+	}
+	raw, err := source.GetRaw(ctx, invoice.GmailMessageID.String)
+	if err != nil {
+		return invoice.Snippet.String
+	}
+	parsed, err := mailparse.Parse(raw)
+	if err != nil {
+		return invoice.Snippet.String
+	}
+	return parsed.PlainText()
+}
+
+// readInvoiceFields extracts the fields of every PDF attachment and keeps the one
+// that yielded the most, a receipt PDF next to the invoice shouldn't win.
+func (cfg *apiConfig) readInvoiceFields(ctx context.Context, source mailsource.MailSource, invoice database.StagedInvoice) database.UpsertInvoiceFieldsParams {
+	attachments, err := cfg.DB.ListStagedAttachmentsByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return invoiceFieldsParams(invoice.ID, fieldsStatusFailed, "", invoicefields.Fields{}, "", err)
+	}
+
+	var pdfs []database.StagedAttachment
+	for _, attachment := range attachments {
+		if isPDF(attachment.MimeType, attachment.Filename) && len(pdfs) < maxFieldAttachments {
+			pdfs = append(pdfs, attachment)
+		}
+	}
+	if len(pdfs) == 0 {
+		return invoiceFieldsParams(invoice.ID, fieldsStatusNoPDF, "", invoicefields.Fields{}, "", nil)
+	}
+
+	best := -1.0
+	var params database.UpsertInvoiceFieldsParams
+	var lastErr error
+	for _, attachment := range pdfs {
+		data, err := source.GetAttachment(ctx, invoice.GmailMessageID.String, attachment.GmailPartID)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to download %s: %w", attachment.Filename, err)
+			continue
+		}
+		fields, text, err := extractAttachmentFields(data)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to read %s: %w", attachment.Filename, err)
+			continue
+		}
+		if score := fieldsScore(fields); score > best {
+			best = score
+			params = invoiceFieldsParams(invoice.ID, fieldsStatusExtracted, attachment.ID, fields, text, nil)
+		}
+	}
+	if best >= 0 {
+		return params
+	}
+	if errors.Is(lastErr, pdftext.ErrNoText) {
+		return invoiceFieldsParams(invoice.ID, fieldsStatusNoText, "", invoicefields.Fields{}, "", lastErr)
+	}
+	log.Printf("Failed to extract fields of invoice %s: %v", invoice.ID, lastErr)
+	return invoiceFieldsParams(invoice.ID, fieldsStatusFailed, "", invoicefields.Fields{}, "", lastErr)
+}
+
+// extractAttachmentFields reads one PDF. The parser is fed whatever arrives by mail,
+// a file that makes it panic fails like any unreadable one instead of taking the
+// whole extraction run down.
+func extractAttachmentFields(data []byte) (fields invoicefields.Fields, text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic reading PDF: %v\n%s", r, debug.Stack())
+			fields, text, err = invoicefields.Fields{}, "", fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+
+	text, err = pdftext.Extract(data)
+	if err != nil {
+		return invoicefields.Fields{}, "", err
+	}
+	return invoicefields.Extract(text), text, nil
+}
+
+func isPDF(mimeType, filename string) bool {
+	return strings.EqualFold(mimeType, "application/pdf") || strings.EqualFold(path.Ext(filename), ".pdf")
+}
+
+func fieldsScore(f invoicefields.Fields) float64 {
+	return f.Total.Confidence + f.VAT.Confidence + f.Currency.Confidence + f.InvoiceNumber.Confidence +
+		f.IssueDate.Confidence + f.DueDate.Confidence + f.SupplierTaxID.Confidence
+}
+
+func invoiceFieldsParams(invoiceID, status, attachmentID string, f invoicefields.Fields, text string, err error) database.UpsertInvoiceFieldsParams {
+	if len(text) > maxFieldsText {
+		text = strings.ToValidUTF8(text[:maxFieldsText], "")
+	}
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	now := time.Now().Unix()
+	return database.UpsertInvoiceFieldsParams{
+		StagedInvoiceID:            invoiceID,
+		StagedAttachmentID:         toNullString(attachmentID),
+		Status:                     status,
+		TotalAmount:                toNullAmount(f.Total),
+		TotalAmountConfidence:      f.Total.Confidence,
+		VatAmount:                  toNullAmount(f.VAT),
+		VatAmountConfidence:        f.VAT.Confidence,
+		Currency:                   toNullString(f.Currency.Value),
+		CurrencyConfidence:         f.Currency.Confidence,
+		InvoiceNumber:              toNullString(f.InvoiceNumber.Value),
+		InvoiceNumberConfidence:    f.InvoiceNumber.Confidence,
+		IssueDate:                  toNullString(f.IssueDate.Value),
+		IssueDateConfidence:        f.IssueDate.Confidence,
+		DueDate:                    toNullString(f.DueDate.Value),
+		DueDateConfidence:          f.DueDate.Confidence,
+		SupplierTaxID:              toNullString(f.SupplierTaxID.Value),
+		SupplierTaxIDConfidence:    f.SupplierTaxID.Confidence,
+		AllocationNumber:           toNullString(f.AllocationNumber.Value),
+		AllocationNumberConfidence: f.AllocationNumber.Confidence,
+		Text:                       text,
+		Error:                      toNullString(errMsg),
+		CreatedAt:                  now,
+		UpdatedAt:                  now,
+	}
+}
+
+func toNullAmount(a invoicefields.Amount) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: a.Value, Valid: a.Confidence > 0}
+}
+
+func fieldsFromRow(row database.InvoiceField) invoicefields.Fields {
+	return invoicefields.Fields{
+		Total:            invoicefields.Amount{Value: row.TotalAmount.Float64, Confidence: row.TotalAmountConfidence},
+		VAT:              invoicefields.Amount{Value: row.VatAmount.Float64, Confidence: row.VatAmountConfidence},
+		Currency:         invoicefields.Field{Value: row.Currency.String, Confidence: row.CurrencyConfidence},
+		InvoiceNumber:    invoicefields.Field{Value: row.InvoiceNumber.String, Confidence: row.InvoiceNumberConfidence},
+		IssueDate:        invoicefields.Field{Value: row.IssueDate.String, Confidence: row.IssueDateConfidence},
+		DueDate:          invoicefields.Field{Value: row.DueDate.String, Confidence: row.DueDateConfidence},
+		SupplierTaxID:    invoicefields.Field{Value: row.SupplierTaxID.String, Confidence: row.SupplierTaxIDConfidence},
+		AllocationNumber: invoicefields.Field{Value: row.AllocationNumber.String, Confidence: row.AllocationNumberConfidence},
+	}
+}
+
+func invoiceFieldsResponseFromRow(row database.InvoiceField, invoice database.StagedInvoice) *invoiceFieldsResponse {
+	fields := fieldsFromRow(row)
+	issues := invoicefields.Check(fields, issueDate(fields, invoice), doctype.NeedsAllocationNumber(invoice.DocumentType.String))
+	if issues == nil {
+		issues = []invoicefields.Issue{}
+	}
+	return &invoiceFieldsResponse{
+		Status:       row.Status,
+		AttachmentID: row.StagedAttachmentID.String,
+		Fields:       fields,
+		Issues:       issues,
+		Error:        row.Error.String,
+	}
+}
+
+// issueDate decides which allocation threshold applies, the date on the invoice or,
+// when none was found, the day it arrived.
+func issueDate(fields invoicefields.Fields, invoice database.StagedInvoice) time.Time {
+	if fields.IssueDate.Confidence > 0 {
+		if date, err := time.Parse(time.DateOnly, fields.IssueDate.Value); err == nil {
+			return date
+		}
+	}
+	return time.Unix(invoice.ReceivedAt, 0)
+}
+
+// documentDetails says what kind of document the accounting draft is, when the
+// classification is sure enough.
+func documentDetails(invoice database.StagedInvoice) accountingservice.ExpenseDetails {
+	var details accountingservice.ExpenseDetails
+	if invoice.DocumentTypeConfidence.Float64 >= minDetailConfidence {
+		details.DocumentType = doctype.AccountingCode(invoice.DocumentType.String)
+	}
+	return details
+}
+
+// expenseDetails adds the fields confident enough to prefill the accounting draft.
+func expenseDetails(details accountingservice.ExpenseDetails, row database.InvoiceField) accountingservice.ExpenseDetails {
+	f := fieldsFromRow(row)
+	if f.Total.Confidence >= minDetailConfidence {
+		details.Amount = f.Total.Value
+	}
+	if f.VAT.Confidence >= minDetailConfidence {
+		details.VAT = f.VAT.Value
+	}
+	if f.Currency.Confidence >= minDetailConfidence {
+		details.Currency = f.Currency.Value
+	}
+	if f.InvoiceNumber.Confidence >= minDetailConfidence {
+		details.Number = f.InvoiceNumber.Value
+	}
+	if f.IssueDate.Confidence >= minDetailConfidence {
+		details.Date = f.IssueDate.Value
+	}
+	if f.DueDate.Confidence >= minDetailConfidence {
+		details.DueDate = f.DueDate.Value
+	}
+	if f.SupplierTaxID.Confidence >= minDetailConfidence {
+		details.SupplierTaxID = f.SupplierTaxID.Value
+	}
+	return details
+}
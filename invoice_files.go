@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailparse"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+var errUnknownAttachment = errors.New("attachment does not belong to this invoice")
+
+type invoiceFile struct {
+	// staged attachment the file came from, empty for archived message bodies
+	AttachmentID string
+	Filename     string
+	MimeType     string
+	Data         []byte
+}
+
+// fetchInvoiceAttachments downloads the staged attachments picked for approval, or all
+// of them when none were picked.
+func (cfg *apiConfig) fetchInvoiceAttachments(ctx context.Context, source mailsource.MailSource, invoice database.StagedInvoice, selectedIDs []string) ([]invoiceFile, error) {
+	stagedAttachments, err := cfg.DB.ListStagedAttachmentsByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list staged attachments: %w", err)
+	}
+
+	selected := make(map[string]bool, len(selectedIDs))
+	for _, id := range selectedIDs {
+		selected[id] = true
+	}
+
+	var wanted []mailsource.Attachment
+	var wantedIDs []string
+	if len(stagedAttachments) == 0 {
+		// invoices staged before attachments were recorded
+		if len(selected) > 0 {
+			return nil, errUnknownAttachment
+		}
+		msg, err := source.GetMetadata(ctx, invoice.GmailMessageID.String)
+		if err != nil {
+			return nil, err
+		}
+		wanted = msg.Attachments
+		wantedIDs = make([]string, len(wanted))
+	} else {
+		for _, staged := range stagedAttachments {
+			if len(selected) > 0 && !selected[staged.ID] {
+				continue
+			}
+			delete(selected, staged.ID)
+			wanted = append(wanted, mailsource.Attachment{
+				PartID:   staged.GmailPartID,
+				Filename: staged.Filename,
+				MimeType: staged.MimeType,
+				Size:     staged.Size,
+			})
+			wantedIDs = append(wantedIDs, staged.ID)
+		}
+		if len(selected) > 0 {
+			return nil, errUnknownAttachment
+		}
+	}
+
+	if len(wanted) == 0 {
+		log.Printf("Invoice %s has no attachments, archiving the message body instead", invoice.ID)
+		return archiveMessageBody(ctx, source, invoice)
+	}
+
+	files := make([]invoiceFile, 0, len(wanted))
+	for i, attachment := range wanted {
+		data, err := source.GetAttachment(ctx, invoice.GmailMessageID.String, attachment.PartID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, invoiceFile{
+			AttachmentID: wantedIDs[i],
+			Filename:     attachment.Filename,
+			MimeType:     attachment.MimeType,
+			Data:         data,
+		})
+	}
+	return files, nil
+}
+
+// archiveMessageBody turns a receipt that lives in the email body into documents: the
+// raw message as .eml and a standalone .html rendering with its inline images embedded.
+func archiveMessageBody(ctx context.Context, source mailsource.MailSource, invoice database.StagedInvoice) ([]invoiceFile, error) {
+	raw, err := source.GetRaw(ctx, invoice.GmailMessageID.String)
+	if err != nil {
+		return nil, err
+	}
+
+	baseName := archiveBaseName(invoice.Subject)
+	files := []invoiceFile{{
+		Filename: baseName + ".eml",
+		MimeType: "message/rfc822",
+		Data:     raw,
+	}}
+
+	parsed, err := mailparse.Parse(raw)
+	if err != nil {
+		// the .eml on its own is still a complete archive of the receipt
+		log.Printf("Failed to parse message %s, archiving .eml only: %v", invoice.GmailMessageID.String, err)
+		return files, nil
+	}
+	if doc, ok := parsed.StandaloneHTML(); ok {
+		files = append(files, invoiceFile{
+			Filename: baseName + ".html",
+			MimeType: "text/html",
+			Data:     doc,
+		})
+	}
+	return files, nil
+}
+
+// archiveBaseName makes a filename out of the subject, dropping characters that S3
+// keys and accounting uploads don't cope with.
+func archiveBaseName(subject string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|':
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(subject))
+
+	if runes := []rune(name); len(runes) > 80 {
+		name = strings.TrimSpace(string(runes[:80]))
+	}
+	if name == "" {
+		name = "receipt"
+	}
+	return name
+}
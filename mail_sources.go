@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/imapservice"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// scannersForUser returns a scanner for every mailbox the user has connected. Gmail
+// is skipped when its authorization has lapsed as long as another mailbox is left.
+func (cfg *apiConfig) scannersForUser(ctx context.Context, userID string) ([]mailsource.Scanner, error) {
+	var scanners []mailsource.Scanner
+
+	gmailService, gmailErr := cfg.gmailServiceForUser(ctx, userID)
+	if gmailErr == nil {
+		scanners = append(scanners, gmailService)
+	}
+
+	imapConfig, err := cfg.imapConfigForUser(ctx, userID)
+	if err == nil {
+		scanners = append(scanners, imapservice.Scanner{Config: imapConfig})
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if len(scanners) == 0 {
+		return nil, gmailErr
+	}
+	if gmailErr != nil {
+		log.Printf("Skipping Gmail for user ID %s: %v", userID, gmailErr)
+	}
+	return scanners, nil
+}
+
+// mailSourceForInvoice connects to the mailbox the invoice was staged from. The
+// returned close func has to be called once the source is no longer needed.
+func (cfg *apiConfig) mailSourceForInvoice(ctx context.Context, invoice database.StagedInvoice) (mailsource.MailSource, func(), error) {
+	switch invoice.Source {
+	case uploadSourceName:
+		return uploadSource{s3: cfg.S3}, func() {}, nil
+	case smtpSourceName, mboxSourceName:
+		return storedMessageSource{s3: cfg.S3, name: invoice.Source, userID: invoice.UserID}, func() {}, nil
+	case imapservice.SourceName:
+		imapConfig, err := cfg.imapConfigForUser(ctx, invoice.UserID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load IMAP account: %w", err)
+		}
+		client, err := imapservice.Dial(ctx, imapConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, func() { client.Close() }, nil
+	default:
+		gmailService, err := cfg.gmailServiceForUser(ctx, invoice.UserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gmailService, func() {}, nil
+	}
+}
+
+// imapConfigForUser returns sql.ErrNoRows when the user has no IMAP account.
+func (cfg *apiConfig) imapConfigForUser(ctx context.Context, userID string) (imapservice.Config, error) {
+	account, err := cfg.DB.GetImapAccount(ctx, userID)
+	if err != nil {
+		return imapservice.Config{}, err
+	}
+
+	password, err := cfg.Keyring.Decrypt(account.Password, imapPasswordAAD(userID))
+	if err != nil {
+		return imapservice.Config{}, fmt.Errorf("failed to decrypt IMAP password: %w", err)
+	}
+	return imapservice.Config{
+		Host:     account.Host,
+		Port:     int(account.Port),
+		Username: account.Username,
+		Password: password,
+		Mailbox:  account.Mailbox,
+	}, nil
+}
+
+// the password is bound to its owner so it can't be moved to another account row
+func imapPasswordAAD(userID string) string {
+	return "imap:" + userID
+}
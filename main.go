@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
@@ -14,6 +16,7 @@ import (
 	"github.com/felixsolom/fetch-duck/internal/config"
 	"github.com/felixsolom/fetch-duck/internal/database"
 	"github.com/felixsolom/fetch-duck/internal/s3service"
+	"github.com/felixsolom/fetch-duck/internal/tokencrypt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -28,12 +31,27 @@ var staticFiles embed.FS
 //go:embed sql/schema/*.sql
 var migrationFiles embed.FS
 
+// fileStore keeps archived invoices and the messages we receive ourselves.
+type fileStore interface {
+	UploadFile(ctx context.Context, key string, data []byte) error
+	DownloadFile(ctx context.Context, key string) ([]byte, error)
+	OpenFile(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	DeletePrefix(ctx context.Context, prefix string) ([]string, error)
+}
+
+// accountingService takes approved invoices in as draft expenses.
+type accountingService interface {
+	StagedInvoiceFile(ctx context.Context, filename string, fileData []byte, details accountingservice.ExpenseDetails) (accountingservice.UploadResult, error)
+}
+
 type apiConfig struct {
 	DB           *database.Queries
 	GoogleConfig *oauth2.Config
 	App          config.AppConfig
-	S3           *s3service.Service
-	Accounting   *accountingservice.Service
+	S3           fileStore
+	Accounting   accountingService
+	Keyring      *tokencrypt.Keyring
+	Inbound      config.InboundConfig
 }
 
 func main() {
@@ -42,23 +60,6 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	s3Svc, err := s3service.New(cfg.AWS)
-	if err != nil {
-		log.Fatalf("Failed to create s3 service: %v", err)
-	}
-	log.Println("S3 services initialized successfully.")
-
-	accountingSvc, err := accountingservice.New(cfg.Accounting)
-	if err != nil {
-		log.Fatalf("Failed to create accountiing service: %v", err)
-	}
-	log.Println("Accounting service initialized successfully")
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set.")
-	}
-
 	db, err := sql.Open("libsql", cfg.DB.URL)
 	if err != nil {
 		log.Fatalf("Failed to open database connection: %v", err)
@@ -83,6 +84,53 @@ func main() {
 	log.Println("Database migrations completed successfully.")
 
 	dbQueries := database.New(db)
+
+	keyring, err := tokencrypt.ParseKeyring(cfg.Encryption.TokenKeys)
+	if err != nil {
+		log.Fatalf("Failed to load token encryption keys: %v", err)
+	}
+
+	s3Svc, err := s3service.New(cfg.AWS)
+	if err != nil {
+		log.Fatalf("Failed to create s3 service: %v", err)
+	}
+	log.Println("S3 services initialized successfully.")
+
+	// anything after the binary name is a maintenance command, not a server start
+	if len(os.Args) > 1 {
+		commandCfg := &apiConfig{
+			DB:      dbQueries,
+			S3:      s3Svc,
+			Keyring: keyring,
+		}
+		if err := runCommand(context.Background(), os.Args[1:], commandCfg); err != nil {
+			log.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
+	accountingSvc, err := accountingservice.New(cfg.Accounting)
+	if err != nil {
+		log.Fatalf("Failed to create accountiing service: %v", err)
+	}
+	log.Println("Accounting service initialized successfully")
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("PORT environment variable is not set.")
+	}
+
+	// scans don't survive a restart, so anything still marked running was cut off
+	now := time.Now().Unix()
+	err = dbQueries.FailInterruptedScanJobs(context.Background(), database.FailInterruptedScanJobsParams{
+		LastError:  sql.NullString{String: "interrupted by server restart", Valid: true},
+		FinishedAt: sql.NullInt64{Int64: now, Valid: true},
+		UpdatedAt:  now,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to mark interrupted scans as failed: %v", err)
+	}
+
 	fmt.Println("Configuration loaded and database connection established")
 	fmt.Println("Google Client ID:", cfg.Google.ClientID)
 
@@ -92,6 +140,24 @@ func main() {
 		App:          cfg.App,
 		S3:           s3Svc,
 		Accounting:   accountingSvc,
+		Keyring:      keyring,
+		Inbound:      cfg.Inbound,
+	}
+
+	go apiCfg.runApprovalWorker(context.Background())
+
+	if cfg.Scheduler.ScanInterval > 0 {
+		go apiCfg.runScanScheduler(context.Background(), cfg.Scheduler.ScanInterval, cfg.Scheduler.ScanConcurrency)
+	}
+
+	if cfg.Inbound.SMTPAddr != "" {
+		smtpServer := apiCfg.newSMTPServer()
+		go func() {
+			log.Printf("SMTP listener accepting mail for %s on %s", cfg.Inbound.Domain, cfg.Inbound.SMTPAddr)
+			if err := smtpServer.ListenAndServe(cfg.Inbound.SMTPAddr); err != nil {
+				log.Fatalf("SMTP listener failed: %v", err)
+			}
+		}()
 	}
 
 	r := chi.NewRouter()
@@ -121,8 +187,33 @@ func main() {
 		authedRouter.Get("/auth/status", apiCfg.handlerAuthStatus)
 		authedRouter.Post("/auth/logout", apiCfg.handlerLogout)
 		authedRouter.Get("/invoices/staged", apiCfg.handlerListStagedInvoices)
+		authedRouter.Post("/invoices/upload", apiCfg.handlerUploadInvoice)
+		authedRouter.Post("/imports/mbox", apiCfg.handlerImportMbox)
+		authedRouter.Get("/invoices/{invoiceID}/attachments", apiCfg.handlerListInvoiceAttachments)
+		authedRouter.Get("/invoices/{invoiceID}/attachments/{n}", apiCfg.handlerGetInvoiceAttachment)
+		authedRouter.Get("/invoices/{invoiceID}/attachments/{n}/thumbnail", apiCfg.handlerGetAttachmentThumbnail)
 		authedRouter.Post("/invoices/{invoiceID}/approve", apiCfg.handlerApproveInvoice)
 		authedRouter.Post("/invoices/{invoiceID}/reject", apiCfg.handlerRejectInvoice)
+		authedRouter.Post("/invoices/{invoiceID}/reopen", apiCfg.handlerReopenInvoice)
+		authedRouter.Post("/invoices/{invoiceID}/revoke", apiCfg.handlerRevokeApproval)
+		authedRouter.Post("/invoices/bulk", apiCfg.handlerBulkInvoiceAction)
+		authedRouter.Get("/approvals/{jobID}", apiCfg.handlerGetApproval)
+		authedRouter.Get("/invoices/{invoiceID}/rule-hits", apiCfg.handlerListInvoiceRuleHits)
+		authedRouter.Get("/invoices/{invoiceID}/history", apiCfg.handlerGetInvoiceHistory)
+		authedRouter.Get("/invoice-rules", apiCfg.handlerListInvoiceRules)
+		authedRouter.Post("/invoice-rules", apiCfg.handlerCreateInvoiceRule)
+		authedRouter.Put("/invoice-rules/{ruleID}", apiCfg.handlerUpdateInvoiceRule)
+		authedRouter.Delete("/invoice-rules/{ruleID}", apiCfg.handlerDeleteInvoiceRule)
+		authedRouter.Post("/scans", apiCfg.handlerStartScan)
+		authedRouter.Get("/scans/{scanID}", apiCfg.handlerGetScan)
+		authedRouter.Get("/scan-rules", apiCfg.handlerGetScanRules)
+		authedRouter.Put("/scan-rules", apiCfg.handlerPutScanRules)
+		authedRouter.Post("/scan-rules/dry-run", apiCfg.handlerDryRunScanRules)
+		authedRouter.Get("/imap-account", apiCfg.handlerGetImapAccount)
+		authedRouter.Put("/imap-account", apiCfg.handlerPutImapAccount)
+		authedRouter.Delete("/imap-account", apiCfg.handlerDeleteImapAccount)
+		authedRouter.Get("/inbound-address", apiCfg.handlerGetInboundAddress)
+		authedRouter.Post("/inbound-address/rotate", apiCfg.handlerRotateInboundAddress)
 	})
 
 	r.Mount("/api/v1", apiRouter)
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/database"
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+	"github.com/felixsolom/fetch-duck/internal/mbox"
+	"github.com/google/uuid"
+)
+
+// mboxSourceName is recorded on invoices imported from mbox and .eml archives.
+const mboxSourceName = "mbox"
+
+// how many messages go by between import progress logs
+const importLogInterval = 500
+
+type importStats struct {
+	Seen          int64  `json:"seen"`
+	Staged        int64  `json:"staged"`
+	Duplicates    int64  `json:"duplicates"`
+	NotInvoices   int64  `json:"not_invoices"`
+	SkippedByRule int64  `json:"skipped_by_rule"`
+	Failed        int64  `json:"failed"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// importMbox stages the messages in an mbox archive, or a single .eml message, that
+// match the user's scan rules, one message at a time. Messages whose Message-ID is
+// already staged, from any source, are skipped, so importing the same archive twice
+// is harmless.
+func (cfg *apiConfig) importMbox(ctx context.Context, userID string, r io.Reader) (importStats, error) {
+	var stats importStats
+
+	criteria, err := cfg.scanCriteriaForUser(ctx, userID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to load scan rules: %w", err)
+	}
+	assessor, err := mailsource.NewAssessor(ctx, cfg.DB, userID, criteria.MinScore)
+	if err != nil {
+		return stats, err
+	}
+
+	stagedIDs, err := cfg.DB.ListInternetMessageIDsByUser(ctx, userID)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list staged Message-IDs: %w", err)
+	}
+	seen := make(map[string]bool, len(stagedIDs))
+	for _, id := range stagedIDs {
+		seen[id.String] = true
+	}
+
+	reader := mbox.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		raw, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read archive: %w", err)
+		}
+		stats.Seen++
+		if stats.Seen%importLogInterval == 0 {
+			log.Printf("Import for user ID %s: %d messages read, %d staged", userID, stats.Seen, stats.Staged)
+		}
+
+		msg, err := mailsource.ParseRaw(uuid.New().String(), raw, time.Time{})
+		if err != nil {
+			stats.Failed++
+			stats.LastError = err.Error()
+			continue
+		}
+		if msg.InternetMessageID != "" && seen[msg.InternetMessageID] {
+			stats.Duplicates++
+			continue
+		}
+		if !criteria.Matches(msg) {
+			stats.NotInvoices++
+			continue
+		}
+		if msg.ReceivedAt.IsZero() {
+			msg.ReceivedAt = time.Now()
+		}
+
+		staged, err := cfg.stageStoredMessage(ctx, userID, mboxSourceName, msg, raw, assessor)
+		if errors.Is(err, mailsource.ErrAlreadyStaged) {
+			stats.Duplicates++
+			seen[msg.InternetMessageID] = true
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to stage imported message %s: %v", msg.InternetMessageID, err)
+			stats.Failed++
+			stats.LastError = fmt.Sprintf("message %s: %v", msg.InternetMessageID, err)
+			continue
+		}
+		if !staged {
+			stats.SkippedByRule++
+			continue
+		}
+		if msg.InternetMessageID != "" {
+			seen[msg.InternetMessageID] = true
+		}
+		stats.Staged++
+	}
+
+	log.Printf("Import for user ID %s finished: %d seen, %d staged, %d duplicates, %d not invoices, %d skipped by rules, %d failed",
+		userID, stats.Seen, stats.Staged, stats.Duplicates, stats.NotInvoices, stats.SkippedByRule, stats.Failed)
+	return stats, nil
+}
+
+// handlerImportMbox streams an uploaded archive into importMbox. The archive is either
+// the raw request body or the "file" part of a multipart form.
+func (cfg *apiConfig) handlerImportMbox(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUserFromContext(r)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Could not get user from context", nil)
+		return
+	}
+
+	var archive io.Reader = r.Body
+	if mr, err := r.MultipartReader(); err == nil {
+		archive = nil
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			if part.FormName() == "file" {
+				archive = part
+				break
+			}
+		}
+		if archive == nil {
+			respondWithError(w, http.StatusBadRequest, "No file uploaded", nil)
+			return
+		}
+	}
+
+	log.Printf("User %s started an mbox import", user.Email)
+	stats, err := cfg.importMbox(r.Context(), user.ID, archive)
+	// whatever got staged before a failure still gets read and its queued approvals run
+	go cfg.processNewInvoices(context.Background(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Import failed", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// userIDByEmail is for commands, which name users by email.
+func userIDByEmail(ctx context.Context, db *database.Queries, email string) (string, error) {
+	user, err := db.GetUser(ctx, email)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no user with email %s", email)
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
@@ -42,3 +42,15 @@ func getUserFromContext(r *http.Request) (database.User, bool) {
 	user, ok := r.Context().Value(userContextKey).(database.User)
 	return user, ok
 }
+
+func (cfg *apiConfig) hasValidSession(r *http.Request) bool {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return false
+	}
+	_, err = cfg.DB.GetUserBySessionToken(r.Context(), database.GetUserBySessionTokenParams{
+		Token:  cookie.Value,
+		Expiry: time.Now().Unix(),
+	})
+	return err == nil
+}
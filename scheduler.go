@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// runScanScheduler scans every user with a connected mailbox once per interval
+// until ctx is cancelled.
+func (cfg *apiConfig) runScanScheduler(ctx context.Context, interval time.Duration, concurrency int) {
+	log.Printf("Scan scheduler started: every %s with up to %d concurrent scans", interval, concurrency)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Scan scheduler stopped")
+			return
+		case <-ticker.C:
+			cfg.scanAllUsers(ctx, concurrency)
+		}
+	}
+}
+
+func (cfg *apiConfig) scanAllUsers(ctx context.Context, concurrency int) {
+	userIDs, err := cfg.DB.ListScannableUserIDs(ctx)
+	if err != nil {
+		log.Printf("Scheduler failed to list users to scan: %v", err)
+		return
+	}
+	log.Printf("Scheduler scanning %d users", len(userIDs))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, userID := range userIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(userID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cfg.scheduledScan(ctx, userID)
+		}(userID)
+	}
+	wg.Wait()
+	log.Println("Scheduler finished scanning all users")
+}
+
+func (cfg *apiConfig) scheduledScan(ctx context.Context, userID string) {
+	// a manual scan may already be running for this user
+	_, err := cfg.DB.GetRunningScanJobByUser(ctx, userID)
+	if err == nil {
+		log.Printf("Scheduler skipping user ID %s: scan already running", userID)
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Scheduler failed to check running scans for user ID %s: %v", userID, err)
+		return
+	}
+
+	scanners, err := cfg.scannersForUser(ctx, userID)
+	if err != nil {
+		log.Printf("Scheduler failed to connect to mailboxes for user ID %s: %v", userID, err)
+		return
+	}
+
+	job, err := cfg.createScanJob(ctx, userID)
+	if errors.Is(err, errScanInProgress) {
+		log.Printf("Scheduler skipping user ID %s: scan already running", userID)
+		return
+	}
+	if err != nil {
+		log.Printf("Scheduler failed to create scan job for user ID %s: %v", userID, err)
+		return
+	}
+	cfg.runScanJob(job.ID, userID, scanners)
+}
@@ -0,0 +1,107 @@
+-- name: CreateApprovalJob :one
+INSERT INTO approval_jobs (
+    id,
+    user_id,
+    staged_invoice_id,
+    attachment_ids,
+    next_attempt_at,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+--
+
+-- name: GetApprovalJob :one
+SELECT * FROM approval_jobs
+WHERE id = ? AND user_id = ?;
+--
+
+-- name: GetActiveApprovalJobByInvoice :one
+SELECT * FROM approval_jobs
+WHERE staged_invoice_id = ? AND status IN ('pending', 'running');
+--
+
+-- name: ListDueApprovalJobs :many
+SELECT * FROM approval_jobs
+WHERE status = 'pending' AND next_attempt_at <= ?
+ORDER BY next_attempt_at
+LIMIT ?;
+--
+
+-- name: ClaimApprovalJob :execrows
+UPDATE approval_jobs
+SET status = 'running', updated_at = ?
+WHERE id = ? AND status = 'pending';
+--
+
+-- name: SetApprovalJobStep :exec
+UPDATE approval_jobs
+SET step = ?, updated_at = ?
+WHERE id = ?;
+--
+
+-- name: RetryApprovalJob :exec
+UPDATE approval_jobs
+SET status = 'pending', attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ?
+WHERE id = ?;
+--
+
+-- name: FinishApprovalJob :exec
+UPDATE approval_jobs
+SET status = ?, attempts = ?, last_error = ?, finished_at = ?, updated_at = ?
+WHERE id = ?;
+--
+
+-- name: ResumeInterruptedApprovalJobs :exec
+UPDATE approval_jobs
+SET status = 'pending', next_attempt_at = ?, updated_at = ?
+WHERE status = 'running';
+--
+
+-- name: CreateApprovalJobFile :exec
+INSERT INTO approval_job_files (
+    approval_job_id,
+    position,
+    staged_attachment_id,
+    filename,
+    s3_key,
+    archived_at,
+    submitted_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+);
+--
+
+-- name: ListApprovalJobFiles :many
+SELECT * FROM approval_job_files
+WHERE approval_job_id = ?
+ORDER BY position;
+--
+
+-- name: MarkApprovalJobFileArchived :exec
+UPDATE approval_job_files
+SET archived_at = ?
+WHERE approval_job_id = ? AND position = ?;
+--
+
+-- name: MarkApprovalJobFileSubmitted :exec
+UPDATE approval_job_files
+SET submitted_at = ?
+WHERE approval_job_id = ? AND position = ?;
+--
+
+-- name: GetLatestFinishedApprovalJobByInvoice :one
+SELECT * FROM approval_jobs
+WHERE staged_invoice_id = ? AND status IN ('completed', 'failed')
+ORDER BY finished_at DESC
+LIMIT 1;
+--
+
+-- name: GetLatestCompletedApprovalJobByInvoice :one
+SELECT * FROM approval_jobs
+WHERE staged_invoice_id = ? AND status = 'completed'
+ORDER BY finished_at DESC
+LIMIT 1;
+--
@@ -0,0 +1,49 @@
+-- name: GetClassifierModel :one
+SELECT * FROM classifier_models
+WHERE user_id = ?;
+--
+
+-- name: ListClassifierFeatures :many
+SELECT * FROM classifier_features
+WHERE user_id = ?;
+--
+
+-- name: IncrementClassifierModel :exec
+INSERT INTO classifier_models(
+    user_id,
+    approved_count,
+    rejected_count,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?
+)
+ON CONFLICT(user_id) DO UPDATE SET
+    approved_count = classifier_models.approved_count + excluded.approved_count,
+    rejected_count = classifier_models.rejected_count + excluded.rejected_count,
+    updated_at = excluded.updated_at;
+--
+
+-- name: IncrementClassifierFeature :exec
+INSERT INTO classifier_features(
+    user_id,
+    feature,
+    approved_count,
+    rejected_count
+) VALUES (
+    ?, ?, ?, ?
+)
+ON CONFLICT(user_id, feature) DO UPDATE SET
+    approved_count = classifier_features.approved_count + excluded.approved_count,
+    rejected_count = classifier_features.rejected_count + excluded.rejected_count;
+--
+
+-- name: DeleteClassifierModel :exec
+DELETE FROM classifier_models
+WHERE user_id = ?;
+--
+
+-- name: DeleteClassifierFeatures :exec
+DELETE FROM classifier_features
+WHERE user_id = ?;
+--
@@ -0,0 +1,27 @@
+-- name: RecordGmailFailedMessage :exec
+INSERT INTO gmail_failed_messages (
+    user_id,
+    message_id,
+    needs_match,
+    last_error,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT(user_id, message_id) DO UPDATE SET
+    attempts = gmail_failed_messages.attempts + 1,
+    last_error = excluded.last_error,
+    updated_at = excluded.updated_at;
+--
+
+-- name: ListGmailFailedMessages :many
+SELECT * FROM gmail_failed_messages
+WHERE user_id = ? AND attempts < ?
+ORDER BY created_at;
+--
+
+-- name: DeleteGmailFailedMessage :exec
+DELETE FROM gmail_failed_messages
+WHERE user_id = ? AND message_id = ?;
+--
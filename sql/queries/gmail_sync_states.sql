@@ -0,0 +1,23 @@
+-- name: GetGmailSyncState :one
+SELECT * FROM gmail_sync_states
+WHERE user_id = ?;
+--
+
+-- name: UpsertGmailSyncState :exec
+INSERT INTO gmail_sync_states (
+    user_id,
+    history_id,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?
+)
+ON CONFLICT(user_id) DO UPDATE SET
+    history_id = excluded.history_id,
+    updated_at = excluded.updated_at;
+--
+
+-- name: DeleteGmailSyncState :exec
+DELETE FROM gmail_sync_states
+WHERE user_id = ?;
+--
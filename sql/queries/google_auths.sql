@@ -1,5 +1,5 @@
 -- name: GetGoogleAuthByUserID :one
-SELECT user_id, access_token, refresh_token, token_expiry, created_at, updated_at 
+SELECT user_id, access_token, refresh_token, token_expiry, needs_reauth, created_at, updated_at 
 FROM google_auths
 WHERE user_id = ?;
 --
@@ -19,5 +19,30 @@ ON CONFLICT(user_id) DO UPDATE SET
     access_token = excluded.access_token,
     refresh_token = excluded.refresh_token,
     token_expiry = excluded.token_expiry,
+    needs_reauth = FALSE,
     updated_at = excluded.updated_at;
---
\ No newline at end of file
+--
+
+-- name: ListScannableUserIDs :many
+SELECT user_id FROM google_auths
+WHERE refresh_token != '' AND needs_reauth = FALSE
+UNION
+SELECT user_id FROM imap_accounts;
+--
+
+-- name: MarkGoogleAuthNeedsReauth :exec
+UPDATE google_auths
+SET needs_reauth = TRUE, updated_at = ?
+WHERE user_id = ?;
+--
+
+-- name: ListGoogleAuthTokens :many
+SELECT user_id, access_token, refresh_token
+FROM google_auths;
+--
+
+-- name: UpdateGoogleAuthTokens :exec
+UPDATE google_auths
+SET access_token = ?, refresh_token = ?, updated_at = ?
+WHERE user_id = ?;
+--
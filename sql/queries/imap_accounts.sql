@@ -0,0 +1,42 @@
+-- name: GetImapAccount :one
+SELECT * FROM imap_accounts
+WHERE user_id = ?;
+--
+
+-- name: UpsertImapAccount :exec
+INSERT INTO imap_accounts(
+    user_id,
+    host,
+    port,
+    username,
+    password,
+    mailbox,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT(user_id) DO UPDATE SET
+    host = excluded.host,
+    port = excluded.port,
+    username = excluded.username,
+    password = excluded.password,
+    mailbox = excluded.mailbox,
+    updated_at = excluded.updated_at;
+--
+
+-- name: DeleteImapAccount :exec
+DELETE FROM imap_accounts
+WHERE user_id = ?;
+--
+
+-- name: ListImapAccountPasswords :many
+SELECT user_id, password
+FROM imap_accounts;
+--
+
+-- name: UpdateImapAccountPassword :exec
+UPDATE imap_accounts
+SET password = ?, updated_at = ?
+WHERE user_id = ?;
+--
@@ -0,0 +1,24 @@
+-- name: GetInboundAddressByUser :one
+SELECT * FROM inbound_addresses
+WHERE user_id = ?;
+--
+
+-- name: GetInboundAddressByToken :one
+SELECT * FROM inbound_addresses
+WHERE token = ?;
+--
+
+-- name: UpsertInboundAddress :one
+INSERT INTO inbound_addresses(
+    user_id,
+    token,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?
+)
+ON CONFLICT(user_id) DO UPDATE SET
+    token = excluded.token,
+    updated_at = excluded.updated_at
+RETURNING *;
+--
@@ -0,0 +1,33 @@
+-- name: CreateInvoiceEvent :exec
+INSERT INTO invoice_events (
+    id,
+    staged_invoice_id,
+    event,
+    from_status,
+    to_status,
+    actor,
+    actor_user_id,
+    client_ip,
+    user_agent,
+    approval_job_id,
+    s3_key,
+    accounting_response,
+    error,
+    created_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+);
+--
+
+-- name: ListInvoiceEventsByInvoice :many
+SELECT * FROM invoice_events
+WHERE staged_invoice_id = ?
+ORDER BY created_at, rowid;
+--
+
+-- name: GetLatestStatusChangeTo :one
+SELECT * FROM invoice_events
+WHERE staged_invoice_id = ? AND event = 'status_changed' AND to_status = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT 1;
+--
@@ -0,0 +1,62 @@
+-- name: UpsertInvoiceFields :exec
+INSERT INTO invoice_fields (
+    staged_invoice_id,
+    staged_attachment_id,
+    status,
+    total_amount,
+    total_amount_confidence,
+    vat_amount,
+    vat_amount_confidence,
+    currency,
+    currency_confidence,
+    invoice_number,
+    invoice_number_confidence,
+    issue_date,
+    issue_date_confidence,
+    due_date,
+    due_date_confidence,
+    supplier_tax_id,
+    supplier_tax_id_confidence,
+    allocation_number,
+    allocation_number_confidence,
+    text,
+    error,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT(staged_invoice_id) DO UPDATE SET
+    staged_attachment_id = excluded.staged_attachment_id,
+    status = excluded.status,
+    total_amount = excluded.total_amount,
+    total_amount_confidence = excluded.total_amount_confidence,
+    vat_amount = excluded.vat_amount,
+    vat_amount_confidence = excluded.vat_amount_confidence,
+    currency = excluded.currency,
+    currency_confidence = excluded.currency_confidence,
+    invoice_number = excluded.invoice_number,
+    invoice_number_confidence = excluded.invoice_number_confidence,
+    issue_date = excluded.issue_date,
+    issue_date_confidence = excluded.issue_date_confidence,
+    due_date = excluded.due_date,
+    due_date_confidence = excluded.due_date_confidence,
+    supplier_tax_id = excluded.supplier_tax_id,
+    supplier_tax_id_confidence = excluded.supplier_tax_id_confidence,
+    allocation_number = excluded.allocation_number,
+    allocation_number_confidence = excluded.allocation_number_confidence,
+    text = excluded.text,
+    error = excluded.error,
+    updated_at = excluded.updated_at;
+--
+
+-- name: GetInvoiceFields :one
+SELECT * FROM invoice_fields
+WHERE staged_invoice_id = ?;
+--
+
+-- name: ListInvoiceFieldsByUserStatus :many
+SELECT invoice_fields.* FROM invoice_fields
+JOIN staged_invoices ON staged_invoices.id = invoice_fields.staged_invoice_id
+WHERE staged_invoices.user_id = ? AND staged_invoices.status = ?;
+--
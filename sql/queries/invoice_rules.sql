@@ -0,0 +1,70 @@
+-- name: ListInvoiceRulesByUser :many
+SELECT * FROM invoice_rules
+WHERE user_id = ?
+ORDER BY position, created_at;
+--
+
+-- name: ListEnabledInvoiceRulesByUser :many
+SELECT * FROM invoice_rules
+WHERE user_id = ? AND enabled = TRUE
+ORDER BY position, created_at;
+--
+
+-- name: CreateInvoiceRule :one
+INSERT INTO invoice_rules(
+    id,
+    user_id,
+    name,
+    position,
+    sender_domain,
+    subject_contains,
+    action,
+    value,
+    enabled,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+--
+
+-- name: UpdateInvoiceRule :one
+UPDATE invoice_rules
+SET
+    name = ?,
+    position = ?,
+    sender_domain = ?,
+    subject_contains = ?,
+    action = ?,
+    value = ?,
+    enabled = ?,
+    updated_at = ?
+WHERE id = ? AND user_id = ?
+RETURNING *;
+--
+
+-- name: DeleteInvoiceRule :execrows
+DELETE FROM invoice_rules
+WHERE id = ? AND user_id = ?;
+--
+
+-- name: CreateInvoiceRuleHit :exec
+INSERT INTO invoice_rule_hits(
+    id,
+    staged_invoice_id,
+    rule_id,
+    rule_name,
+    action,
+    value,
+    created_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?
+);
+--
+
+-- name: ListInvoiceRuleHitsByInvoice :many
+SELECT * FROM invoice_rule_hits
+WHERE staged_invoice_id = ?
+ORDER BY created_at;
+--
@@ -0,0 +1,56 @@
+-- name: CreateScanJob :one
+INSERT INTO scan_jobs (
+    id,
+    user_id,
+    started_at,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?
+)
+RETURNING *;
+--
+
+-- name: GetScanJob :one
+SELECT * FROM scan_jobs
+WHERE id = ? AND user_id = ?;
+--
+
+-- name: GetRunningScanJobByUser :one
+SELECT * FROM scan_jobs
+WHERE user_id = ? AND status = 'running'
+ORDER BY started_at DESC
+LIMIT 1;
+--
+
+-- name: UpdateScanJobProgress :exec
+UPDATE scan_jobs
+SET
+    messages_seen = ?,
+    messages_staged = ?,
+    messages_skipped = ?,
+    messages_failed = ?,
+    last_error = ?,
+    updated_at = ?
+WHERE id = ?;
+--
+
+-- name: FinishScanJob :exec
+UPDATE scan_jobs
+SET
+    status = ?,
+    messages_seen = ?,
+    messages_staged = ?,
+    messages_skipped = ?,
+    messages_failed = ?,
+    last_error = ?,
+    finished_at = ?,
+    updated_at = ?
+WHERE id = ?;
+--
+
+-- name: FailInterruptedScanJobs :exec
+UPDATE scan_jobs
+SET status = 'failed', last_error = ?, finished_at = ?, updated_at = ?
+WHERE status = 'running';
+--
@@ -0,0 +1,32 @@
+-- name: GetScanRules :one
+SELECT * FROM scan_rules
+WHERE user_id = ?;
+--
+
+-- name: UpsertScanRules :exec
+INSERT INTO scan_rules(
+    user_id,
+    use_default_keywords,
+    include_keywords,
+    allowed_senders,
+    blocked_senders,
+    include_labels,
+    exclude_labels,
+    date_floor,
+    min_score,
+    created_at,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT(user_id) DO UPDATE SET
+    use_default_keywords = excluded.use_default_keywords,
+    include_keywords = excluded.include_keywords,
+    allowed_senders = excluded.allowed_senders,
+    blocked_senders = excluded.blocked_senders,
+    include_labels = excluded.include_labels,
+    exclude_labels = excluded.exclude_labels,
+    date_floor = excluded.date_floor,
+    min_score = excluded.min_score,
+    updated_at = excluded.updated_at;
+--
@@ -0,0 +1,37 @@
+-- name: CreateStagedAttachment :exec
+INSERT INTO staged_attachments (
+    id,
+    staged_invoice_id,
+    position,
+    gmail_part_id,
+    filename,
+    mime_type,
+    size,
+    created_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?
+);
+--
+
+-- name: ListStagedAttachmentsByInvoice :many
+SELECT * FROM staged_attachments
+WHERE staged_invoice_id = ?
+ORDER BY position;
+--
+
+-- name: GetStagedAttachmentByPosition :one
+SELECT * FROM staged_attachments
+WHERE staged_invoice_id = ? AND position = ?;
+--
+
+-- name: SetStagedAttachmentS3Key :exec
+UPDATE staged_attachments
+SET s3_key = ?
+WHERE id = ?;
+--
+
+-- name: ClearStagedAttachmentS3Keys :exec
+UPDATE staged_attachments
+SET s3_key = NULL
+WHERE staged_invoice_id = ?;
+--
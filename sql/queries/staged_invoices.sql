@@ -2,8 +2,16 @@
 INSERT INTO staged_invoices (
     id,
     user_id,
+    source,
     gmail_message_id,
+    internet_message_id,
     gmail_thread_id,
+    status,
+    score,
+    approve_probability,
+    suggestion,
+    tags,
+    category,
     sender,
     subject,
     snippet,
@@ -12,7 +20,7 @@ INSERT INTO staged_invoices (
     created_at,
     updated_at
 ) VALUES (
-    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 )
 RETURNING *; 
 --
@@ -21,7 +29,7 @@ RETURNING *;
 SELECT * FROM staged_invoices
 WHERE 
     user_id = ? 
-    AND status = 'pending_review'
+    AND status = ?
     AND received_at >= ?
     AND received_at <= ?
     ORDER BY received_at DESC
@@ -29,6 +37,18 @@ LIMIT ?
 OFFSET ?; 
 --
 
+-- name: ListStagedInvoicesByUserByScore :many
+SELECT * FROM staged_invoices
+WHERE
+    user_id = ?
+    AND status = ?
+    AND received_at >= ?
+    AND received_at <= ?
+    ORDER BY score DESC, received_at DESC
+LIMIT ?
+OFFSET ?;
+--
+
 -- name: GetStagedInvoice :one 
 SELECT * FROM staged_invoices
 WHERE id = ? AND user_id = ?;
@@ -43,4 +63,74 @@ WHERE id = ? AND user_id = ?;
 -- name: GetStagedInvoicesByMessageId :many
 SELECT * FROM staged_invoices
 WHERE user_id = ? AND gmail_message_id = ?;
---
\ No newline at end of file
+--
+
+-- name: ListStagedMessageIDsByUser :many
+SELECT gmail_message_id FROM staged_invoices
+WHERE user_id = ? AND source = ?;
+--
+
+-- name: ListInternetMessageIDsByUser :many
+SELECT internet_message_id FROM staged_invoices
+WHERE user_id = ? AND internet_message_id IS NOT NULL;
+--
+
+-- name: GetStagedInvoiceByInternetMessageID :one
+SELECT * FROM staged_invoices
+WHERE user_id = ? AND internet_message_id = ?
+LIMIT 1;
+--
+
+-- name: ListSenderDecisionsByUser :many
+SELECT sender, status FROM staged_invoices
+WHERE user_id = ? AND status IN ('approved', 'rejected');
+--
+
+-- name: ListDecidedInvoicesByUser :many
+SELECT * FROM staged_invoices
+WHERE user_id = ? AND status IN ('approved', 'rejected') AND (
+    EXISTS (
+        SELECT 1 FROM invoice_events
+        WHERE invoice_events.staged_invoice_id = staged_invoices.id
+            AND invoice_events.event = 'status_changed'
+            AND invoice_events.actor = 'user'
+            AND invoice_events.to_status = CASE staged_invoices.status WHEN 'approved' THEN 'approving' ELSE 'rejected' END
+    )
+    OR NOT EXISTS (
+        SELECT 1 FROM invoice_events
+        WHERE invoice_events.staged_invoice_id = staged_invoices.id
+    )
+);
+--
+
+-- name: ListStagedInvoicesByStatus :many
+SELECT * FROM staged_invoices
+WHERE user_id = ? AND status = ?
+ORDER BY received_at;
+--
+
+-- name: TransitionStagedInvoiceStatus :execrows
+UPDATE staged_invoices
+SET status = ?, updated_at = ?
+WHERE id = ? AND user_id = ? AND status = ?;
+--
+
+-- name: ListStagedInvoicesWithoutFields :many
+SELECT * FROM staged_invoices
+WHERE user_id = ?
+    AND status IN ('pending_review', 'low_confidence', 'approval_queued')
+    AND id NOT IN (SELECT staged_invoice_id FROM invoice_fields)
+ORDER BY received_at
+LIMIT ?;
+--
+
+-- name: UpdateStagedInvoiceDocumentType :exec
+UPDATE staged_invoices
+SET document_type = ?, document_type_confidence = ?
+WHERE id = ? AND user_id = ?;
+--
+
+-- name: DeleteStagedInvoice :exec
+DELETE FROM staged_invoices
+WHERE id = ? AND user_id = ?;
+--
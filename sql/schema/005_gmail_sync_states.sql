@@ -0,0 +1,11 @@
+-- +goose Up
+
+CREATE TABLE gmail_sync_states(
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    history_id INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE gmail_sync_states;
@@ -0,0 +1,24 @@
+-- +goose Up
+
+CREATE TABLE scan_jobs(
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    status TEXT NOT NULL DEFAULT 'running',
+
+    messages_seen INTEGER NOT NULL DEFAULT 0,
+    messages_staged INTEGER NOT NULL DEFAULT 0,
+    messages_skipped INTEGER NOT NULL DEFAULT 0,
+    messages_failed INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+
+    started_at INTEGER NOT NULL,
+    finished_at INTEGER,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_scan_jobs_user_status ON scan_jobs (user_id, status);
+
+-- +goose Down
+DROP TABLE scan_jobs;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE google_auths ADD COLUMN needs_reauth BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE google_auths DROP COLUMN needs_reauth;
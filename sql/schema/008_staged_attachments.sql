@@ -0,0 +1,21 @@
+-- +goose Up
+
+CREATE TABLE staged_attachments(
+    id TEXT PRIMARY KEY,
+    staged_invoice_id TEXT NOT NULL REFERENCES staged_invoices(id) ON DELETE CASCADE,
+
+    position INTEGER NOT NULL,
+    gmail_part_id TEXT NOT NULL,
+    gmail_attachment_id TEXT NOT NULL,
+
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+
+    created_at INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_staged_attachments_invoice_position ON staged_attachments (staged_invoice_id, position);
+
+-- +goose Down
+DROP TABLE staged_attachments;
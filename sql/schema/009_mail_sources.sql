@@ -0,0 +1,20 @@
+-- +goose Up
+-- messages from other mailboxes keep their source specific ID in gmail_message_id
+ALTER TABLE staged_invoices ADD COLUMN source TEXT NOT NULL DEFAULT 'gmail';
+
+CREATE TABLE imap_accounts(
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    password TEXT NOT NULL,
+    mailbox TEXT NOT NULL DEFAULT 'INBOX',
+
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE imap_accounts;
+ALTER TABLE staged_invoices DROP COLUMN source;
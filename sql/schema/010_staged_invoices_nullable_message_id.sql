@@ -0,0 +1,80 @@
+-- +goose Up
+-- uploaded documents have no message, so gmail_message_id becomes nullable. SQLite can't
+-- change a column constraint in place, the table is rebuilt instead. Dropping the old
+-- table cascades to staged_attachments, so those rows are set aside and put back.
+CREATE TABLE staged_attachments_backup AS SELECT * FROM staged_attachments;
+
+CREATE TABLE staged_invoices_new(
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    gmail_message_id TEXT,
+    gmail_thread_id TEXT NOT NULL,
+
+    status TEXT NOT NULL DEFAULT 'pending_review',
+
+    sender TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    snippet TEXT,
+
+    has_attachment BOOLEAN NOT NULL DEFAULT FALSE,
+
+    received_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+
+    source TEXT NOT NULL DEFAULT 'gmail'
+);
+
+INSERT INTO staged_invoices_new SELECT
+    id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet,
+    has_attachment, received_at, created_at, updated_at, source
+FROM staged_invoices;
+
+DROP TABLE staged_invoices;
+ALTER TABLE staged_invoices_new RENAME TO staged_invoices;
+CREATE INDEX idx_staged_invoices_user_status ON staged_invoices (user_id, status);
+
+DELETE FROM staged_attachments;
+INSERT INTO staged_attachments SELECT * FROM staged_attachments_backup;
+DROP TABLE staged_attachments_backup;
+
+-- +goose Down
+DELETE FROM staged_invoices WHERE gmail_message_id IS NULL;
+
+CREATE TABLE staged_attachments_backup AS SELECT * FROM staged_attachments;
+
+CREATE TABLE staged_invoices_old(
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    gmail_message_id TEXT NOT NULL,
+    gmail_thread_id TEXT NOT NULL,
+
+    status TEXT NOT NULL DEFAULT 'pending_review',
+
+    sender TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    snippet TEXT,
+
+    has_attachment BOOLEAN NOT NULL DEFAULT FALSE,
+
+    received_at INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+
+    source TEXT NOT NULL DEFAULT 'gmail'
+);
+
+INSERT INTO staged_invoices_old SELECT
+    id, user_id, gmail_message_id, gmail_thread_id, status, sender, subject, snippet,
+    has_attachment, received_at, created_at, updated_at, source
+FROM staged_invoices;
+
+DROP TABLE staged_invoices;
+ALTER TABLE staged_invoices_old RENAME TO staged_invoices;
+CREATE INDEX idx_staged_invoices_user_status ON staged_invoices (user_id, status);
+
+DELETE FROM staged_attachments;
+INSERT INTO staged_attachments SELECT * FROM staged_attachments_backup;
+DROP TABLE staged_attachments_backup;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- the Message-ID header, which stays the same for a message across mailboxes and exports
+ALTER TABLE staged_invoices ADD COLUMN internet_message_id TEXT;
+CREATE INDEX idx_staged_invoices_user_internet_message_id ON staged_invoices (user_id, internet_message_id);
+
+-- +goose Down
+DROP INDEX idx_staged_invoices_user_internet_message_id;
+ALTER TABLE staged_invoices DROP COLUMN internet_message_id;
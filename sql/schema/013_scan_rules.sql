@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE scan_rules(
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    use_default_keywords BOOLEAN NOT NULL DEFAULT TRUE,
+    include_keywords TEXT NOT NULL DEFAULT '[]',
+    allowed_senders TEXT NOT NULL DEFAULT '[]',
+    blocked_senders TEXT NOT NULL DEFAULT '[]',
+    include_labels TEXT NOT NULL DEFAULT '[]',
+    exclude_labels TEXT NOT NULL DEFAULT '[]',
+    date_floor TEXT,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE scan_rules;
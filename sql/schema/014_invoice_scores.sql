@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE staged_invoices ADD COLUMN score INTEGER;
+ALTER TABLE scan_rules ADD COLUMN min_score INTEGER NOT NULL DEFAULT 40;
+CREATE INDEX idx_staged_invoices_user_status_score ON staged_invoices (user_id, status, score);
+
+-- +goose Down
+DROP INDEX idx_staged_invoices_user_status_score;
+ALTER TABLE scan_rules DROP COLUMN min_score;
+ALTER TABLE staged_invoices DROP COLUMN score;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE classifier_models(
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    approved_count INTEGER NOT NULL DEFAULT 0,
+    rejected_count INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE classifier_features(
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feature TEXT NOT NULL,
+    approved_count INTEGER NOT NULL DEFAULT 0,
+    rejected_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, feature)
+);
+
+ALTER TABLE staged_invoices ADD COLUMN approve_probability REAL;
+ALTER TABLE staged_invoices ADD COLUMN suggestion TEXT;
+
+-- +goose Down
+ALTER TABLE staged_invoices DROP COLUMN suggestion;
+ALTER TABLE staged_invoices DROP COLUMN approve_probability;
+DROP TABLE classifier_features;
+DROP TABLE classifier_models;
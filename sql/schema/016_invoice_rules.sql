@@ -0,0 +1,38 @@
+-- +goose Up
+CREATE TABLE invoice_rules(
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    sender_domain TEXT NOT NULL DEFAULT '',
+    subject_contains TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_invoice_rules_user_position ON invoice_rules (user_id, position);
+
+-- rule_id is kept without a reference so hits outlive deleted rules
+CREATE TABLE invoice_rule_hits(
+    id TEXT PRIMARY KEY,
+    staged_invoice_id TEXT NOT NULL REFERENCES staged_invoices(id) ON DELETE CASCADE,
+    rule_id TEXT NOT NULL,
+    rule_name TEXT NOT NULL,
+    action TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_invoice_rule_hits_invoice ON invoice_rule_hits (staged_invoice_id);
+
+ALTER TABLE staged_invoices ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE staged_invoices ADD COLUMN category TEXT;
+
+-- +goose Down
+ALTER TABLE staged_invoices DROP COLUMN category;
+ALTER TABLE staged_invoices DROP COLUMN tags;
+DROP TABLE invoice_rule_hits;
+DROP TABLE invoice_rules;
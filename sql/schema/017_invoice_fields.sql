@@ -0,0 +1,31 @@
+-- +goose Up
+-- one row per invoice, written once its attachments have been read. Every value has a
+-- confidence between 0 and 1, and stays NULL when nothing was found.
+CREATE TABLE invoice_fields(
+    staged_invoice_id TEXT PRIMARY KEY REFERENCES staged_invoices(id) ON DELETE CASCADE,
+    staged_attachment_id TEXT,
+    status TEXT NOT NULL,
+
+    total_amount REAL,
+    total_amount_confidence REAL NOT NULL DEFAULT 0,
+    vat_amount REAL,
+    vat_amount_confidence REAL NOT NULL DEFAULT 0,
+    currency TEXT,
+    currency_confidence REAL NOT NULL DEFAULT 0,
+    invoice_number TEXT,
+    invoice_number_confidence REAL NOT NULL DEFAULT 0,
+    issue_date TEXT,
+    issue_date_confidence REAL NOT NULL DEFAULT 0,
+    due_date TEXT,
+    due_date_confidence REAL NOT NULL DEFAULT 0,
+    supplier_tax_id TEXT,
+    supplier_tax_id_confidence REAL NOT NULL DEFAULT 0,
+
+    text TEXT NOT NULL DEFAULT '',
+    error TEXT,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE invoice_fields;
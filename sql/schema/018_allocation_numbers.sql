@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE invoice_fields ADD COLUMN allocation_number TEXT;
+ALTER TABLE invoice_fields ADD COLUMN allocation_number_confidence REAL NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE invoice_fields DROP COLUMN allocation_number_confidence;
+ALTER TABLE invoice_fields DROP COLUMN allocation_number;
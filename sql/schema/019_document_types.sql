@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE staged_invoices ADD COLUMN document_type TEXT;
+ALTER TABLE staged_invoices ADD COLUMN document_type_confidence REAL;
+
+-- +goose Down
+ALTER TABLE staged_invoices DROP COLUMN document_type_confidence;
+ALTER TABLE staged_invoices DROP COLUMN document_type;
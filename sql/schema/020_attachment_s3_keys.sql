@@ -0,0 +1,6 @@
+-- +goose Up
+-- where an approved attachment was archived, so it can still be shown after approval
+ALTER TABLE staged_attachments ADD COLUMN s3_key TEXT;
+
+-- +goose Down
+ALTER TABLE staged_attachments DROP COLUMN s3_key;
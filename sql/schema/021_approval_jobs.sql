@@ -0,0 +1,36 @@
+-- +goose Up
+-- step is the last one finished: created, fetched, archived, submitted, completed
+CREATE TABLE approval_jobs(
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    staged_invoice_id TEXT NOT NULL REFERENCES staged_invoices(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    step TEXT NOT NULL DEFAULT 'created',
+    attachment_ids TEXT NOT NULL DEFAULT '[]',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    last_error TEXT,
+    finished_at INTEGER,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- one approval in flight per invoice, approving again picks it up
+CREATE UNIQUE INDEX idx_approval_jobs_active_invoice ON approval_jobs (staged_invoice_id)
+WHERE status IN ('pending', 'running');
+CREATE INDEX idx_approval_jobs_status_next_attempt ON approval_jobs (status, next_attempt_at);
+
+CREATE TABLE approval_job_files(
+    approval_job_id TEXT NOT NULL REFERENCES approval_jobs(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    staged_attachment_id TEXT,
+    filename TEXT NOT NULL,
+    s3_key TEXT NOT NULL,
+    archived_at INTEGER,
+    submitted_at INTEGER,
+    PRIMARY KEY (approval_job_id, position)
+);
+
+-- +goose Down
+DROP TABLE approval_job_files;
+DROP TABLE approval_jobs;
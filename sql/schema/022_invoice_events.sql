@@ -0,0 +1,24 @@
+-- +goose Up
+-- append-only, there are deliberately no queries that update or delete events.
+-- actor is user, automation or approval_job, actor_user_id is set for users only
+CREATE TABLE invoice_events(
+    id TEXT PRIMARY KEY,
+    staged_invoice_id TEXT NOT NULL REFERENCES staged_invoices(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    from_status TEXT,
+    to_status TEXT,
+    actor TEXT NOT NULL,
+    actor_user_id TEXT,
+    client_ip TEXT,
+    user_agent TEXT,
+    approval_job_id TEXT,
+    s3_key TEXT,
+    accounting_response TEXT,
+    error TEXT,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_invoice_events_invoice ON invoice_events (staged_invoice_id, created_at);
+
+-- +goose Down
+DROP TABLE invoice_events;
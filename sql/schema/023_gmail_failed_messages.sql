@@ -0,0 +1,16 @@
+-- +goose Up
+-- messages a scan couldn't stage, retried by the next scan since the history cursor
+-- moves past them. needs_match is set for history hits, which Gmail didn't filter.
+CREATE TABLE gmail_failed_messages(
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id TEXT NOT NULL,
+    needs_match BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, message_id)
+);
+
+-- +goose Down
+DROP TABLE gmail_failed_messages;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- never filled in, Gmail attachment IDs change between fetches so gmail_part_id is kept instead
+ALTER TABLE staged_attachments DROP COLUMN gmail_attachment_id;
+
+-- +goose Down
+ALTER TABLE staged_attachments ADD COLUMN gmail_attachment_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- +goose Up
+-- scans that raced each other, all but the newest running one per user are failed
+UPDATE scan_jobs SET status = 'failed', last_error = 'another scan was running', finished_at = updated_at
+WHERE status = 'running' AND id NOT IN (
+    SELECT id FROM scan_jobs AS newest
+    WHERE newest.user_id = scan_jobs.user_id AND newest.status = 'running'
+    ORDER BY newest.started_at DESC
+    LIMIT 1
+);
+
+-- one scan running per user, starting another while it runs is refused
+CREATE UNIQUE INDEX idx_scan_jobs_running_user ON scan_jobs (user_id)
+WHERE status = 'running';
+
+-- +goose Down
+DROP INDEX idx_scan_jobs_running_user;
@@ -10,6 +10,8 @@ document.addEventListener('DOMContentLoaded', () => {
      const nextPageBtn = document.getElementById('next-page-btn');
      const pageInfoSpan = document.getElementById('page-info');
      const notificationArea = document.getElementById('notification-area');
+     const scanButton = document.getElementById('scan-button');
+     const statusFilter = document.getElementById('status-filter');
 
      let currentPage = 1;
      const limit = 25;
@@ -87,13 +89,89 @@ document.addEventListener('DOMContentLoaded', () => {
       id="logout-button">Logout</button>`;
 
          document.getElementById('logout-button').addEventListener('click', logout);
+         if (user.NeedsReauth) {
+             showNotification('Your Google authorization has expired. <a href="/api/v1/oauth/google/login">Log in again</a> to keep scanning.', 'error');
+         }
          fetchStagedInvoices();
      };
 
+     const documentTypeLabels = {
+         tax_invoice: 'Tax invoice',
+         receipt: 'Receipt',
+         invoice_receipt: 'Invoice/receipt',
+         credit_note: 'Credit note',
+         quote: 'Quote',
+     };
+
+     const formatDocumentType = (invoice) => {
+         const label = documentTypeLabels[invoice.DocumentType.String];
+         return label ? ` <span class="doc-type ${invoice.DocumentType.String}">${label}</span>` : '';
+     };
+
+     // fields read from the PDF, shown greyed out when the extraction wasn't sure
+     const formatFields = (fields) => {
+         if (!fields || fields.total.confidence === 0) {
+             return '';
+         }
+         const amount = `${fields.total.value.toFixed(2)} ${fields.currency.value}`;
+         const details = [];
+         if (fields.invoice_number.value) details.push(`No. ${fields.invoice_number.value}`);
+         if (fields.issue_date.value) details.push(`Issued ${fields.issue_date.value}`);
+         if (fields.due_date.value) details.push(`Due ${fields.due_date.value}`);
+         if (fields.vat.confidence > 0) details.push(`VAT ${fields.vat.value.toFixed(2)}`);
+         if (fields.supplier_tax_id.value) details.push(`Tax ID ${fields.supplier_tax_id.value}`);
+         if (fields.allocation_number.value) details.push(`Allocation ${fields.allocation_number.value}`);
+         const lowConfidence = fields.total.confidence < 0.5 ? ' class="low-confidence"' : '';
+         const issues = fields.issues.map(issue => issue.message).join('\n');
+         const warning = issues ? ` <span class="issue-flag" title="${issues}">&#9888;</span>` : '';
+         return `<span${lowConfidence} title="${details.join(', ')}">${amount}</span>${warning}`;
+     };
+
+     // what can be done with an invoice depends on where it is
+     const actionButtons = (invoice) => {
+         const history = `<button class="history-btn" data-id="${invoice.ID}">History</button>`;
+         switch (invoice.Status) {
+         case 'rejected':
+             return `<button class="reopen-btn" data-id="${invoice.ID}">Reopen</button>${history}`;
+         case 'approved':
+             return `<button class="revoke-btn" data-id="${invoice.ID}">Revoke</button>${history}`;
+         default:
+             return `<button class="approve-btn" data-id="${invoice.ID}">Approve</button>
+                 <button class="reject-btn" data-id="${invoice.ID}">Reject</button>${history}`;
+         }
+     };
+
+     const formatEvent = (event) => {
+         const when = new Date(event.CreatedAt * 1000).toLocaleString();
+         const what = event.Event === 'status_changed'
+             ? `${event.FromStatus.String} &rarr; ${event.ToStatus.String}`
+             : event.Event.replaceAll('_', ' ');
+         const detail = event.S3Key.Valid ? ` (${event.S3Key.String})` : event.Error.Valid ? `: ${event.Error.String}` : '';
+         return `<li>${when} &middot; ${what}${detail} &middot; ${event.Actor}</li>`;
+     };
+
+     const toggleHistory = async (row, invoiceId) => {
+         const next = row.nextElementSibling;
+         if (next && next.classList.contains('history-row')) {
+             next.remove();
+             return;
+         }
+         const response = await fetch(`/api/v1/invoices/${invoiceId}/history`);
+         const events = await response.json();
+         if (!response.ok) {
+             showNotification(`Error: ${events.error}`, 'error');
+             return;
+         }
+         const historyRow = document.createElement('tr');
+         historyRow.className = 'history-row';
+         historyRow.innerHTML = `<td colspan="5"><ul>${(events || []).map(formatEvent).join('')}</ul></td>`;
+         row.after(historyRow);
+     };
+
      const fetchStagedInvoices = async () => {
         const offset = (currentPage - 1) * limit;
          try {
-             const response = await fetch(`/api/v1/invoices/staged?limit=${limit}&offset=${offset}`);
+             const response = await fetch(`/api/v1/invoices/staged?limit=${limit}&offset=${offset}&status=${statusFilter.value}`);
              const invoices = await response.json();
              invoicesTableBody.innerHTML = ''; 
              if (invoices && invoices.length > 0) {
@@ -103,18 +181,15 @@ document.addEventListener('DOMContentLoaded', () => {
                          <td>${new Date(invoice.ReceivedAt * 1000).toLocaleDateString
       ()}</td>
                          <td>${invoice.Sender}</td>
-                         <td>${invoice.Subject}</td>
-                         <td class="actions">
-                             <button class="approve-btn" data-id="${invoice.ID}">Approve
-      </button>
-                             <button class="reject-btn" data-id="${invoice.ID}">Reject
-      </button>
-                         </td>
+                         <td>${invoice.Subject}${formatDocumentType(invoice)}</td>
+                         <td>${formatFields(invoice.fields)}</td>
+                         <td class="actions">${actionButtons(invoice)}</td>
                      `;
                      invoicesTableBody.appendChild(row);
                  });
              } else {
-                 invoicesTableBody.innerHTML = '<tr><td colspan="4">No invoices pending review.</td></tr>';
+                 const label = statusFilter.options[statusFilter.selectedIndex].text.toLowerCase();
+                 invoicesTableBody.innerHTML = `<tr><td colspan="5">No invoices ${label}.</td></tr>`;
              }
         
              pageInfoSpan.textContent = `Page ${currentPage}`;
@@ -126,6 +201,11 @@ document.addEventListener('DOMContentLoaded', () => {
          }
      };
 
+     statusFilter.addEventListener('change', () => {
+        currentPage = 1;
+        fetchStagedInvoices();
+     });
+
      prevPageBtn.addEventListener(`click`, () => {
         if (currentPage > 1) {
             currentPage--;
@@ -138,11 +218,81 @@ document.addEventListener('DOMContentLoaded', () => {
         fetchStagedInvoices();
      });
 
+     const pollScan = async (scanId) => {
+         const response = await fetch(`/api/v1/scans/${scanId}`);
+         const scan = await response.json();
+         if (!response.ok) {
+             showNotification(`Error: ${scan.error}`, 'error');
+             scanButton.disabled = false;
+             return;
+         }
+         if (scan.Status === 'running') {
+             setTimeout(() => pollScan(scanId), 2000);
+             return;
+         }
+         scanButton.disabled = false;
+         if (scan.Status === 'completed') {
+             showNotification(`Scan finished: ${scan.MessagesStaged} new invoices staged.`, 'success');
+         } else {
+             showNotification(`Scan failed: ${scan.LastError.String}`, 'error');
+         }
+         fetchStagedInvoices();
+     };
+
+     scanButton.addEventListener('click', async () => {
+         scanButton.disabled = true;
+         try {
+             const response = await fetch('/api/v1/scans', { method: 'POST' });
+             const scan = await response.json();
+             if (response.ok || response.status === 409) {
+                 showNotification('Scanning for new invoices...', 'success');
+                 pollScan(scan.ID);
+             } else {
+                 showNotification(`Error: ${scan.error}`, 'error');
+                 scanButton.disabled = false;
+             }
+         } catch (error) {
+             console.error('Error starting scan:', error);
+             showNotification('An error occurred.', 'error');
+             scanButton.disabled = false;
+         }
+     });
+
+     const pollApproval = async (jobId) => {
+         const response = await fetch(`/api/v1/approvals/${jobId}`);
+         const job = await response.json();
+         if (!response.ok) {
+             showNotification(`Error: ${job.error}`, 'error');
+             return;
+         }
+         if (job.Status === 'completed') {
+             showNotification('Invoice successfully approved!', 'success');
+         } else if (job.Status === 'failed') {
+             showNotification(`Approval failed: ${job.LastError.String}`, 'error');
+             fetchStagedInvoices();
+         } else if (job.Attempts > 0) {
+             // the server keeps retrying in the background
+             showNotification(`Approval delayed, retrying: ${job.LastError.String}`, 'error');
+         } else {
+             setTimeout(() => pollApproval(jobId), 2000);
+         }
+     };
+
      const logout = async () => {
          await fetch('/api/v1/auth/logout', { method: 'POST' });
          showLoggedOutView();
      };
 
+     // the invoice's row goes together with its history when that's open
+     const removeRow = (target) => {
+         const row = target.closest('tr');
+         const next = row.nextElementSibling;
+         if (next && next.classList.contains('history-row')) {
+             next.remove();
+         }
+         row.remove();
+     };
+
      invoicesTableBody.addEventListener('click', async (event) => {
          const target = event.target;
          const invoiceId = target.dataset.id;
@@ -154,15 +304,60 @@ document.addEventListener('DOMContentLoaded', () => {
          if (target.classList.contains('approve-btn')) {
              response = await fetch(`/api/v1/invoices/${invoiceId}/approve`, { method: 'POST' });
              action = 'approved';
+             if (response.status === 409) {
+                 // e.g. a missing allocation number, the user may still approve
+                 const blocked = await response.json();
+                 if (!blocked.issues) {
+                     showNotification(`Error: ${blocked.error}`, 'error');
+                     return;
+                 }
+                 const reasons = blocked.issues.map(issue => issue.message).join('\n');
+                 if (!confirm(`${reasons}\n\nApprove anyway?`)) {
+                     return;
+                 }
+                 response = await fetch(`/api/v1/invoices/${invoiceId}/approve`, {
+                     method: 'POST',
+                     headers: { 'Content-Type': 'application/json' },
+                     body: JSON.stringify({ accept_issues: true })
+                 });
+             }
          } else if (target.classList.contains('reject-btn')) {
              response = await fetch(`/api/v1/invoices/${invoiceId}/reject`, { method: 'POST' });
              action = 'rejected';
+         } else if (target.classList.contains('reopen-btn')) {
+             response = await fetch(`/api/v1/invoices/${invoiceId}/reopen`, { method: 'POST' });
+             action = 'reopened';
+         } else if (target.classList.contains('revoke-btn')) {
+             if (!confirm('Revoke the approval and delete the archived files?')) {
+                 return;
+             }
+             response = await fetch(`/api/v1/invoices/${invoiceId}/revoke`, { method: 'POST' });
+             action = 'revoked';
+             if (response.ok) {
+                 const revoked = await response.json();
+                 removeRow(target);
+                 if (revoked.accounting_rolled_back) {
+                     showNotification('Approval revoked.', 'success');
+                 } else {
+                     const files = revoked.accounting_files.length ? `: ${revoked.accounting_files.join(', ')}` : '';
+                     showNotification(`Approval revoked. ${revoked.accounting_note}${files}`, 'error');
+                 }
+                 return;
+             }
+         } else if (target.classList.contains('history-btn')) {
+             toggleHistory(target.closest('tr'), invoiceId);
+             return;
          } else {
             return;
          }
-         if (response.ok) {
+         if (response.status === 202) {
+            const job = await response.json();
+            showNotification('Approving invoice...', 'success');
+            removeRow(target);
+            pollApproval(job.ID);
+         } else if (response.ok) {
             showNotification(`Invoice successfully ${action}!`, 'success');
-            target.closest('tr').remove();
+            removeRow(target);
          } else {
             const errorData = await response.json();
             showNotification(`Error: ${errorData.error}`, 'error')
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// storedMessageSource serves messages we received ourselves and keep in S3 as raw
+// RFC 822 source: mail sent to the inbound SMTP listener and imported archives.
+type storedMessageSource struct {
+	s3     fileStore
+	name   string
+	userID string
+}
+
+var _ mailsource.MailSource = storedMessageSource{}
+
+func (s storedMessageSource) Name() string {
+	return s.name
+}
+
+func (s storedMessageSource) Search(ctx context.Context, criteria mailsource.SearchCriteria, limit int) ([]string, error) {
+	return nil, fmt.Errorf("%s messages can't be searched", s.name)
+}
+
+func (s storedMessageSource) GetMetadata(ctx context.Context, messageID string) (*mailsource.Message, error) {
+	raw, err := s.GetRaw(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return mailsource.ParseRaw(messageID, raw, time.Time{})
+}
+
+func (s storedMessageSource) GetAttachment(ctx context.Context, messageID, partID string) ([]byte, error) {
+	raw, err := s.GetRaw(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return mailsource.RawAttachment(raw, partID)
+}
+
+func (s storedMessageSource) GetRaw(ctx context.Context, messageID string) ([]byte, error) {
+	return s.s3.DownloadFile(ctx, storedMessageKey(s.userID, messageID))
+}
+
+func storedMessageKey(userID, messageID string) string {
+	return fmt.Sprintf("messages/%s/%s.eml", userID, messageID)
+}
+
+// stageStoredMessage keeps the raw message in S3 and stages it as an invoice from source.
+// msg has to come from mailsource.ParseRaw on the same raw source. It reports false
+// when one of the user's rules skipped the message, and mailsource.ErrAlreadyStaged
+// when its Message-ID is staged already.
+func (cfg *apiConfig) stageStoredMessage(ctx context.Context, userID, source string, msg *mailsource.Message, raw []byte, assessor *mailsource.Assessor) (bool, error) {
+	assessment := assessor.Assess(msg)
+	if assessment.Skip() {
+		return false, nil
+	}
+	// checked before the upload too, so a duplicate doesn't leave a stray copy in S3
+	staged, err := mailsource.AlreadyStaged(ctx, cfg.DB, userID, msg.InternetMessageID)
+	if err != nil {
+		return false, err
+	}
+	if staged {
+		return false, mailsource.ErrAlreadyStaged
+	}
+
+	if err := cfg.S3.UploadFile(ctx, storedMessageKey(userID, msg.ID), raw); err != nil {
+		return false, err
+	}
+	if err := mailsource.StageMessage(ctx, cfg.DB, userID, source, msg, assessment); err != nil {
+		return false, err
+	}
+	return true, nil
+}
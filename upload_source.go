@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/felixsolom/fetch-duck/internal/mailsource"
+)
+
+// uploadSourceName is recorded on invoices created from uploaded documents.
+const uploadSourceName = "upload"
+
+var errNoMailbox = errors.New("uploaded invoices have no mailbox")
+
+// uploadSource serves uploaded documents to the approve path like any other mailbox.
+// The uploads are kept in S3 and their staged attachment part ID is the object key.
+type uploadSource struct {
+	s3 fileStore
+}
+
+var _ mailsource.MailSource = uploadSource{}
+
+func (s uploadSource) Name() string {
+	return uploadSourceName
+}
+
+func (s uploadSource) Search(ctx context.Context, criteria mailsource.SearchCriteria, limit int) ([]string, error) {
+	return nil, errNoMailbox
+}
+
+func (s uploadSource) GetMetadata(ctx context.Context, messageID string) (*mailsource.Message, error) {
+	return nil, errNoMailbox
+}
+
+func (s uploadSource) GetAttachment(ctx context.Context, messageID, partID string) ([]byte, error) {
+	return s.s3.DownloadFile(ctx, partID)
+}
+
+func (s uploadSource) GetRaw(ctx context.Context, messageID string) ([]byte, error) {
+	return nil, errNoMailbox
+}